@@ -2,8 +2,14 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/edaniels/golog"
 
@@ -31,26 +37,304 @@ func (s responseStatusError) Status() int {
 	return int(s)
 }
 
+// ErrorResponses for common statuses. They may be returned as they are, wrapped, or compared
+// against with errors.Is, which also matches the errors of NewErrorResponse with the same status.
+var (
+	ErrBadRequest      = ErrorResponseStatus(http.StatusBadRequest)
+	ErrUnauthorized    = ErrorResponseStatus(http.StatusUnauthorized)
+	ErrForbidden       = ErrorResponseStatus(http.StatusForbidden)
+	ErrNotFound        = ErrorResponseStatus(http.StatusNotFound)
+	ErrConflict        = ErrorResponseStatus(http.StatusConflict)
+	ErrTooManyRequests = ErrorResponseStatus(http.StatusTooManyRequests)
+	ErrInternal        = ErrorResponseStatus(http.StatusInternalServerError)
+)
+
+// NewErrorResponse returns an ErrorResponse with the given status and a message formatted as by
+// fmt.Errorf, so that any error given for a %w verb is wrapped. It matches ErrorResponseStatus of
+// the same status, such as ErrNotFound, with errors.Is.
+func NewErrorResponse(status int, format string, args ...interface{}) ErrorResponse {
+	return statusErrorResponse{fmt.Errorf(format, args...), status}
+}
+
+// DetailedErrorResponse is an ErrorResponse that keeps what the client is told apart from what
+// went wrong. Responses for it, including error templates, only show PublicMessage, while its
+// Error, logged as for any error, includes Internal.
+type DetailedErrorResponse interface {
+	ErrorResponse
+	PublicMessage() string
+	Internal() error
+}
+
+// NewPublicError returns a DetailedErrorResponse with the given status, showing the client only
+// publicMsg. internal, which may be nil, is logged and wrapped, so that errors.Is and errors.As
+// see it.
+func NewPublicError(status int, publicMsg string, internal error) DetailedErrorResponse {
+	return detailedErrorResponse{status: status, public: publicMsg, internal: internal}
+}
+
+type detailedErrorResponse struct {
+	status   int
+	public   string
+	internal error
+}
+
+func (e detailedErrorResponse) Error() string {
+	if e.internal == nil {
+		return e.public
+	}
+	return e.public + ": " + e.internal.Error()
+}
+
+func (e detailedErrorResponse) Status() int {
+	return e.status
+}
+
+func (e detailedErrorResponse) PublicMessage() string {
+	return e.public
+}
+
+func (e detailedErrorResponse) Internal() error {
+	return e.internal
+}
+
+func (e detailedErrorResponse) Unwrap() error {
+	return e.internal
+}
+
+// Is reports whether target is the ErrorResponseStatus of the same status.
+func (e detailedErrorResponse) Is(target error) bool {
+	status, ok := target.(responseStatusError)
+	return ok && int(status) == e.status
+}
+
+// asPublicError returns what the client may be told of err if a DetailedErrorResponse in its
+// chain restricts it.
+func asPublicError(err error) (ErrorResponse, bool) {
+	var detailed DetailedErrorResponse
+	if !errors.As(err, &detailed) || !hasStatus(detailed) {
+		return nil, false
+	}
+	return statusErrorResponse{errors.New(detailed.PublicMessage()), detailed.Status()}, true
+}
+
+// RetryableErrorResponse is an ErrorResponse saying when the client may try again, sent as the
+// Retry-After header of 429 Too Many Requests and 503 Service Unavailable responses.
+type RetryableErrorResponse interface {
+	ErrorResponse
+	RetryAfter() time.Duration
+}
+
+// ErrTooManyRequestsAfter returns a 429 Too Many Requests ErrorResponse telling the client to
+// retry after d. It matches ErrTooManyRequests with errors.Is.
+func ErrTooManyRequestsAfter(d time.Duration) RetryableErrorResponse {
+	return retryErrorResponse{http.StatusTooManyRequests, d}
+}
+
+// ErrServiceUnavailableFor returns a 503 Service Unavailable ErrorResponse telling the client to
+// retry after d.
+func ErrServiceUnavailableFor(d time.Duration) RetryableErrorResponse {
+	return retryErrorResponse{http.StatusServiceUnavailable, d}
+}
+
+type retryErrorResponse struct {
+	status int
+	after  time.Duration
+}
+
+func (e retryErrorResponse) Error() string {
+	return http.StatusText(e.status)
+}
+
+func (e retryErrorResponse) Status() int {
+	return e.status
+}
+
+func (e retryErrorResponse) RetryAfter() time.Duration {
+	return e.after
+}
+
+// Is reports whether target is the ErrorResponseStatus of the same status.
+func (e retryErrorResponse) Is(target error) bool {
+	status, ok := target.(responseStatusError)
+	return ok && int(status) == e.status
+}
+
+// setRetryAfter sets the Retry-After header for a response with the given status to err if it
+// is a 429 or 503 and a RetryableErrorResponse in err's chain gives a positive delay. Delays are
+// rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, statusCode int, err error) {
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable {
+		return
+	}
+	var retryable RetryableErrorResponse
+	if !errors.As(err, &retryable) || !hasStatus(retryable) {
+		return
+	}
+	if after := retryable.RetryAfter(); after > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(after.Seconds()))))
+	}
+}
+
+// FieldError is a problem with one field of a request, such as a form input.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError is an ErrorResponse listing, in the order they were found, the problems with
+// the fields of a request. Error templates get them as ErrorTemplateData.Fields and JSON error
+// bodies as "fields". Handlers that would rather render the form again with the messages can
+// catch it with errors.As.
+type ValidationError struct {
+	// StatusCode is the status to respond with. It defaults to 422 Unprocessable Entity.
+	StatusCode int
+	Fields     []FieldError
+}
+
+// NewValidationError returns an empty ValidationError, for fields to be added to as they are
+// checked.
+func NewValidationError() *ValidationError {
+	return &ValidationError{}
+}
+
+// Add records a problem with field, its message formatted as by fmt.Sprintf, and returns e.
+func (e *ValidationError) Add(field, format string, args ...interface{}) *ValidationError {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	return e
+}
+
+// Messages returns the messages recorded for field, in order.
+func (e *ValidationError) Messages(field string) []string {
+	var messages []string
+	for _, f := range e.Fields {
+		if f.Field == field {
+			messages = append(messages, f.Message)
+		}
+	}
+	return messages
+}
+
+// Err returns e if it has any fields and nil otherwise, so that a handler can return the result
+// of its checks as they are.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return http.StatusText(e.Status())
+	}
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Status() int {
+	if e.StatusCode == 0 {
+		return http.StatusUnprocessableEntity
+	}
+	return e.StatusCode
+}
+
+// Is reports whether target is the ErrorResponseStatus of the same status.
+func (e *ValidationError) Is(target error) bool {
+	status, ok := target.(responseStatusError)
+	return ok && int(status) == e.Status()
+}
+
+// fieldErrors returns the fields of the ValidationError in err's chain, if any.
+func fieldErrors(err error) []FieldError {
+	var validation *ValidationError
+	if !errors.As(err, &validation) || !hasStatus(validation) {
+		return nil
+	}
+	return validation.Fields
+}
+
 // HandleError returns true if there was an error and you should stop.
 func HandleError(w http.ResponseWriter, err error, logger golog.Logger, context ...string) bool {
 	if err == nil {
 		return false
 	}
 
-	statusCode := http.StatusInternalServerError
+	statusCode := errorStatusCode(err)
+	logErrorResponse(GologLogger(logger), statusCode, err)
+	setRetryAfter(w, statusCode, err)
+	shown := err
+	if public, ok := asPublicError(err); ok {
+		shown = public
+	}
+	writeBasicErrorResponse(w, statusCode, shown, context...)
+	return true
+}
 
-	var er ErrorResponse
-	if errors.As(err, &er) {
-		statusCode = er.Status()
+// errorStatusCode returns the status of the ErrorResponse in err's chain, defaulting to 500.
+func errorStatusCode(err error) int {
+	return asErrorResponse(err).Status()
+}
+
+func logErrorResponse(logger Logger, statusCode int, err error) {
+	level := LevelInfo
+	if statusCode >= 500 {
+		level = LevelError
 	}
+	logErrorResponseAt(logger, level, statusCode, err)
+}
 
-	// Log internal errors.
+// logErrorResponseAt logs err, answered with the given status, at level.
+func logErrorResponseAt(logger Logger, level Level, statusCode int, err error) {
 	if statusCode >= 500 {
-		logger.Errorf("Error during http response: %s", err)
+		logf(logger, level, "Error during http response: %s", err)
 	} else {
-		logger.Infof("Error with non-5xx status during http response: %s", err)
+		logf(logger, level, "Error with non-5xx status during http response: %s", err)
 	}
+}
 
+// DefaultLogLevelFor is the level TemplateMiddleware logs errors at unless LogLevelFor says
+// otherwise: 401 and 404, which crawlers and expired sessions cause all the time, at info, other
+// 4xx statuses at warn and 5xx ones at error. Errors from the client going away, context.Canceled,
+// are debug whatever their status.
+func DefaultLogLevelFor(status int, err error) Level {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return LevelDebug
+	case status >= 500:
+		return LevelError
+	case status == http.StatusNotFound || status == http.StatusUnauthorized:
+		return LevelInfo
+	case status >= 400:
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// errorRepresentationHeaders describe a response body and are dropped from error responses, in
+// case they were set for the body that could not be sent.
+var errorRepresentationHeaders = []string{"Content-Disposition", "Content-Length", "ETag", "Last-Modified"}
+
+// setErrorHeaders sets the Content-Type of an error response, which must be done before its
+// status is written, and drops any errorRepresentationHeaders.
+func setErrorHeaders(w http.ResponseWriter, contentType string) {
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	for _, name := range errorRepresentationHeaders {
+		header.Del(name)
+	}
+}
+
+// writeBasicErrorResponse writes the error as plain text, preceded by any context lines.
+func writeBasicErrorResponse(w http.ResponseWriter, statusCode int, err error, context ...string) {
+	setErrorHeaders(w, "text/plain; charset=utf-8")
 	w.WriteHeader(statusCode)
 
 	var b bytes.Buffer
@@ -59,10 +343,129 @@ func HandleError(w http.ResponseWriter, err error, logger golog.Logger, context
 		b.WriteString(x)
 		b.WriteByte('\n')
 	}
-	b.WriteString(err.Error())
+	b.WriteString(errorMessage(err))
 	b.WriteByte('\n')
 
 	_, err = b.WriteTo(w)
 	utils.UncheckedError(err)
+}
+
+// statusErrorResponse gives an error that is not already an ErrorResponse a status.
+type statusErrorResponse struct {
+	error
+	status int
+}
+
+func (e statusErrorResponse) Status() int {
+	return e.status
+}
+
+func (e statusErrorResponse) Unwrap() error {
+	return e.error
+}
+
+// Is reports whether target is the ErrorResponseStatus of the same status.
+func (e statusErrorResponse) Is(target error) bool {
+	status, ok := target.(responseStatusError)
+	return ok && int(status) == e.status
+}
+
+// asErrorResponse returns the ErrorResponse in err's chain, as found by findErrorResponse, or
+// wraps err in one with a 500 status.
+func asErrorResponse(err error) ErrorResponse {
+	if er, ok := findErrorResponse(err); ok {
+		return er
+	}
+	return statusErrorResponse{err, http.StatusInternalServerError}
+}
+
+// findErrorResponse returns the ErrorResponse deciding the status of err: the outermost one in
+// its chain, or, where errors were combined as by errors.Join or multierr, the one with the
+// highest status among those of the combined errors, the first of them on a tie. Errors that
+// can only be searched with an As method are searched with it, and failing all that errors.As
+// is asked. An ErrorResponse that panics when asked for its status, such as a nil pointer, is
+// ignored.
+func findErrorResponse(err error) (ErrorResponse, bool) {
+	if er, ok := walkErrorResponse(err); ok {
+		return er, true
+	}
+	var er ErrorResponse
+	if errors.As(err, &er) && hasStatus(er) {
+		return er, true
+	}
+	return nil, false
+}
+
+// walkErrorResponse is findErrorResponse without the errors.As fallback.
+func walkErrorResponse(err error) (ErrorResponse, bool) {
+	for err != nil {
+		if er, ok := err.(ErrorResponse); ok && hasStatus(er) {
+			return er, true
+		}
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			err = wrapped.Unwrap()
+		case interface{ Unwrap() []error }:
+			return highestErrorResponse(wrapped.Unwrap())
+		case interface{ Errors() []error }:
+			// go.uber.org/multierr, which does not implement Unwrap.
+			return highestErrorResponse(wrapped.Errors())
+		case interface{ As(interface{}) bool }:
+			var er ErrorResponse
+			if wrapped.As(&er) && hasStatus(er) {
+				return er, true
+			}
+			return nil, false
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// highestErrorResponse returns the ErrorResponse of errs with the highest status, the first of
+// them on a tie.
+func highestErrorResponse(errs []error) (ErrorResponse, bool) {
+	var found ErrorResponse
+	for _, member := range errs {
+		if er, ok := walkErrorResponse(member); ok && (found == nil || er.Status() > found.Status()) {
+			found = er
+		}
+	}
+	return found, found != nil
+}
+
+// StatusFromError returns the status an error handled by HandleError or TemplateMiddleware is
+// answered with, if an ErrorResponse in its chain gives one. Wrapped errors are searched as by
+// errors.As; of errors joined together, as by errors.Join or multierr, the highest status wins.
+func StatusFromError(err error) (int, bool) {
+	er, ok := findErrorResponse(err)
+	if !ok {
+		return 0, false
+	}
+	return er.Status(), true
+}
+
+// IsStatus reports whether an ErrorResponse in err's chain gives it the given status, as
+// StatusFromError finds it.
+func IsStatus(err error, status int) bool {
+	got, ok := StatusFromError(err)
+	return ok && got == status
+}
+
+// hasStatus reports whether er's Status method returns rather than panicking.
+func hasStatus(er ErrorResponse) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	er.Status()
 	return true
 }
+
+// errorMessage returns err's message for a response. Unlike calling err.Error, it never panics:
+// a nil error, or a nil pointer whose Error method panics, is "<nil>", as with fmt.
+func errorMessage(err error) string {
+	return fmt.Sprint(err)
+}
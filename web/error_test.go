@@ -0,0 +1,401 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.uber.org/multierr"
+	"go.viam.com/test"
+)
+
+func TestErrorResponses(t *testing.T) {
+	for _, tc := range []struct {
+		err    ErrorResponse
+		status int
+	}{
+		{ErrBadRequest, http.StatusBadRequest},
+		{ErrUnauthorized, http.StatusUnauthorized},
+		{ErrForbidden, http.StatusForbidden},
+		{ErrNotFound, http.StatusNotFound},
+		{ErrConflict, http.StatusConflict},
+		{ErrTooManyRequests, http.StatusTooManyRequests},
+		{ErrInternal, http.StatusInternalServerError},
+	} {
+		test.That(t, tc.err.Status(), test.ShouldEqual, tc.status)
+		test.That(t, tc.err.Error(), test.ShouldEqual, http.StatusText(tc.status))
+		test.That(t, errors.Is(fmt.Errorf("context: %w", tc.err), tc.err), test.ShouldBeTrue)
+	}
+
+	t.Run("NewErrorResponse", func(t *testing.T) {
+		err := NewErrorResponse(http.StatusNotFound, "no user %d", 42)
+		test.That(t, err.Status(), test.ShouldEqual, http.StatusNotFound)
+		test.That(t, err.Error(), test.ShouldEqual, "no user 42")
+		test.That(t, errors.Is(err, ErrNotFound), test.ShouldBeTrue)
+		test.That(t, errors.Is(err, ErrConflict), test.ShouldBeFalse)
+		test.That(t, errors.Is(err, ErrorResponseStatus(http.StatusNotFound)), test.ShouldBeTrue)
+		test.That(t, errorStatusCode(err), test.ShouldEqual, http.StatusNotFound)
+	})
+
+	t.Run("wrapping", func(t *testing.T) {
+		err := NewErrorResponse(http.StatusConflict, "saving %q: %w", "doc", fs.ErrExist)
+		test.That(t, err.Error(), test.ShouldEqual, `saving "doc": file already exists`)
+		test.That(t, errors.Is(err, fs.ErrExist), test.ShouldBeTrue)
+		test.That(t, errors.Is(err, ErrConflict), test.ShouldBeTrue)
+
+		wrapped := fmt.Errorf("handler: %w", err)
+		var er ErrorResponse
+		test.That(t, errors.As(wrapped, &er), test.ShouldBeTrue)
+		test.That(t, er.Status(), test.ShouldEqual, http.StatusConflict)
+		test.That(t, errors.Is(wrapped, ErrConflict), test.ShouldBeTrue)
+		test.That(t, errors.Is(wrapped, fs.ErrExist), test.ShouldBeTrue)
+		test.That(t, errorStatusCode(wrapped), test.ShouldEqual, http.StatusConflict)
+	})
+
+	t.Run("middleware errors", func(t *testing.T) {
+		test.That(t, errors.Is(errCSRFTokenInvalid, ErrForbidden), test.ShouldBeTrue)
+	})
+}
+
+// nilPointerError is an ErrorResponse whose methods panic on a nil pointer.
+type nilPointerError struct {
+	status int
+}
+
+func (e *nilPointerError) Error() string {
+	return fmt.Sprintf("status %d", e.status)
+}
+
+func (e *nilPointerError) Status() int {
+	return e.status
+}
+
+func TestBasicErrorResponseFallback(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(handlerErr error) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), golog.NewTestLogger(t))
+		rr := httptest.NewRecorder()
+		test.That(t, func() { mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil)) }, test.ShouldNotPanic)
+		return rr
+	}
+
+	t.Run("plain error", func(t *testing.T) {
+		rr := serve(errors.New("plain failure"))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/plain; charset=utf-8")
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "plain failure\nerror ID: ")
+	})
+
+	t.Run("ErrorResponse", func(t *testing.T) {
+		rr := serve(fmt.Errorf("loading: %w", NewErrorResponse(http.StatusNotFound, "no page %q", "x")))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "loading: no page \"x\"\n")
+	})
+
+	t.Run("nil pointer ErrorResponse", func(t *testing.T) {
+		var err *nilPointerError
+		rr := serve(err)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "<nil>\nerror ID: ")
+
+		rr = serve(&nilPointerError{http.StatusConflict})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusConflict)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "status 409\n")
+	})
+
+	t.Run("HandleError", func(t *testing.T) {
+		var err *nilPointerError
+		rr := httptest.NewRecorder()
+		test.That(t, HandleError(rr, err, golog.NewTestLogger(t), "context"), test.ShouldBeTrue)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "context\n<nil>\n")
+	})
+}
+
+func TestPublicErrors(t *testing.T) {
+	internal := errors.New(`mail: no angle-addr in "bob@"`)
+	publicErr := NewPublicError(http.StatusBadRequest, "Email address is invalid", internal)
+
+	test.That(t, publicErr.Status(), test.ShouldEqual, http.StatusBadRequest)
+	test.That(t, publicErr.PublicMessage(), test.ShouldEqual, "Email address is invalid")
+	test.That(t, publicErr.Internal(), test.ShouldEqual, internal)
+	test.That(t, publicErr.Error(), test.ShouldEqual, `Email address is invalid: mail: no angle-addr in "bob@"`)
+	test.That(t, errors.Is(publicErr, internal), test.ShouldBeTrue)
+	test.That(t, errors.Is(publicErr, ErrBadRequest), test.ShouldBeTrue)
+	test.That(t, NewPublicError(http.StatusNotFound, "gone", nil).Error(), test.ShouldEqual, "gone")
+
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"400.html":  "problem: {{ .Error }} ({{ .Status }})",
+	})
+	serve := func(handlerErr error, configure func(*TemplateMiddleware), accept string) (*httptest.ResponseRecorder, string) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), logger)
+		if configure != nil {
+			configure(mw)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		test.That(t, logs.All(), test.ShouldHaveLength, 1)
+		return rr, logs.All()[0].Message
+	}
+	checkHidden := func(t *testing.T, rr *httptest.ResponseRecorder, logged string) {
+		t.Helper()
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusBadRequest)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "Email address is invalid")
+		test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "angle-addr")
+		test.That(t, logged, test.ShouldContainSubstring, "angle-addr")
+	}
+
+	t.Run("error template", func(t *testing.T) {
+		rr, logged := serve(fmt.Errorf("signing up: %w", publicErr), nil, "")
+		checkHidden(t, rr, logged)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "problem: Email address is invalid (400)")
+	})
+
+	t.Run("basic", func(t *testing.T) {
+		rr, logged := serve(publicErr, func(mw *TemplateMiddleware) {
+			mw.Templates = mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+		}, "")
+		checkHidden(t, rr, logged)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "Email address is invalid\n")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rr, logged := serve(publicErr, func(mw *TemplateMiddleware) {
+			mw.NegotiateJSON = true
+		}, "application/json")
+		checkHidden(t, rr, logged)
+		test.That(t, rr.Body.String(), test.ShouldEqual, `{"err":"Email address is invalid","message":"Email address is invalid","status":400}`)
+	})
+
+	t.Run("HandleError", func(t *testing.T) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		rr := httptest.NewRecorder()
+		test.That(t, HandleError(rr, publicErr, logger), test.ShouldBeTrue)
+		checkHidden(t, rr, logs.All()[0].Message)
+	})
+
+	t.Run("other ErrorResponses", func(t *testing.T) {
+		rr, _ := serve(NewErrorResponse(http.StatusBadRequest, "bad %s", "input"), nil, "")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "problem: bad input (400)")
+	})
+}
+
+type retryAfterElse struct {
+	statusErrorResponse
+}
+
+func (retryAfterElse) RetryAfter() time.Duration {
+	return time.Minute
+}
+
+func TestRetryAfter(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page", "503.html": "try later"})
+	serve := func(handlerErr error) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), golog.NewTestLogger(t))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	limited := ErrTooManyRequestsAfter(1500 * time.Millisecond)
+	test.That(t, limited.Status(), test.ShouldEqual, http.StatusTooManyRequests)
+	test.That(t, limited.RetryAfter(), test.ShouldEqual, 1500*time.Millisecond)
+	test.That(t, errors.Is(limited, ErrTooManyRequests), test.ShouldBeTrue)
+
+	rr := serve(limited)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusTooManyRequests)
+	test.That(t, rr.Header().Get("Retry-After"), test.ShouldEqual, "2")
+
+	rr = serve(fmt.Errorf("maintenance: %w", ErrServiceUnavailableFor(2*time.Minute)))
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusServiceUnavailable)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "try later")
+	test.That(t, rr.Header().Get("Retry-After"), test.ShouldEqual, "120")
+
+	rr = serve(ErrServiceUnavailableFor(0))
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusServiceUnavailable)
+	test.That(t, rr.Header().Values("Retry-After"), test.ShouldBeEmpty)
+
+	// only 429 and 503 responses carry the header.
+	rr = serve(retryAfterElse{statusErrorResponse{errors.New("conflict"), http.StatusConflict}})
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusConflict)
+	test.That(t, rr.Header().Values("Retry-After"), test.ShouldBeEmpty)
+
+	rr = serve(ErrTooManyRequests)
+	test.That(t, rr.Header().Values("Retry-After"), test.ShouldBeEmpty)
+
+	rr = httptest.NewRecorder()
+	test.That(t, HandleError(rr, limited, golog.NewTestLogger(t)), test.ShouldBeTrue)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusTooManyRequests)
+	test.That(t, rr.Header().Get("Retry-After"), test.ShouldEqual, "2")
+}
+
+// asOnlyError can only be searched with its As method.
+type asOnlyError struct {
+	er ErrorResponse
+}
+
+func (e asOnlyError) Error() string { return "as only: " + e.er.Error() }
+
+func (e asOnlyError) As(target interface{}) bool {
+	er, ok := target.(*ErrorResponse)
+	if ok {
+		*er = e.er
+	}
+	return ok
+}
+
+func TestStatusFromError(t *testing.T) {
+	single := fmt.Errorf("loading user %d: %w", 7, ErrNotFound)
+	double := fmt.Errorf("handler: %w", single)
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		ok     bool
+	}{
+		{"nil", nil, 0, false},
+		{"plain", errors.New("boom"), 0, false},
+		{"direct", ErrConflict, http.StatusConflict, true},
+		{"single wrap", single, http.StatusNotFound, true},
+		{"double wrap", double, http.StatusNotFound, true},
+		{"outermost wins", NewErrorResponse(http.StatusBadGateway, "upstream: %w", ErrNotFound), http.StatusBadGateway, true},
+		{"join highest", errors.Join(errors.New("a"), ErrNotFound, double, fmt.Errorf("db: %w", ErrInternal)),
+			http.StatusInternalServerError, true},
+		{"join tie", errors.Join(NewErrorResponse(http.StatusBadRequest, "first"), NewErrorResponse(http.StatusBadRequest, "second")),
+			http.StatusBadRequest, true},
+		{"join without", errors.Join(errors.New("a"), errors.New("b")), 0, false},
+		{"multierr", multierr.Combine(ErrNotFound, ErrBadRequest), http.StatusNotFound, true},
+		{"multierr highest", multierr.Combine(errors.New("a"), ErrBadRequest, fmt.Errorf("db: %w", ErrConflict)),
+			http.StatusConflict, true},
+		{"wrapped multierr", fmt.Errorf("saving: %w", multierr.Combine(errors.New("a"), ErrForbidden)),
+			http.StatusForbidden, true},
+		{"multierr without", multierr.Combine(errors.New("a"), errors.New("b")), 0, false},
+		{"As only", asOnlyError{ErrConflict}, http.StatusConflict, true},
+		{"wrapped join", fmt.Errorf("saving: %w", errors.Join(errors.New("a"), ErrConflict)), http.StatusConflict, true},
+		{"multiple %w", fmt.Errorf("%w and %w", ErrForbidden, ErrBadRequest), http.StatusForbidden, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, ok := StatusFromError(tc.err)
+			test.That(t, ok, test.ShouldEqual, tc.ok)
+			test.That(t, status, test.ShouldEqual, tc.status)
+			test.That(t, isErrorResponse(tc.err), test.ShouldEqual, tc.ok)
+			if tc.ok {
+				test.That(t, IsStatus(tc.err, tc.status), test.ShouldBeTrue)
+				test.That(t, errorStatusCode(tc.err), test.ShouldEqual, tc.status)
+			} else {
+				test.That(t, errorStatusCode(tc.err), test.ShouldEqual, http.StatusInternalServerError)
+			}
+			test.That(t, IsStatus(tc.err, http.StatusTeapot), test.ShouldBeFalse)
+		})
+	}
+
+	er := asErrorResponse(errors.Join(NewErrorResponse(http.StatusBadRequest, "first"), NewErrorResponse(http.StatusBadRequest, "second")))
+	test.That(t, er.Error(), test.ShouldEqual, "first")
+
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page", "409.html": "conflict"})
+	mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil,
+		errors.Join(errors.New("a"), fmt.Errorf("saving: %w", ErrConflict), ErrNotFound)), golog.NewTestLogger(t))
+	rr := httptest.NewRecorder()
+	mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusConflict)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "conflict")
+}
+
+func TestValidationErrors(t *testing.T) {
+	validation := NewValidationError()
+	test.That(t, validation.Err(), test.ShouldBeNil)
+	validation.Add("email", "required").Add("age", "must be positive, not %d", -3).Add("email", "must contain @")
+	test.That(t, validation.Err(), test.ShouldEqual, validation)
+	test.That(t, validation.Error(), test.ShouldEqual,
+		"email: required; age: must be positive, not -3; email: must contain @")
+	test.That(t, validation.Status(), test.ShouldEqual, http.StatusUnprocessableEntity)
+	test.That(t, validation.Messages("email"), test.ShouldResemble, []string{"required", "must contain @"})
+	test.That(t, validation.Messages("name"), test.ShouldBeNil)
+	test.That(t, errors.Is(validation, ErrorResponseStatus(http.StatusUnprocessableEntity)), test.ShouldBeTrue)
+	test.That(t, errorStatusCode(fmt.Errorf("signing up: %w", validation)), test.ShouldEqual, http.StatusUnprocessableEntity)
+
+	badRequest := &ValidationError{StatusCode: http.StatusBadRequest}
+	badRequest.Add("q", "too long")
+	test.That(t, errors.Is(badRequest, ErrBadRequest), test.ShouldBeTrue)
+	test.That(t, errorStatusCode(badRequest), test.ShouldEqual, http.StatusBadRequest)
+
+	var nilValidation *ValidationError
+	test.That(t, errorStatusCode(nilValidation), test.ShouldEqual, http.StatusInternalServerError)
+
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"422.html":  `{{ .Status }}:{{ range .Fields }} [{{ .Field }}: {{ .Message }}]{{ end }}`,
+		"form.html": `email={{ .Email }}{{ range .Errors.Messages "email" }} ({{ . }}){{ end }}`,
+	})
+	serve := func(h TemplateHandler, accept string) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		req := httptest.NewRequest(http.MethodPost, "/signup", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("HTML", func(t *testing.T) {
+		rr := serve(staticHandler("page.html", nil, fmt.Errorf("signing up: %w", validation)), "text/html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusUnprocessableEntity)
+		test.That(t, rr.Body.String(), test.ShouldEqual,
+			"422: [email: required] [age: must be positive, not -3] [email: must contain @]")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rr := serve(staticHandler("page.html", nil, validation), "application/json")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusUnprocessableEntity)
+		var body struct {
+			Status int          `json:"status"`
+			Fields []FieldError `json:"fields"`
+		}
+		test.That(t, json.Unmarshal(rr.Body.Bytes(), &body), test.ShouldBeNil)
+		test.That(t, body.Status, test.ShouldEqual, http.StatusUnprocessableEntity)
+		test.That(t, body.Fields, test.ShouldResemble, validation.Fields)
+
+		rr = serve(staticHandler("page.html", nil, ErrBadRequest), "application/json")
+		test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "fields")
+	})
+
+	t.Run("caught by the handler", func(t *testing.T) {
+		type form struct {
+			Email  string
+			Errors *ValidationError
+		}
+		validate := func(f form) error {
+			v := NewValidationError()
+			if !strings.Contains(f.Email, "@") {
+				v.Add("email", "must contain @")
+			}
+			return v.Err()
+		}
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			f := form{Email: "nobody"}
+			var v *ValidationError
+			if err := validate(f); errors.As(err, &v) {
+				f.Errors = v
+				return NamedTemplate("form.html").WithStatus(v.Status()), f, nil
+			} else if err != nil {
+				return nil, nil, err
+			}
+			return NamedTemplate("page.html"), nil, nil
+		})
+		rr := serve(h, "text/html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusUnprocessableEntity)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "email=nobody (must contain @)")
+	})
+}
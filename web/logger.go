@@ -0,0 +1,168 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/edaniels/golog"
+)
+
+// Logger is the logging TemplateMiddleware needs. The plain methods take a message followed by
+// alternating keys and values, as slog does; the formatted ones take a fmt format. GologLogger
+// and SlogLogger adapt the common loggers to it.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Level is the severity a message is logged at.
+type Level int
+
+// The levels of Logger's methods.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// logf logs the formatted message at level.
+func logf(logger Logger, level Level, format string, args ...interface{}) {
+	switch level {
+	case LevelDebug:
+		logger.Debugf(format, args...)
+	case LevelInfo:
+		logger.Infof(format, args...)
+	case LevelWarn:
+		logger.Warnf(format, args...)
+	default:
+		logger.Errorf(format, args...)
+	}
+}
+
+// GologLogger adapts a golog logger to Logger. A nil logger logs nothing.
+func GologLogger(logger golog.Logger) Logger {
+	if logger == nil {
+		return nopLogger{}
+	}
+	return gologLogger{logger}
+}
+
+type gologLogger struct {
+	logger golog.Logger
+}
+
+func (l gologLogger) Debug(msg string, kvs ...interface{}) { l.logger.Debugw(msg, kvs...) }
+func (l gologLogger) Info(msg string, kvs ...interface{})  { l.logger.Infow(msg, kvs...) }
+func (l gologLogger) Warn(msg string, kvs ...interface{})  { l.logger.Warnw(msg, kvs...) }
+func (l gologLogger) Error(msg string, kvs ...interface{}) { l.logger.Errorw(msg, kvs...) }
+
+func (l gologLogger) Debugf(format string, args ...interface{}) { l.logger.Debugf(format, args...) }
+func (l gologLogger) Infof(format string, args ...interface{})  { l.logger.Infof(format, args...) }
+func (l gologLogger) Warnf(format string, args ...interface{})  { l.logger.Warnf(format, args...) }
+func (l gologLogger) Errorf(format string, args ...interface{}) { l.logger.Errorf(format, args...) }
+
+func (l gologLogger) with(kvs ...interface{}) Logger {
+	return gologLogger{l.logger.With(kvs...)}
+}
+
+// SlogLogger adapts a *slog.Logger to Logger. A nil logger logs nothing.
+func SlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		return nopLogger{}
+	}
+	return slogLogger{logger}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) Debug(msg string, kvs ...interface{}) { l.logger.Debug(msg, kvs...) }
+func (l slogLogger) Info(msg string, kvs ...interface{})  { l.logger.Info(msg, kvs...) }
+func (l slogLogger) Warn(msg string, kvs ...interface{})  { l.logger.Warn(msg, kvs...) }
+func (l slogLogger) Error(msg string, kvs ...interface{}) { l.logger.Error(msg, kvs...) }
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warn(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) with(kvs ...interface{}) Logger {
+	return slogLogger{l.logger.With(kvs...)}
+}
+
+// nopLogger discards everything; it is what the middleware logs to when given no logger.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// fieldsLogger adds fields to every message of a Logger that cannot do so itself. Formatted
+// messages carry the fields too, after the formatted message.
+type fieldsLogger struct {
+	logger Logger
+	fields []interface{}
+}
+
+func (l fieldsLogger) kvs(kvs []interface{}) []interface{} {
+	return append(append([]interface{}{}, l.fields...), kvs...)
+}
+
+func (l fieldsLogger) Debug(msg string, kvs ...interface{}) { l.logger.Debug(msg, l.kvs(kvs)...) }
+func (l fieldsLogger) Info(msg string, kvs ...interface{})  { l.logger.Info(msg, l.kvs(kvs)...) }
+func (l fieldsLogger) Warn(msg string, kvs ...interface{})  { l.logger.Warn(msg, l.kvs(kvs)...) }
+func (l fieldsLogger) Error(msg string, kvs ...interface{}) { l.logger.Error(msg, l.kvs(kvs)...) }
+
+func (l fieldsLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debug(fmt.Sprintf(format, args...), l.fields...)
+}
+
+func (l fieldsLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...), l.fields...)
+}
+
+func (l fieldsLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warn(fmt.Sprintf(format, args...), l.fields...)
+}
+
+func (l fieldsLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(fmt.Sprintf(format, args...), l.fields...)
+}
+
+// loggerWith returns logger with the given fields added to every message.
+func loggerWith(logger Logger, kvs ...interface{}) Logger {
+	switch l := logger.(type) {
+	case nopLogger:
+		return l
+	case interface{ with(...interface{}) Logger }:
+		return l.with(kvs...)
+	default:
+		return fieldsLogger{logger, kvs}
+	}
+}
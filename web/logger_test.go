@@ -0,0 +1,120 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) record(level, msg string, kvs []interface{}) {
+	l.messages = append(l.messages, strings.TrimSpace(fmt.Sprintln(append([]interface{}{level, msg}, kvs...)...)))
+}
+
+func (l *recordingLogger) Debug(msg string, kvs ...interface{}) { l.record("debug", msg, kvs) }
+func (l *recordingLogger) Info(msg string, kvs ...interface{})  { l.record("info", msg, kvs) }
+func (l *recordingLogger) Warn(msg string, kvs ...interface{})  { l.record("warn", msg, kvs) }
+func (l *recordingLogger) Error(msg string, kvs ...interface{}) { l.record("error", msg, kvs) }
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.record("debug", fmt.Sprintf(format, args...), nil)
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.record("info", fmt.Sprintf(format, args...), nil)
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.record("warn", fmt.Sprintf(format, args...), nil)
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.record("error", fmt.Sprintf(format, args...), nil)
+}
+
+func TestTemplateMiddlewareLogger(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	failing := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		return nil, nil, errors.New("boom")
+	})
+	panicking := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		panic("oops")
+	})
+	serve := func(mw *TemplateMiddleware) *httptest.ResponseRecorder {
+		mw.RequestIDs = true
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "the-id")
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("golog", func(t *testing.T) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		serve(&TemplateMiddleware{Templates: tm, Handler: failing, Log: GologLogger(logger)})
+		test.That(t, logs.All(), test.ShouldHaveLength, 1)
+		test.That(t, logs.All()[0].Message, test.ShouldEqual, "Error during http response: boom")
+		test.That(t, logs.All()[0].ContextMap()["request_id"], test.ShouldEqual, "the-id")
+	})
+
+	t.Run("golog field", func(t *testing.T) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		serve(NewTemplateMiddleware(tm, failing, logger))
+		test.That(t, logs.All(), test.ShouldHaveLength, 1)
+		test.That(t, logs.All()[0].ContextMap()["request_id"], test.ShouldEqual, "the-id")
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		serve(&TemplateMiddleware{Templates: tm, Handler: panicking, Log: SlogLogger(logger)})
+		var entry map[string]interface{}
+		test.That(t, json.NewDecoder(&buf).Decode(&entry), test.ShouldBeNil)
+		test.That(t, entry["level"], test.ShouldEqual, "ERROR")
+		test.That(t, entry["msg"], test.ShouldEqual, "panic while serving template")
+		test.That(t, entry["panic"], test.ShouldEqual, "oops")
+		test.That(t, entry["request_id"], test.ShouldEqual, "the-id")
+
+		buf.Reset()
+		SlogLogger(logger).Warnf("%d things", 3)
+		test.That(t, buf.String(), test.ShouldContainSubstring, `"msg":"3 things"`)
+	})
+
+	t.Run("other loggers get the request ID", func(t *testing.T) {
+		logger := &recordingLogger{}
+		serve(&TemplateMiddleware{Templates: tm, Handler: failing, Log: logger})
+		test.That(t, logger.messages, test.ShouldResemble, []string{
+			"error Error during http response: boom request_id the-id error_id the-id",
+		})
+	})
+
+	t.Run("Log takes precedence", func(t *testing.T) {
+		gologger, logs := golog.NewObservedTestLogger(t)
+		logger := &recordingLogger{}
+		serve(&TemplateMiddleware{Templates: tm, Handler: failing, Logger: gologger, Log: logger})
+		test.That(t, logs.All(), test.ShouldBeEmpty)
+		test.That(t, logger.messages, test.ShouldHaveLength, 1)
+	})
+
+	t.Run("no logger", func(t *testing.T) {
+		rr := serve(&TemplateMiddleware{Templates: tm, Handler: failing})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		rr = serve(&TemplateMiddleware{Templates: tm, Handler: panicking})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+
+		test.That(t, GologLogger(nil), test.ShouldResemble, Logger(nopLogger{}))
+		test.That(t, SlogLogger(nil), test.ShouldResemble, Logger(nopLogger{}))
+	})
+}
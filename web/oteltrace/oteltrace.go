@@ -0,0 +1,52 @@
+// Package oteltrace records web.TemplateMiddleware spans with OpenTelemetry. It is a module of its
+// own so that go.viam.com/utils does not depend on OpenTelemetry.
+package oteltrace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.viam.com/utils/web"
+)
+
+// Tracer returns a web.TemplateTracer starting spans with tracer, such as one from
+// otel.Tracer.
+func Tracer(tracer trace.Tracer) web.TemplateTracer {
+	return otelTracer{tracer}
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t otelTracer) Start(ctx context.Context, name string) (context.Context, web.TemplateSpan) {
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, otelSpan{span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	}
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
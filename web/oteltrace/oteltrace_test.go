@@ -0,0 +1,58 @@
+package oteltrace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/edaniels/golog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.viam.com/test"
+
+	"go.viam.com/utils/web"
+)
+
+func TestTracer(t *testing.T) {
+	tm, err := web.NewTemplateManagerFSys(fstest.MapFS{"page.html": {Data: []byte("page")}}, ".")
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(name string) []sdktrace.ReadOnlySpan {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		h := web.TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*web.Template, interface{}, error) {
+			return web.NamedTemplate(name), nil, nil
+		})
+		mw := web.NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.Tracer = Tracer(provider.Tracer("web"))
+
+		ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		request.End()
+		spans := recorder.Ended()
+		test.That(t, spans, test.ShouldHaveLength, 3)
+		for _, span := range spans[:2] {
+			test.That(t, span.Parent().SpanID(), test.ShouldEqual, request.SpanContext().SpanID())
+		}
+		return spans[:2]
+	}
+
+	spans := serve("page.html")
+	test.That(t, spans[0].Name(), test.ShouldEqual, web.TemplateHandlerSpan)
+	test.That(t, spans[1].Name(), test.ShouldEqual, web.TemplateRenderSpan)
+	test.That(t, spans[1].Attributes(), test.ShouldResemble, []attribute.KeyValue{
+		attribute.String("template", "page.html"),
+		attribute.Int("http.status_code", http.StatusOK),
+	})
+	test.That(t, spans[1].Status().Code, test.ShouldEqual, codes.Unset)
+
+	spans = serve("missing.html")
+	test.That(t, spans[0].Status().Code, test.ShouldEqual, codes.Unset)
+	test.That(t, spans[1].Status().Code, test.ShouldEqual, codes.Error)
+	test.That(t, spans[1].Status().Description, test.ShouldContainSubstring, "missing.html")
+	test.That(t, spans[1].Events(), test.ShouldHaveLength, 1)
+	test.That(t, spans[1].Attributes(), test.ShouldContain, attribute.Int("http.status_code", http.StatusInternalServerError))
+}
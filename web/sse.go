@@ -0,0 +1,134 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// DefaultSSEHeartbeat is how often SSEHandler sends a comment to keep idle connections open.
+const DefaultSSEHeartbeat = 15 * time.Second
+
+// SSEOption configures an SSEHandler.
+type SSEOption interface {
+	apply(*sseOptions)
+}
+
+type sseOptions struct {
+	heartbeat time.Duration
+}
+
+type funcSSEOption struct {
+	f func(*sseOptions)
+}
+
+func (fso *funcSSEOption) apply(o *sseOptions) {
+	fso.f(o)
+}
+
+// WithSSEHeartbeat returns an SSEOption which sends a heartbeat comment every interval instead
+// of every DefaultSSEHeartbeat. A non-positive interval sends none.
+func WithSSEHeartbeat(interval time.Duration) SSEOption {
+	return &funcSSEOption{func(o *sseOptions) {
+		o.heartbeat = interval
+	}}
+}
+
+// SSEHandler returns an http.Handler streaming Server-Sent Events produced by stream. stream
+// runs for as long as the client stays connected and sends each event with send, which flushes
+// it to the client and fails once the client goes away; ctx is canceled then too. An empty event
+// name sends an unnamed "message" event. Mount it with TemplateRouter.HandleSSE to exempt it
+// from TemplateMiddleware's timeout.
+func SSEHandler(stream func(ctx context.Context, send func(event, data string) error) error, opts ...SSEOption) http.Handler {
+	o := sseOptions{heartbeat: DefaultSSEHeartbeat}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		s := &sseStream{rc: http.NewResponseController(w), w: w, cancel: cancel}
+		if err := s.write(": connected\n\n"); err != nil {
+			return
+		}
+
+		var heartbeats sync.WaitGroup
+		if o.heartbeat > 0 {
+			heartbeats.Add(1)
+			go func() {
+				defer heartbeats.Done()
+				ticker := time.NewTicker(o.heartbeat)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if s.write(": heartbeat\n\n") != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+
+		err := stream(ctx, func(event, data string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return s.write(formatSSE(event, data))
+		})
+		cancel()
+		heartbeats.Wait()
+		if err != nil && r.Context().Err() == nil {
+			// Headers are long gone, so all that is left is to tell the client.
+			utils.UncheckedError(s.write(formatSSE("error", err.Error())))
+		}
+	})
+}
+
+// sseStream serializes writes to an event stream, from the stream and its heartbeats.
+type sseStream struct {
+	mu     sync.Mutex
+	rc     *http.ResponseController
+	w      http.ResponseWriter
+	cancel context.CancelFunc
+}
+
+// write sends s and flushes it, canceling the stream if the client is gone.
+func (s *sseStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprint(s.w, msg); err != nil {
+		s.cancel()
+		return err
+	}
+	if err := s.rc.Flush(); err != nil {
+		s.cancel()
+		return err
+	}
+	return nil
+}
+
+// formatSSE formats an event, splitting multi-line data across data fields.
+func formatSSE(event, data string) string {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
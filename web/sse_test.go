@@ -0,0 +1,151 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+// lockedRecorder is a flushable recorder that is safe to read while a handler writes to it.
+type lockedRecorder struct {
+	mu sync.Mutex
+	rr *httptest.ResponseRecorder
+}
+
+func newLockedRecorder() *lockedRecorder {
+	return &lockedRecorder{rr: httptest.NewRecorder()}
+}
+
+func (w *lockedRecorder) Header() http.Header {
+	return w.rr.Header()
+}
+
+func (w *lockedRecorder) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rr.WriteHeader(code)
+}
+
+func (w *lockedRecorder) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rr.Write(b)
+}
+
+func (w *lockedRecorder) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rr.Flush()
+}
+
+func (w *lockedRecorder) body() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rr.Body.String()
+}
+
+func TestSSEHandler(t *testing.T) {
+	t.Run("events", func(t *testing.T) {
+		h := SSEHandler(func(ctx context.Context, send func(event, data string) error) error {
+			if err := send("", "hello"); err != nil {
+				return err
+			}
+			return send("update", "line one\nline two")
+		})
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/events", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/event-stream")
+		test.That(t, rr.Header().Get("Cache-Control"), test.ShouldEqual, "no-cache")
+		test.That(t, rr.Flushed, test.ShouldBeTrue)
+		test.That(t, rr.Body.String(), test.ShouldEqual,
+			": connected\n\ndata: hello\n\nevent: update\ndata: line one\ndata: line two\n\n")
+	})
+
+	t.Run("heartbeats", func(t *testing.T) {
+		h := SSEHandler(func(ctx context.Context, send func(event, data string) error) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}, WithSSEHeartbeat(5*time.Millisecond))
+		w := newLockedRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+		test.That(t, w.body(), test.ShouldContainSubstring, ": heartbeat\n\n")
+	})
+
+	t.Run("canceled client", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		sent := make(chan struct{})
+		var streamErr error
+		h := SSEHandler(func(ctx context.Context, send func(event, data string) error) error {
+			for {
+				if streamErr = send("tick", "."); streamErr != nil {
+					return streamErr
+				}
+				select {
+				case sent <- struct{}{}:
+				default:
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+		done := make(chan struct{})
+		w := newLockedRecorder()
+		go func() {
+			defer close(done)
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx))
+		}()
+		<-sent
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("stream did not stop after the client went away")
+		}
+		test.That(t, errors.Is(streamErr, context.Canceled), test.ShouldBeTrue)
+		test.That(t, w.body(), test.ShouldNotContainSubstring, "event: error")
+	})
+
+	t.Run("stream error", func(t *testing.T) {
+		h := SSEHandler(func(ctx context.Context, send func(event, data string) error) error {
+			return errors.New("feed broke")
+		})
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/events", nil))
+		test.That(t, rr.Body.String(), test.ShouldEndWith, "event: error\ndata: feed broke\n\n")
+	})
+}
+
+func TestTemplateRouterHandleSSE(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	router := NewTemplateRouter(tm, golog.NewTestLogger(t))
+	router.Configure = func(mw *TemplateMiddleware) {
+		mw.Timeout = 10 * time.Millisecond
+	}
+	router.HandleSSE("GET /events", SSEHandler(func(ctx context.Context, send func(event, data string) error) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+		return send("", "still here")
+	}))
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/events")
+	test.That(t, err, test.ShouldBeNil)
+	defer resp.Body.Close()
+	var body strings.Builder
+	_, err = io.Copy(&body, resp.Body)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, body.String(), test.ShouldEndWith, "data: still here\n\n")
+}
@@ -1,19 +1,31 @@
 package web
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/Masterminds/sprig"
 	"github.com/edaniels/golog"
+	"go.uber.org/multierr"
+	"golang.org/x/sync/singleflight"
 
+	"go.viam.com/utils"
 	"go.viam.com/utils/web/protojson"
 )
 
@@ -22,74 +34,603 @@ type TemplateManager interface {
 	LookupTemplate(name string) (*template.Template, error)
 }
 
+// TemplateManagerCtx is a TemplateManager whose lookups can be canceled, for example when
+// templates are read from a slow network file system. TemplateMiddleware prefers it when
+// implemented and passes the request context through. The managers created by this package
+// implement it.
+type TemplateManagerCtx interface {
+	TemplateManager
+
+	// LookupTemplateCtx is LookupTemplate but gives up with ctx's error once ctx is done.
+	LookupTemplateCtx(ctx context.Context, name string) (*template.Template, error)
+}
+
+// lookupTemplateCtx looks up name with tm, honoring ctx if tm is a TemplateManagerCtx.
+func lookupTemplateCtx(ctx context.Context, tm TemplateManager, name string) (*template.Template, error) {
+	if ctm, ok := tm.(TemplateManagerCtx); ok {
+		return ctm.LookupTemplateCtx(ctx, name)
+	}
+	return tm.LookupTemplate(name)
+}
+
+// TemplateNameNormalizer is implemented by TemplateManagers that map file names to template names,
+// as configured by WithNameNormalizer. TemplateMiddleware uses it to find error templates. The
+// managers created by this package implement it.
+type TemplateNameNormalizer interface {
+	// NormalizeTemplateName returns the name of the template loaded from the file with the given
+	// slash-separated relative path.
+	NormalizeTemplateName(filename string) string
+}
+
+// normalizeTemplateName normalizes filename with tm if it is a TemplateNameNormalizer.
+func normalizeTemplateName(tm TemplateManager, filename string) string {
+	if n, ok := tm.(TemplateNameNormalizer); ok {
+		return n.NormalizeTemplateName(filename)
+	}
+	return filename
+}
+
+// TemplateInfoProvider is implemented by TemplateManagers that know where their templates were
+// loaded from. TemplateHash and the debug handler use it. The managers created by this package
+// implement it.
+type TemplateInfoProvider interface {
+	// LookupTemplateInfo describes the file the named template was loaded from. For a
+	// template created with {{define}}, this is the file containing the definition.
+	LookupTemplateInfo(name string) (TemplateInfo, error)
+}
+
+// lookupTemplateInfo describes the named template with tm if it is a TemplateInfoProvider.
+func lookupTemplateInfo(tm TemplateManager, name string) (TemplateInfo, error) {
+	p, ok := tm.(TemplateInfoProvider)
+	if !ok {
+		return TemplateInfo{}, fmt.Errorf("template manager does not support describing template %s", name)
+	}
+	return p.LookupTemplateInfo(name)
+}
+
+// TemplateLister is implemented by TemplateManagers that can list their templates. WarmUp and the
+// debug handler use it. The managers created by this package implement it.
+type TemplateLister interface {
+	// Names returns the sorted names of every defined template.
+	Names() ([]string, error)
+}
+
+// listTemplates returns the names of the templates of tm if it is a TemplateLister.
+func listTemplates(tm TemplateManager) ([]string, error) {
+	l, ok := tm.(TemplateLister)
+	if !ok {
+		return nil, errors.New("template manager does not support listing templates")
+	}
+	return l.Names()
+}
+
+// TemplateValidator is implemented by TemplateManagers that can check every template file on its
+// own. The managers created by this package implement it.
+type TemplateValidator interface {
+	// Validate parses every template file on its own and returns an error listing
+	// each file that fails to parse, rather than stopping at the first failure.
+	Validate() error
+}
+
+// validateTemplates validates the templates of tm if it is a TemplateValidator.
+func validateTemplates(tm TemplateManager) error {
+	v, ok := tm.(TemplateValidator)
+	if !ok {
+		return errors.New("template manager does not support validating templates")
+	}
+	return v.Validate()
+}
+
+// ReloadableTemplateManager is a TemplateManager whose templates can be explicitly reloaded,
+// for example from a SIGHUP handler or an admin endpoint. The file system backed managers
+// implement it.
+type ReloadableTemplateManager interface {
+	TemplateManager
+
+	// Reload rereads and reparses every template and atomically swaps in the new set. If
+	// parsing fails, the error is returned and the previous set stays in use.
+	Reload() error
+}
+
+// TemplateInfo describes the source of a template.
+type TemplateInfo struct {
+	// Name is the name of the template.
+	Name string
+	// SourcePath is the path of the file the template was defined in. For on disk templates this
+	// is a file system path; otherwise it is the path within the embedded file system.
+	SourcePath string
+	// ModTime is the modification time of the source file. It may be zero for embedded files.
+	ModTime time.Time
+	// Size is the size of the source file in bytes.
+	Size int64
+	// Hash is the hex encoded sha256 of the source file's contents. It only depends on the
+	// contents, so it is stable across processes and suitable as part of an ETag.
+	Hash string
+}
+
+// TemplateHash returns the hash of the source of the named template. See TemplateInfo.Hash.
+func TemplateHash(tm TemplateManager, name string) (string, error) {
+	info, err := lookupTemplateInfo(tm, name)
+	if err != nil {
+		return "", err
+	}
+	return info.Hash, nil
+}
+
+// ErrTemplateNotFound is returned (possibly wrapped) by a TemplateManager when no template
+// with the requested name is defined. Check for it with errors.Is.
+var ErrTemplateNotFound = errors.New("template not found")
+
+type templateNotFoundError string
+
+func (e templateNotFoundError) Error() string {
+	return fmt.Sprintf("cannot find template %s", string(e))
+}
+
+func (e templateNotFoundError) Is(target error) bool {
+	return target == ErrTemplateNotFound
+}
+
 func lookupTemplate(main *template.Template, name string) (*template.Template, error) {
 	t := main.Lookup(name)
 	if t == nil {
-		return nil, fmt.Errorf("cannot find template %s", name)
+		return nil, templateNotFoundError(name)
 	}
 	return t, nil
 }
 
+// templateNames returns the sorted names of the templates defined in main. Templates that were
+// only declared (like the root template) and never given a body are omitted.
+func templateNames(main *template.Template) []string {
+	var names []string
+	for _, t := range main.Templates() {
+		if t.Tree == nil || isInternalTemplateName(t.Name()) {
+			continue
+		}
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TemplateSource is where a TemplateManager loads its templates from. Use EmbedTemplateSource
+// for file systems that never change and DirTemplateSource for templates on disk.
+type TemplateSource interface {
+	// templateFS returns the file system and the root directory within it to load from.
+	templateFS() (fs.FS, string)
+
+	// static reports whether the source never changes and may therefore be parsed just once.
+	static() bool
+
+	// sourcePath returns how to present the location of the file at p within templateFS.
+	sourcePath(p string) string
+}
+
+type embedTemplateSource struct {
+	fsys   fs.FS
+	srcDir string
+}
+
+func (s embedTemplateSource) templateFS() (fs.FS, string) {
+	return s.fsys, s.srcDir
+}
+
+func (s embedTemplateSource) static() bool {
+	return true
+}
+
+func (s embedTemplateSource) sourcePath(p string) string {
+	return p
+}
+
+// EmbedTemplateSource returns a TemplateSource for srcDir within an embedded file system.
+// The templates are parsed once when the TemplateManager is created.
+func EmbedTemplateSource(fs fs.ReadDirFS, srcDir string) TemplateSource {
+	return embedTemplateSource{fs, srcDir}
+}
+
+type dirTemplateSource string
+
+func (s dirTemplateSource) templateFS() (fs.FS, string) {
+	return os.DirFS(string(s)), "."
+}
+
+func (s dirTemplateSource) static() bool {
+	return false
+}
+
+func (s dirTemplateSource) sourcePath(p string) string {
+	return filepath.Join(string(s), filepath.FromSlash(p))
+}
+
+// DirTemplateSource returns a TemplateSource for a directory on the file system. The
+// templates are reparsed whenever the files in the directory change.
+func DirTemplateSource(srcDir string) TemplateSource {
+	return dirTemplateSource(srcDir)
+}
+
+// NewTemplateManager creates a TemplateManager that loads its templates from the given source.
+// Invalid options are reported here rather than when templates are rendered.
+func NewTemplateManager(src TemplateSource, opts ...TemplateManagerOption) (TemplateManager, error) {
+	o := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	if !src.static() {
+		return &fsTM{opts: o, src: src}, nil
+	}
+
+	start := time.Now()
+	ts, err := loadTemplateSet(src, o)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing templates from embedded filesystem: %w", err)
+	}
+	return newEmbedTM(o, ts, time.Since(start)), nil
+}
+
+// newEmbedTM returns a manager for a template set that never changes and took parseDuration to parse.
+func newEmbedTM(opts templateManagerOptions, ts *templateSet, parseDuration time.Duration) *embedTM {
+	tm := &embedTM{opts: opts, cachedTemplates: ts, names: ts.names()}
+	tm.stats.parsed(parseDuration)
+	return tm
+}
+
 type embedTM struct {
-	protojson.MarshalingOptions
+	// stats is first for 64-bit alignment.
+	stats templateStats
+
+	opts templateManagerOptions
 
-	cachedTemplates *template.Template
+	cachedTemplates *templateSet
+	names           []string
 }
 
 func (tm *embedTM) LookupTemplate(name string) (*template.Template, error) {
-	return lookupTemplate(tm.cachedTemplates, name)
+	t, err := tm.cachedTemplates.lookup(name)
+	tm.stats.cached(true)
+	tm.stats.lookedUp(err)
+	return t, err
+}
+
+func (tm *embedTM) Stats() TemplateManagerStats {
+	return tm.stats.snapshot()
+}
+
+// LookupTemplateCtx never blocks since the templates were parsed during construction.
+func (tm *embedTM) LookupTemplateCtx(ctx context.Context, name string) (*template.Template, error) {
+	return tm.LookupTemplate(name)
+}
+
+func (tm *embedTM) LookupTemplateInfo(name string) (TemplateInfo, error) {
+	return tm.cachedTemplates.info(name)
+}
+
+func (tm *embedTM) LookupLayout(layout, page string) (*template.Template, error) {
+	return tm.cachedTemplates.layout(layout, page)
+}
+
+func (tm *embedTM) NormalizeTemplateName(filename string) string {
+	return tm.opts.normalizeName(filename)
+}
+
+func (tm *embedTM) Names() ([]string, error) {
+	return append([]string(nil), tm.names...), nil
+}
+
+// Validate always succeeds since every file was validated during construction.
+func (tm *embedTM) Validate() error {
+	return nil
 }
 
 // NewTemplateManagerEmbed creates a TemplateManager from an embedded file system.
-func NewTemplateManagerEmbed(fs fs.ReadDirFS, srcDir string) (TemplateManager, error) {
-	return NewTemplateManagerEmbedWithOptions(fs, srcDir, protojson.DefaultMarshalingOptions())
+// Templates in subdirectories of srcDir are named by their slash-separated path relative to srcDir.
+func NewTemplateManagerEmbed(fs fs.ReadDirFS, srcDir string, tmOpts ...TemplateManagerOption) (TemplateManager, error) {
+	return NewTemplateManagerFSys(fs, srcDir, tmOpts...)
+}
+
+// NewTemplateManagerFSys creates a TemplateManager from any fs.FS that does not change, such as the
+// result of fs.Sub. Directories are listed with fs.ReadDir, so fsys does not need to implement
+// fs.ReadDirFS. The templates are parsed once, exactly as with NewTemplateManagerEmbed.
+func NewTemplateManagerFSys(fsys fs.FS, srcDir string, tmOpts ...TemplateManagerOption) (TemplateManager, error) {
+	return NewTemplateManager(embedTemplateSource{fsys, srcDir}, tmOpts...)
 }
 
 // NewTemplateManagerEmbedWithOptions creates a TemplateManager from an embedded file system. Allows optional protojson.MarshalingOptions.
-func NewTemplateManagerEmbedWithOptions(fs fs.ReadDirFS, srcDir string, opts protojson.MarshalingOptions) (TemplateManager, error) {
-	files, err := fs.ReadDir(srcDir)
+func NewTemplateManagerEmbedWithOptions(
+	fs fs.ReadDirFS,
+	srcDir string,
+	opts protojson.MarshalingOptions,
+	tmOpts ...TemplateManagerOption,
+) (TemplateManager, error) {
+	return NewTemplateManager(EmbedTemplateSource(fs, srcDir), append([]TemplateManagerOption{WithMarshalingOptions(opts)}, tmOpts...)...)
+}
+
+type fsTM struct {
+	// checkedAt is the UnixNano time the cached set was last found to be current. It is accessed
+	// atomically and kept first in the struct for 64-bit alignment.
+	checkedAt int64
+	stats     templateStats
+
+	opts templateManagerOptions
+
+	src TemplateSource
+
+	// checks deduplicates concurrent staleness checks so that while one goroutine walks and
+	// possibly reparses the templates, the others wait for its result.
+	checks singleflight.Group
+	// mu serializes reparses, including those from Reload.
+	mu sync.Mutex
+	// cached holds the last successfully parsed *templateSet.
+	cached atomic.Value
+}
+
+func (tm *fsTM) LookupTemplate(name string) (*template.Template, error) {
+	return tm.LookupTemplateCtx(context.Background(), name)
+}
+
+// LookupTemplateCtx stops waiting for the template files to be listed and parsed once ctx is
+// done. The check itself carries on in the background so that its result can be used by later
+// lookups.
+func (tm *fsTM) LookupTemplateCtx(ctx context.Context, name string) (*template.Template, error) {
+	t, err := tm.lookupTemplateCtx(ctx, name)
+	tm.stats.lookedUp(err)
+	return t, err
+}
+
+func (tm *fsTM) lookupTemplateCtx(ctx context.Context, name string) (*template.Template, error) {
+	ts, err := tm.templatesCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return ts.lookup(name)
+}
 
-	newFiles := fixFiles(files, srcDir)
+func (tm *fsTM) Stats() TemplateManagerStats {
+	return tm.stats.snapshot()
+}
 
-	ts, err := baseTemplate(opts).ParseFS(fs, newFiles...)
+func (tm *fsTM) LookupTemplateInfo(name string) (TemplateInfo, error) {
+	ts, err := tm.templates()
 	if err != nil {
-		return nil, fmt.Errorf("error initializing templates from embedded filesystem: %w", err)
+		return TemplateInfo{}, err
 	}
-	return &embedTM{opts, ts}, nil
+	return ts.info(name)
 }
 
-type fsTM struct {
-	protojson.MarshalingOptions
+func (tm *fsTM) LookupLayout(layout, page string) (*template.Template, error) {
+	ts, err := tm.templates()
+	if err != nil {
+		return nil, err
+	}
+	return ts.layout(layout, page)
+}
 
-	srcDir string
+func (tm *fsTM) NormalizeTemplateName(filename string) string {
+	return tm.opts.normalizeName(filename)
 }
 
-func (tm *fsTM) LookupTemplate(name string) (*template.Template, error) {
-	files, err := os.ReadDir(tm.srcDir)
+func (tm *fsTM) Names() ([]string, error) {
+	ts, err := tm.templates()
+	if err != nil {
+		return nil, err
+	}
+	return ts.names(), nil
+}
+
+func (tm *fsTM) Validate() error {
+	return validateTemplateSource(tm.src, tm.opts)
+}
+
+// loaded returns the last successfully parsed set without checking whether it is stale.
+func (tm *fsTM) loaded() *templateSet {
+	ts, _ := tm.cached.Load().(*templateSet)
+	return ts
+}
+
+// templates returns the cached template set, reparsing it only if the directory
+// listing or any file's size or modification time has changed since the last parse.
+func (tm *fsTM) templates() (*templateSet, error) {
+	return tm.templatesCtx(context.Background())
+}
+
+// templatesCtx is templates but gives up waiting once ctx is done. Within the configured check
+// interval of the last check, the cached set is returned without touching the file system.
+func (tm *fsTM) templatesCtx(ctx context.Context) (*templateSet, error) {
+	before := tm.loaded()
+	if before != nil && tm.opts.checkInterval > 0 {
+		checkedAt := time.Unix(0, atomic.LoadInt64(&tm.checkedAt))
+		if time.Since(checkedAt) < tm.opts.checkInterval {
+			tm.stats.cached(true)
+			return before, nil
+		}
+	}
+
+	results := tm.checks.DoChan("", func() (interface{}, error) {
+		return tm.check()
+	})
+	select {
+	case res := <-results:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		ts := res.Val.(*templateSet)
+		tm.stats.cached(ts == before)
+		return ts, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// check lists the template files and reparses them if they changed since the last parse.
+func (tm *fsTM) check() (*templateSet, error) {
+	checkedAt := time.Now()
+	fsys, srcDir := tm.src.templateFS()
+	files, err := findTemplateFiles(fsys, srcDir, tm.opts)
 	if err != nil {
 		return nil, err
 	}
 
-	newFiles := fixFiles(files, tm.srcDir)
+	ts := tm.loaded()
+	if ts == nil || !templateFilesEqual(ts.files, files) {
+		tm.mu.Lock()
+		defer tm.mu.Unlock()
+		if ts, err = tm.parse(fsys, files); err != nil {
+			return nil, err
+		}
+	}
+	atomic.StoreInt64(&tm.checkedAt, checkedAt.UnixNano())
+	return ts, nil
+}
+
+// Reload unconditionally rereads and reparses every template, then atomically swaps in the new
+// set. Concurrent lookups keep using the previous set until the swap. If parsing fails, the error
+// is returned and the previous set stays in use.
+func (tm *fsTM) Reload() error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	checkedAt := time.Now()
+	fsys, srcDir := tm.src.templateFS()
+	files, err := findTemplateFiles(fsys, srcDir, tm.opts)
+	if err != nil {
+		return err
+	}
+	if _, err := tm.parse(fsys, files); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&tm.checkedAt, checkedAt.UnixNano())
+	return nil
+}
 
-	main, err := baseTemplate(tm.MarshalingOptions).ParseFiles(newFiles...)
+// parse parses files and stores the result as the current set. tm.mu must be held.
+func (tm *fsTM) parse(fsys fs.FS, files []templateFile) (*templateSet, error) {
+	start := time.Now()
+	defer func() {
+		tm.stats.parsed(time.Since(start))
+	}()
+	main, err := parseTemplateSet(fsys, files, tm.opts)
 	if err != nil {
 		return nil, err
 	}
-	return lookupTemplate(main, name)
+	ts, err := newTemplateSet(main, files, tm.src)
+	if err != nil {
+		return nil, err
+	}
+	tm.cached.Store(ts)
+	return ts, nil
 }
 
 // NewTemplateManagerFS creates a new TemplateManager from the file system.
-func NewTemplateManagerFS(srcDir string) (TemplateManager, error) {
-	return NewTemplateManagerFSWithOptions(srcDir, protojson.DefaultMarshalingOptions())
+// Templates in subdirectories of srcDir are named by their slash-separated path relative to srcDir.
+// To combine several directories, use NewTemplateManagerFSDirs: this function already takes its
+// options as variadic arguments, so it cannot also take a variadic list of directories, and
+// changing srcDir to a slice would break every caller.
+func NewTemplateManagerFS(srcDir string, tmOpts ...TemplateManagerOption) (TemplateManager, error) {
+	return NewTemplateManager(DirTemplateSource(srcDir), tmOpts...)
 }
 
 // NewTemplateManagerFSWithOptions creates a new TemplateManager from the file system. Allows optional protojson.MarshalingOptions.
-func NewTemplateManagerFSWithOptions(srcDir string, opts protojson.MarshalingOptions) (TemplateManager, error) {
-	return &fsTM{opts, srcDir}, nil
+func NewTemplateManagerFSWithOptions(
+	srcDir string,
+	opts protojson.MarshalingOptions,
+	tmOpts ...TemplateManagerOption,
+) (TemplateManager, error) {
+	return NewTemplateManager(DirTemplateSource(srcDir), append([]TemplateManagerOption{WithMarshalingOptions(opts)}, tmOpts...)...)
+}
+
+// TemplateExecError is returned by ExecuteTo and ExecuteToString when a template was found
+// but failed while executing.
+type TemplateExecError struct {
+	// Name is the name of the template that failed.
+	Name string
+	// Err is the underlying execution error.
+	Err error
+}
+
+func (e *TemplateExecError) Error() string {
+	return fmt.Sprintf("error executing template %s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying execution error.
+func (e *TemplateExecError) Unwrap() error {
+	return e.Err
+}
+
+// ExecuteTo looks up the named template and executes it with data into w. Lookup failures are
+// returned as is (see ErrTemplateNotFound); execution failures are returned as a
+// *TemplateExecError. Output written before an execution failure is not rolled back.
+func ExecuteTo(tm TemplateManager, w io.Writer, name string, data interface{}) error {
+	t, err := tm.LookupTemplate(name)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(w, data); err != nil {
+		return &TemplateExecError{Name: name, Err: err}
+	}
+	return nil
+}
+
+// ExecuteToString renders the named template with data and returns the result. Errors are
+// reported as in ExecuteTo, in which case no partial output is returned.
+func ExecuteToString(tm TemplateManager, name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := ExecuteTo(tm, &buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// MustLookupTemplate looks up the named template and panics if it cannot be found. It is meant
+// for templates the application cannot run without, looked up during startup.
+func MustLookupTemplate(tm TemplateManager, name string) *template.Template {
+	t, err := tm.LookupTemplate(name)
+	if err != nil {
+		panic(fmt.Errorf("required template %s: %w", name, err))
+	}
+	return t
+}
+
+// RequireTemplates checks that every named template can be looked up and returns an error naming
+// each one that cannot. File system backed managers check the current contents of their directory.
+func RequireTemplates(tm TemplateManager, names ...string) error {
+	var err error
+	for _, name := range names {
+		if _, lookupErr := tm.LookupTemplate(name); lookupErr != nil {
+			err = multierr.Combine(err, fmt.Errorf("required template %s: %w", name, lookupErr))
+		}
+	}
+	return err
+}
+
+// WarmUp eagerly parses the templates of tm and looks up each named template, or every template
+// if no names are given, so that the first request does not pay for parsing. Call it before
+// serving requests. It gives up once ctx is done and returns an error naming every template that
+// cannot be looked up.
+func WarmUp(ctx context.Context, tm TemplateManager, names ...string) error {
+	if len(names) == 0 {
+		if ctm, ok := tm.(TemplateManagerCtx); ok {
+			// parse within ctx's deadline before listing the names.
+			if _, err := ctm.LookupTemplateCtx(ctx, ""); err != nil && !errors.Is(err, ErrTemplateNotFound) {
+				return err
+			}
+		}
+		var err error
+		if names, err = listTemplates(tm); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for _, name := range names {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return multierr.Combine(err, ctxErr)
+		}
+		if _, lookupErr := lookupTemplateCtx(ctx, tm, name); lookupErr != nil {
+			err = multierr.Combine(err, fmt.Errorf("error warming up template %s: %w", name, lookupErr))
+		}
+	}
+	return err
 }
 
 // -------------------------
@@ -97,6 +638,9 @@ func NewTemplateManagerFSWithOptions(srcDir string, opts protojson.MarshalingOpt
 // TemplateHandler implement this to be able to use middleware.
 type TemplateHandler interface {
 	// return (template name, thing to pass to template, error)
+	//
+	// A nil template with a nil error means the handler wrote the response itself, such as for a
+	// file download; if it wrote nothing at all, a 204 No Content is sent.
 	Serve(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error)
 }
 
@@ -110,8 +654,20 @@ func (f TemplateHandlerFunc) Serve(w http.ResponseWriter, r *http.Request) (*Tem
 
 // Template specifies which template to render.
 type Template struct {
-	named  string
-	direct *template.Template
+	named       string
+	direct      *template.Template
+	layout      string
+	status      int
+	streaming   bool
+	redirect    string
+	contentType string
+
+	lastModified    time.Time
+	lastModifiedSet bool
+	partial         string
+	then            []string
+	header          http.Header
+	cookies         []*http.Cookie
 }
 
 // NamedTemplate creates a Template with a name.
@@ -119,21 +675,341 @@ func NamedTemplate(called string) *Template {
 	return &Template{named: called}
 }
 
+// Sequence creates a Template rendering the named templates one after another, with the same
+// data, into a single response, as for a page assembled from a header, a body and a footer.
+// If any of them cannot be found or fails to render, the whole response fails.
+func Sequence(names ...string) *Template {
+	if len(names) == 0 {
+		return NamedTemplate("")
+	}
+	return NamedTemplate(names[0]).Then(names[1:]...)
+}
+
+// Then returns a copy of the Template that goes on to render the named templates after itself,
+// in order and with the same data. See Sequence.
+func (t *Template) Then(names ...string) *Template {
+	withThen := *t
+	withThen.then = append(append([]string(nil), t.then...), names...)
+	return &withThen
+}
+
 // DirectTemplate creates a template to say use this specific template.
 func DirectTemplate(t *template.Template) *Template {
 	return &Template{direct: t}
 }
 
+// WithStatus returns a copy of the Template that is rendered with the given HTTP status instead
+// of 200, such as 201 after creating something or 404 from a catch-all handler. Any status may be
+// used; the page is rendered as is, without going through the error templates used for errors
+// returned by a TemplateHandler, which only render errors. ETags and Last-Modified only apply to
+// 200 responses, so a deliberate 404 is never answered with a 304.
+func (t *Template) WithStatus(code int) *Template {
+	withStatus := *t
+	withStatus.status = code
+	return &withStatus
+}
+
+// WithContentType returns a copy of the Template that is rendered with the given Content-Type
+// instead of TemplateMiddleware's, such as "image/svg+xml" or "text/plain; charset=utf-8".
+func (t *Template) WithContentType(contentType string) *Template {
+	withContentType := *t
+	withContentType.contentType = contentType
+	return &withContentType
+}
+
+// contentType returns the Content-Type to render t with.
+func (tm *TemplateMiddleware) contentType(t *Template) string {
+	switch {
+	case t.contentType != "":
+		return t.contentType
+	case tm.ContentType != "":
+		return tm.ContentType
+	default:
+		return DefaultTemplateContentType
+	}
+}
+
+// statusCode returns the status to render the template with.
+func (t *Template) statusCode() int {
+	if t.status == 0 {
+		return http.StatusOK
+	}
+	return t.status
+}
+
+// WithLayout returns a copy of the Template that renders the named layout with this template
+// as its LayoutContentTemplate. Layouts only apply to named templates.
+func (t *Template) WithLayout(layout string) *Template {
+	withLayout := *t
+	withLayout.layout = layout
+	return &withLayout
+}
+
+// DefaultTemplateContentType is the Content-Type TemplateMiddleware sends for rendered
+// templates unless configured otherwise.
+const DefaultTemplateContentType = "text/html; charset=utf-8"
+
 // TemplateMiddleware handles the rendering of the template from the data and finding of the template.
+// Without Templates or a Handler it answers every request with a plain 500 error.
 type TemplateMiddleware struct {
 	Templates TemplateManager
 	Handler   TemplateHandler
-	Logger    golog.Logger
 
-	// Recover from panics with a proper error logs.
+	// Logger is the golog logger used when Log is unset. It is kept for existing callers; new
+	// code can set Log instead.
+	Logger golog.Logger
+
+	// Log, if set, is where the middleware logs, taking precedence over Logger. With neither set
+	// nothing is logged.
+	Log Logger
+
+	// StaticCache, if set, serves named templates it has registered as static from its cache
+	// instead of executing them. It must wrap Templates.
+	StaticCache *StaticRenderCache
+
+	// Timeout bounds how long the handler and rendering may take, by way of the request's
+	// context. Zero uses DefaultTemplateTimeout and a negative value adds no timeout beyond
+	// the server's own. ContextWithTemplateTimeout overrides it for a single request. Handlers
+	// giving up with context.DeadlineExceeded get a 504, rendered with 504.html if it exists.
+	Timeout time.Duration
+
+	// RequestFuncs, if set, returns functions to install in the template for a single request,
+	// such as the current user or a CSRF token. The functions must also be defined, for instance
+	// as placeholders passed to WithFuncs, when the templates are parsed. Installing them means
+	// rendering a copy of the template; the managers in this package keep a pool of copies, but
+	// it still costs more than rendering the shared template.
+	RequestFuncs func(r *http.Request) template.FuncMap
+
+	// CommonData, if set, returns data every page needs for a request, such as the current user,
+	// navigation and flash messages. When the handler's data is a map[string]interface{} the
+	// common data is merged into a copy of it, with the handler's entries winning; otherwise
+	// templates are given a TemplateData holding both. JSON responses from NegotiateJSON carry the
+	// handler's data only. Errors are handled like those returned by the handler.
+	CommonData func(r *http.Request) (map[string]interface{}, error)
+
+	// ContentSecurityPolicy, if set, is sent as the Content-Security-Policy header of every
+	// response, with each CSPNoncePlaceholder replaced by a random nonce generated for the
+	// request, as in "script-src 'nonce-{nonce}'". Templates rendered for the request get the
+	// nonce from {{ cspNonce }}, and handlers from CSPNonce. RenderCache is not used when this is
+	// set, since cached pages would carry a stale nonce. Without it, {{ cspNonce }} renders
+	// nothing; like the other middleware functions, it is only defined for html templates.
+	ContentSecurityPolicy string
+
+	// CSRF, if set, protects against cross-site request forgery. Requests with unsafe methods,
+	// such as POST, are rejected with a 403 ErrorResponse before reaching Handler unless they
+	// carry the token from the CSRF cookie; other requests are issued one. Templates rendered for
+	// the request get the token from {{ csrfToken }} and a hidden form input holding it from
+	// {{ csrfField }}, and handlers get it from CSRFToken. RenderCache is not used when this is
+	// set. Without it, both functions render nothing.
+	CSRF *CSRFOptions
+
+	// OnError, if set, is called with every error the middleware responds to, whether returned by
+	// Handler or from finding or rendering the template, before the error page is written. It
+	// suits reporting errors to an external service. A panic in OnError is logged and otherwise
+	// ignored.
+	OnError func(r *http.Request, err error, status int)
+
+	// ClientErrorIDs gives 4xx errors an error ID too. Every 5xx error gets one, logged as
+	// error_id, shown in the plain text and JSON error bodies and passed to error templates as
+	// ErrorTemplateData.ErrorID, so that a user's report can be matched to the log.
+	ClientErrorIDs bool
+
+	// LogLevelFor, if set, returns the level to log an error answered with the given status at.
+	// It defaults to DefaultLogLevelFor.
+	LogLevelFor func(status int, err error) Level
+
+	// ErrorTemplateNames, if set, returns the names of the templates to try, in order, for an
+	// error with the given status; the first that exists renders the error. It defaults to
+	// DefaultErrorTemplateNames. Names are normalized as template file names are.
+	ErrorTemplateNames func(status int) []string
+
+	// DevMode renders errors that are not an ErrorResponse, which would otherwise be generic 500s,
+	// as a built-in diagnostic page showing the error chain, a stack trace and, for template
+	// errors, the template source around the failure. The stack is where a panic happened, where
+	// an error from github.com/pkg/errors was made or, for other errors, where the error was
+	// handled. It exposes internals and must only be set during development.
+	DevMode bool
+
+	// SanitizeErrors keeps the messages of 5xx errors that are not an ErrorResponse, such as a
+	// database driver's, from the client: error templates, JSON and plain text bodies are given
+	// the status text, such as "Internal Server Error", instead. The error is still logged and
+	// passed to OnError in full. ErrorResponses are considered written for the client and shown
+	// as they are. It overrides DevMode.
+	SanitizeErrors bool
+
+	// ErrorRenderer, if set, writes every error response in place of the JSON, DevMode, error
+	// template and plain text ones, after the error is logged and passed to OnError. A panic in
+	// it is logged and answered with plain text. DefaultErrorRenderer returns the renderer used
+	// otherwise.
+	ErrorRenderer ErrorRenderer
+
+	// AfterServe, if set, is called once for every request after its response is written,
+	// whether rendered, written by the handler or an error page, with the final status, the body
+	// bytes sent (after any compression) and how long the request took.
+	AfterServe func(r *http.Request, status int, bytesWritten int64, dur time.Duration)
+
+	// RequestIDs gives every request an ID, taken from its RequestIDHeader or generated, which is
+	// sent back in the same header, included in every line the middleware logs and available to
+	// handlers from RequestID and to templates, including error templates, from {{ requestID }}.
+	// RenderCache is not used when this is set. Without it, {{ requestID }} renders nothing.
+	RequestIDs bool
+
+	// RateLimiter, if set, throttles requests before they reach Handler. Denied requests get a
+	// 429 ErrorResponse, rendered with 429.html if it exists, and a Retry-After header.
+	// NewTokenBucketLimiter provides one.
+	RateLimiter RateLimiter
+
+	// RateLimitKey returns the key RateLimiter throttles a request under. When nil, the client's
+	// IP address is used, as found by ClientIP with TrustForwardedFor.
+	RateLimitKey func(r *http.Request) string
+
+	// TrustForwardedFor makes the default RateLimitKey use the X-Forwarded-For header. Only set it
+	// behind a proxy that sets the header.
+	TrustForwardedFor bool
+
+	// ServerTiming, if set, sends a Server-Timing header reporting how long the handler and the
+	// rendering took, as handler;dur= and render;dur= in milliseconds, and whether the RenderCache
+	// was hit, as cache;desc=hit or cache;desc=miss. Streamed templates, and all of them with
+	// Unbuffered, start being sent before rendering is done and so only report the handler.
+	ServerTiming bool
+
+	// MaxResponseBytes, if positive, bounds how much a template may render, guarding against
+	// runaway templates. A buffered page exceeding it is a 500 error wrapping ErrResponseTooLarge;
+	// a streaming or Unbuffered one that has already sent output is cut off by closing the
+	// connection. Zero means no limit.
+	MaxResponseBytes int64
+
+	// LogRequests logs a line through Logger for every request served, with its method, path,
+	// status, bytes written, the time spent in the handler and rendering, and the template.
+	LogRequests bool
+
+	// Metrics, if set, observes every request served. If it is a TemplateErrorMetrics, it also
+	// counts the errors responded to.
+	Metrics TemplateMetrics
+
+	// Tracer, if set, records a TemplateHandlerSpan around the handler and a TemplateRenderSpan
+	// around rendering, both children of any span in the request's context and annotated with
+	// the template and status.
+	Tracer TemplateTracer
+
+	// SkipHeadRender answers HEAD requests without looking up or rendering the template once the
+	// handler has returned. This saves the work but means the response has no Content-Length.
+	// By default HEAD requests are rendered like GET requests and only the body is left out.
+	SkipHeadRender bool
+
+	// RenderCache, if set, stores whole responses to GET and HEAD requests for which
+	// RenderCacheKey returns a key, and serves later requests with the same key from it without
+	// running the handler. Only successful, uncompressed responses without cookies are stored,
+	// and entries are ignored once the templates are reparsed. It suits pages rendered
+	// identically for everyone, such as for anonymous visitors.
+	RenderCache ResponseCache
+
+	// RenderCacheKey returns the key to cache a request's response under, or false to neither
+	// cache it nor serve it from the cache, such as for requests with a session. When nil,
+	// requests with a Cookie or Authorization header are not cached, and for others the request
+	// URL is the key, kept apart for HTMX fragment requests and for JSON negotiated with
+	// NegotiateJSON. Sites whose anonymous visitors carry cookies, such as for analytics, should
+	// set it.
+	RenderCacheKey func(r *http.Request) (string, bool)
+
+	// RenderCacheTTL is how long responses are cached. Zero uses DefaultRenderCacheTTL.
+	RenderCacheTTL time.Duration
+
+	// MaxRenderCacheEntrySize is the largest body, in bytes, that is cached. Zero uses
+	// DefaultMaxRenderCacheEntrySize.
+	MaxRenderCacheEntrySize int
+
+	// ContentType is the Content-Type of rendered templates, unless the handler sets one itself or
+	// the Template overrides it with WithContentType. Empty uses DefaultTemplateContentType.
+	ContentType string
+
+	// NegotiateJSON makes the middleware answer requests preferring application/json in their
+	// Accept header by encoding the handler's data as JSON instead of rendering its template.
+	// Errors are written as JSON, as {"status": 404, "message": "..."}, whenever the Accept header
+	// prefers it; with NegotiateJSON, FormatParam decides for errors too. Responses get a
+	// "Vary: Accept" header so that shared caches keep the two apart.
+	NegotiateJSON bool
+
+	// FormatParam, if set along with NegotiateJSON, names a query parameter that overrides the
+	// Accept header: "json" selects JSON and any other value HTML.
+	FormatParam string
+
+	// ETags makes the middleware tag successful GET and HEAD responses with a hash of the
+	// rendered page and answer requests whose If-None-Match header has that tag with 304 Not
+	// Modified and no body. Pages larger than MaxETagSize are not tagged. Unbuffered pages are
+	// never tagged.
+	ETags bool
+
+	// MaxETagSize is the largest page, in bytes, tagged when ETags is set. Zero uses
+	// DefaultMaxETagSize and a negative value tags pages of any size.
+	MaxETagSize int
+
+	// FlushBytes and FlushInterval control how often Streaming templates are flushed: after at
+	// least FlushBytes bytes have been written or FlushInterval has passed since the last flush.
+	// Zero uses DefaultFlushBytes and DefaultFlushInterval.
+	FlushBytes    int
+	FlushInterval time.Duration
+
+	// Compress gzip or deflate encodes rendered pages for clients accepting it. Buffered pages
+	// smaller than MinCompressSize are sent as is, while unbuffered pages are always compressed.
+	Compress bool
+
+	// MinCompressSize is the smallest page, in bytes, compressed when Compress is set. Zero uses
+	// DefaultMinCompressSize.
+	MinCompressSize int
+
+	// Transform, if set, rewrites each rendered page before it is written, such as to minify it
+	// or inject a build version comment. It runs after the ETag is computed from the untransformed
+	// page, so a request matching it gets its 304 without the transform running, and before
+	// compression. Transform must therefore give the same output for the same page. If it fails,
+	// the untransformed page is written and a warning logged. Streaming templates and Unbuffered
+	// rendering are never transformed.
+	Transform func(output []byte) ([]byte, error)
+
+	// Unbuffered writes templates straight to the response instead of rendering them in full
+	// first. This suits very large pages, at the cost of a template that fails part way through
+	// leaving a truncated page with a success status rather than rendering an error.
+	Unbuffered bool
+
+	// PanicCapture is kept for compatibility; ServeHTTP recovers from panics itself and renders
+	// them with the error templates.
 	PanicCapture
 }
 
+// DefaultTemplateTimeout is the TemplateMiddleware timeout used when none is configured.
+const DefaultTemplateTimeout = 10 * time.Second
+
+type templateCtxKey int
+
+const (
+	ctxKeyTemplateTimeout = templateCtxKey(iota)
+	ctxKeyCSPNonce
+	ctxKeyCSRFToken
+	ctxKeyRequestID
+	ctxKeyRequestLogger
+	ctxKeyErrorID
+)
+
+// ContextWithTemplateTimeout attaches a timeout to the given context that a TemplateMiddleware
+// serving a request with it uses instead of its own Timeout. It is meant for routing layers
+// to give individual slow pages more time, and follows the same rules as Timeout.
+func ContextWithTemplateTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, ctxKeyTemplateTimeout, timeout)
+}
+
+// timeout returns how long a request with the given context may take, or a non-positive
+// duration for no limit.
+func (tm *TemplateMiddleware) timeout(ctx context.Context) time.Duration {
+	timeout := tm.Timeout
+	if override, ok := ctx.Value(ctxKeyTemplateTimeout).(time.Duration); ok {
+		timeout = override
+	}
+	if timeout == 0 {
+		return DefaultTemplateTimeout
+	}
+	return timeout
+}
+
 // NewTemplateMiddleware returns a configured TemplateMiddleWare with a panic capture configured.
 func NewTemplateMiddleware(template TemplateManager, h TemplateHandler, logger golog.Logger) *TemplateMiddleware {
 	return &TemplateMiddleware{
@@ -146,66 +1022,692 @@ func NewTemplateMiddleware(template TemplateManager, h TemplateHandler, logger g
 	}
 }
 
+// responseWriterCapturer records whether a handler started its own response.
 type responseWriterCapturer struct {
 	http.ResponseWriter
 	statusCode int
+	written    int64
+
+	// handlingError is set once handleError starts rendering an error, so that an error raised
+	// while doing so is not rendered again.
+	handlingError bool
 }
 
 func (w *responseWriterCapturer) WriteHeader(code int) {
-	w.statusCode = code
+	if w.statusCode == 0 {
+		w.statusCode = code
+	}
 	w.ResponseWriter.WriteHeader(code)
 }
 
+// Write implicitly sends a 200 status if none was sent, just as net/http does.
+func (w *responseWriterCapturer) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer, or one it wraps, does.
+func (w *responseWriterCapturer) Flush() {
+	if err := http.NewResponseController(w.ResponseWriter).Flush(); err == nil && w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+}
+
+// wroteHeader reports whether a status has been sent.
+func (w *responseWriterCapturer) wroteHeader() bool {
+	return w.statusCode != 0
+}
+
+// wroteBody reports whether any of the body has been sent.
+func (w *responseWriterCapturer) wroteBody() bool {
+	return w.written > 0
+}
+
+// sentResponse returns the capturer beneath w, unwrapping as http.ResponseController does, if
+// it has already started a response.
+func sentResponse(w http.ResponseWriter) (*responseWriterCapturer, bool) {
+	capW := capturerOf(w)
+	if capW == nil {
+		return nil, false
+	}
+	return capW, capW.wroteHeader() || capW.wroteBody()
+}
+
+// capturerOf returns the responseWriterCapturer w wraps, or nil if there is none.
+func capturerOf(w http.ResponseWriter) *responseWriterCapturer {
+	for {
+		switch t := w.(type) {
+		case *responseWriterCapturer:
+			return t
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *responseWriterCapturer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status the handler sent, or zero if it sent nothing.
+func (w *responseWriterCapturer) Status() int {
+	return w.statusCode
+}
+
+// BytesWritten returns how many body bytes the handler wrote.
+func (w *responseWriterCapturer) BytesWritten() int64 {
+	return w.written
+}
+
 func (tm *TemplateMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Recover from panics in underlying handler.
-	defer tm.Recover(w, r)
+	if tm.RequestIDs {
+		r = tm.withRequestID(w, r)
+	}
+	req := &templateRequest{start: time.Now(), streaming: tm.Unbuffered}
+	resp := &responseWriterCapturer{ResponseWriter: w}
+	w = resp
+	defer tm.finishRequest(resp, r, req)
+	if tm.ServerTiming {
+		w = &serverTimingWriter{ResponseWriter: w, req: req}
+	}
+	if r.Method == http.MethodHead {
+		// Responses are rendered as for GET, so that their headers match, but never sent.
+		w = headResponseWriter{w}
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+	// Recover from panics in the handler and in templates.
+	defer tm.recoverPanic(w, r)
 
-	r = r.WithContext(ctx)
+	if err := tm.checkConfigured(); err != nil {
+		tm.logger(r).Error("cannot serve template request", "path", r.URL.Path, "error", req.failed(err))
+		writeBasicErrorResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx := r.Context()
+	if timeout := tm.timeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	if tm.RateLimiter != nil && !tm.allow(w, r) {
+		return
+	}
+	if tm.ContentSecurityPolicy != "" {
+		var err error
+		if r, err = tm.withCSP(w, r); tm.handleError(w, r, err) {
+			return
+		}
+		ctx = r.Context()
+	}
+	if tm.CSRF != nil {
+		var err error
+		if r, err = tm.withCSRF(w, r); tm.handleError(w, r, err) {
+			return
+		}
+		ctx = r.Context()
+	}
 
+	// Responses carrying a nonce, token or request ID must not be replayed.
+	if tm.RenderCache == nil || tm.ContentSecurityPolicy != "" || tm.CSRF != nil || tm.RequestIDs {
+		tm.serve(ctx, w, r, req)
+		return
+	}
+	key, ok := tm.renderCacheKey(r)
+	if !ok {
+		tm.serve(ctx, w, r, req)
+		return
+	}
+	generation, _ := templateGeneration(ctx, tm.Templates)
+	if cached, ok := tm.RenderCache.Get(key); ok && cached.Generation == generation {
+		req.cache = "hit"
+		writeCachedResponse(w, r, cached)
+		return
+	}
+	req.cache = "miss"
+	rec := newRenderCacheRecorder(w, tm.maxRenderCacheEntrySize())
+	tm.serve(ctx, rec, r, req)
+	// A HEAD response has no body to replay to later GET requests.
+	if cached := rec.cached(generation); cached != nil && req.err == nil && r.Method == http.MethodGet {
+		tm.RenderCache.Set(key, cached, tm.renderCacheTTL())
+	}
+}
+
+// checkConfigured returns an error if the middleware lacks what every request needs.
+func (tm *TemplateMiddleware) checkConfigured() error {
+	switch {
+	case tm.Handler == nil:
+		return errors.New("template middleware has no TemplateHandler")
+	case tm.Templates == nil:
+		return errors.New("template middleware has no TemplateManager")
+	default:
+		return nil
+	}
+}
+
+// serve runs the handler and renders its response.
+func (tm *TemplateMiddleware) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, req *templateRequest) {
+	if tm.NegotiateJSON {
+		// The same URL is answered with HTML or JSON depending on the Accept header.
+		w.Header().Add("Vary", "Accept")
+	}
 	capW := responseWriterCapturer{ResponseWriter: w}
-	t, data, err := tm.Handler.Serve(&capW, r)
-	if HandleError(w, err, tm.Logger) {
+	var handlerCtx context.Context
+	handlerCtx, req.handlerSpan = tm.startSpan(ctx, TemplateHandlerSpan)
+	t, data, err := tm.Handler.Serve(&capW, r.WithContext(handlerCtx))
+	req.handlerReturned(t, err)
+	if tm.handleError(w, r, err) {
 		return
 	}
-	if capW.statusCode != 0 {
+	if capW.Status() != 0 {
 		// user decided to do something else
+		tm.logger(r).Debug("handler wrote its own response", "status", capW.Status(), "bytes", capW.BytesWritten())
+		return
+	}
+	if t == nil {
+		tm.logger(r).Warn("handler returned no template and wrote no response", "path", r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	t.writeHeaders(w)
+	if t.redirect != "" {
+		tm.writeRedirect(w, r, t)
+		return
+	}
+
+	if clientGone(r, nil) {
+		tm.logger(r).Debug("client went away; not rendering", "path", r.URL.Path)
+		return
+	}
+
+	ctx, req.renderSpan = tm.startSpan(ctx, TemplateRenderSpan)
+	r = r.WithContext(ctx)
+
+	t = t.forRequest(w, r)
+	status := t.statusCode()
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", tm.contentType(t))
+	}
+	if tm.notModified(w, r, status, lastModified(t, data)) {
+		return
+	}
+	if r.Method == http.MethodHead && tm.SkipHeadRender {
+		w.WriteHeader(status)
+		return
+	}
+	if tm.wantsJSON(r) {
+		tm.handleError(w, r, req.failed(writeJSON(w, status, data)))
 		return
 	}
 
-	gt := t.direct
-	if gt == nil {
-		gt, err = tm.Templates.LookupTemplate(t.named)
-		if HandleError(w, err, tm.Logger) {
+	if t.direct == nil && t.layout == "" && len(t.then) == 0 && tm.StaticCache != nil && tm.StaticCache.IsStatic(t.named) {
+		output, err := tm.StaticCache.Render(t.named)
+		if tm.handleError(w, r, req.failed(err)) {
 			return
 		}
+		tm.writeRendered(w, r, status, output)
+		return
+	}
+
+	data, err = tm.withCommonData(r, data)
+	if tm.handleError(w, r, req.failed(err)) {
+		return
+	}
+	execute, err := tm.executor(ctx, r, t, data)
+	if tm.handleError(w, r, req.failed(err)) {
+		return
 	}
 
-	HandleError(w, gt.Execute(w, data), tm.Logger)
+	if t.streaming {
+		req.err = tm.stream(w, r, status, execute)
+		return
+	}
+
+	if tm.Unbuffered {
+		out := w
+		if tm.Compress {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		if encoding := tm.contentEncoding(r, -1); encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+			cw := newCompressWriter(encoding, w)
+			defer func() {
+				utils.UncheckedError(cw.Close())
+			}()
+			// Errors are rendered through the compressed stream too.
+			out = &compressedResponseWriter{ResponseWriter: w, w: cw}
+		}
+		if status != http.StatusOK {
+			out.WriteHeader(status)
+		}
+		err := req.failed(execute(tm.limitOutput(out)))
+		if _, started := sentResponse(w); started {
+			tm.abortIfTooLarge(r, err)
+		}
+		tm.handleError(out, r, err)
+		return
+	}
+
+	buf := getRenderBuffer()
+	defer putRenderBuffer(buf)
+	if tm.handleError(w, r, req.failed(execute(tm.limitOutput(buf)))) {
+		return
+	}
+	tm.writeRendered(w, r, status, buf.Bytes())
+}
+
+// executor finds the templates to render and returns a function rendering them with data. With
+// RequestFuncs set, the templates are rendered in copies holding the request's functions.
+func (tm *TemplateMiddleware) executor(
+	ctx context.Context,
+	r *http.Request,
+	t *Template,
+	data interface{},
+) (func(w io.Writer) error, error) {
+	execute, err := tm.templateExecutor(ctx, r, t, data)
+	if err != nil || len(t.then) == 0 {
+		return execute, err
+	}
+	executes := []func(w io.Writer) error{execute}
+	for i, name := range t.then {
+		execute, err := tm.templateExecutor(ctx, r, NamedTemplate(name), data)
+		if err != nil {
+			return nil, fmt.Errorf("template %d of sequence: %w", i+2, err)
+		}
+		executes = append(executes, execute)
+	}
+	return func(w io.Writer) error {
+		for _, execute := range executes {
+			if err := execute(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// templateExecutor returns a function rendering t, ignoring the templates it is followed by.
+func (tm *TemplateMiddleware) templateExecutor(
+	ctx context.Context,
+	r *http.Request,
+	t *Template,
+	data interface{},
+) (func(w io.Writer) error, error) {
+	funcs := tm.requestFuncs(r)
+
+	if t.direct != nil {
+		gt := t.direct
+		if funcs != nil {
+			clone, err := gt.Clone()
+			if err != nil {
+				return nil, err
+			}
+			gt = clone.Funcs(funcs)
+		}
+		return recoverExecute(gt.Name(), func(w io.Writer) error { return gt.Execute(w, data) }), nil
+	}
+
+	if t.layout != "" {
+		// Layouts are composed anew for each request, so the functions can be installed in place.
+		gt, err := lookupLayout(tm.Templates, t.layout, t.named)
+		if err != nil {
+			return nil, err
+		}
+		if funcs != nil {
+			gt = gt.Funcs(funcs)
+		}
+		return recoverExecute(t.named, func(w io.Writer) error { return gt.Execute(w, data) }), nil
+	}
+
+	if funcs != nil {
+		execute, err := lookupTemplateWithFuncs(ctx, tm.Templates, t.named)
+		if err != nil {
+			return nil, err
+		}
+		return recoverExecute(t.named, func(w io.Writer) error { return execute(w, data, funcs) }), nil
+	}
+	gt, err := lookupTemplateCtx(ctx, tm.Templates, t.named)
+	if err != nil {
+		return nil, err
+	}
+	return recoverExecute(t.named, func(w io.Writer) error { return gt.Execute(w, data) }), nil
+}
+
+// templatePanicError is a panic that escaped executing a template. Panics in template functions
+// are already returned by Execute as errors naming the function; this covers the rest, such as
+// panics in the writer, along with the template that was executing.
+type templatePanicError struct {
+	template string
+	panicError
+}
+
+func (e templatePanicError) Error() string {
+	return fmt.Sprintf("panic while executing template %q: %v", e.template, e.value)
+}
+
+func (e templatePanicError) Unwrap() error {
+	return e.panicError
+}
+
+// recoverExecute returns execute with any panic it raises returned as a templatePanicError,
+// so that it is handled like any other rendering error. http.ErrAbortHandler is left alone.
+func recoverExecute(name string, execute func(w io.Writer) error) func(w io.Writer) error {
+	return func(w io.Writer) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				err = templatePanicError{template: name, panicError: panicError{value: p, stack: debug.Stack()}}
+			}
+		}()
+		return execute(w)
+	}
+}
+
+// headResponseWriter discards the body of a response to a HEAD request.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
 }
 
-func fixFiles(files []fs.DirEntry, root string) []string {
-	newFiles := []string{}
-	for _, e := range files {
-		x := e.Name()
-		if strings.ContainsAny(x, "#~") {
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writeRendered writes a fully rendered page with the given status, answering with 304 Not
+// Modified instead when ETags are enabled and the client already has the page.
+func (tm *TemplateMiddleware) writeRendered(w http.ResponseWriter, r *http.Request, status int, output []byte) {
+	if tm.Compress {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	encoding := tm.contentEncoding(r, len(output))
+	if tm.usesETag(r, status, len(output)) {
+		tag := etag(output)
+		if encoding != "" {
+			// Each encoding is a different representation and needs its own strong tag.
+			tag = strings.TrimSuffix(tag, `"`) + "-" + encoding + `"`
+		}
+		w.Header().Set("ETag", tag)
+		if etagMatches(r.Header.Get("If-None-Match"), tag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if tm.Transform != nil {
+		if transformed, err := tm.Transform(output); err == nil {
+			output = transformed
+		} else {
+			tm.logger(r).Warn("failed to transform template output; writing it untransformed", "error", err)
+		}
+	}
+	if encoding != "" {
+		buf := getRenderBuffer()
+		defer putRenderBuffer(buf)
+		cw := newCompressWriter(encoding, buf)
+		_, err := cw.Write(output)
+		if err = multierr.Combine(err, cw.Close()); err == nil {
+			w.Header().Set("Content-Encoding", encoding)
+			output = buf.Bytes()
+		} else {
+			tm.logger(r).Error("failed to compress template output", "error", err)
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(output)))
+	w.WriteHeader(status)
+	_, err := w.Write(output)
+	utils.UncheckedError(err)
+}
+
+// maxPooledRenderBuffer is the largest buffer kept for reuse, so that one huge page does not
+// pin its memory.
+const maxPooledRenderBuffer = 1 << 20
+
+var renderBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getRenderBuffer() *bytes.Buffer {
+	return renderBuffers.Get().(*bytes.Buffer)
+}
+
+func putRenderBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledRenderBuffer {
+		return
+	}
+	buf.Reset()
+	renderBuffers.Put(buf)
+}
+
+// recoverPanic renders a panic as an internal server error with the usual error templates. It must
+// be deferred. http.ErrAbortHandler is panicked again so that net/http aborts the response.
+func (tm *TemplateMiddleware) recoverPanic(w http.ResponseWriter, r *http.Request) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	stack := debug.Stack()
+	tm.logger(r).Error("panic while serving template", "panic", p, "stack", string(stack))
+
+	var err error = ErrorResponseStatus(http.StatusInternalServerError)
+	if tm.DevMode {
+		err = panicError{value: p, stack: stack}
+	}
+	defer func() {
+		// Handling the error panicked.
+		if p := recover(); p != nil {
+			tm.logger(r).Error("panic while rendering error template", "panic", p)
+			writeBasicErrorResponse(w, http.StatusInternalServerError, err)
+		}
+	}()
+	tm.handleError(w, r, err)
+}
+
+// errorTemplateFormat names the template rendered for an error status, before normalization.
+const errorTemplateFormat = "%d.html"
+
+// DefaultErrorTemplateNames returns the templates tried, in order, for an error with the given
+// status: the one named after the status, such as "404.html", then the one for its class, such
+// as "4xx.html", then "error.html".
+func DefaultErrorTemplateNames(status int) []string {
+	return []string{
+		fmt.Sprintf(errorTemplateFormat, status),
+		fmt.Sprintf("%dxx.html", status/100),
+		"error.html",
+	}
+}
+
+// lookupErrorTemplate finds the first of the error templates for status that exists, returning
+// its name and a function rendering it with the request's functions, if any.
+func (tm *TemplateMiddleware) lookupErrorTemplate(r *http.Request, status int) (string, func(w io.Writer, data interface{}) error, bool) {
+	names := DefaultErrorTemplateNames
+	if tm.ErrorTemplateNames != nil {
+		names = tm.ErrorTemplateNames
+	}
+	funcs := tm.requestFuncs(r)
+	for _, name := range names(status) {
+		name = normalizeTemplateName(tm.Templates, name)
+		if funcs != nil {
+			if execute, err := lookupTemplateWithFuncs(r.Context(), tm.Templates, name); err == nil {
+				return name, func(w io.Writer, data interface{}) error { return execute(w, data, funcs) }, true
+			}
 			continue
 		}
+		if t, err := lookupTemplateCtx(r.Context(), tm.Templates, name); err == nil {
+			return name, t.Execute, true
+		}
+	}
+	return "", nil, false
+}
+
+// ErrorTemplateData is the data error templates are rendered with.
+type ErrorTemplateData struct {
+	Status int
+	// Message is what the client may be told of the error: its message, or the public message of
+	// a DetailedErrorResponse.
+	Message string
+	Path    string
+	Method  string
+	// RequestID is the request's ID when RequestIDs is set.
+	RequestID string
+	// ErrorID identifies the error in the logs, for users to quote to support. 5xx errors have
+	// one, as do 4xx ones with ClientErrorIDs set; it is the request's ID when there is one.
+	ErrorID string
+	// Fields are the problems with the request's fields when the error is a ValidationError.
+	Fields []FieldError
+	// Err is the ErrorResponse being rendered, for templates wanting more of it than its message.
+	Err ErrorResponse
+}
 
-		newFiles = append(newFiles, filepath.Join(root, x))
+// Error returns Message, so that templates written for ErrorResponse data can use {{ .Error }}.
+func (d ErrorTemplateData) Error() string {
+	return d.Message
+}
+
+// errorTemplateData returns the data to render an error template for er with.
+func errorTemplateData(r *http.Request, er ErrorResponse, errorID string) ErrorTemplateData {
+	return ErrorTemplateData{
+		Status:    er.Status(),
+		Message:   errorMessage(er),
+		Path:      r.URL.Path,
+		Method:    r.Method,
+		RequestID: RequestID(r.Context()),
+		ErrorID:   errorID,
+		Fields:    fieldErrors(er),
+		Err:       er,
 	}
-	return newFiles
 }
 
-func baseTemplate(opts protojson.MarshalingOptions) *template.Template {
-	funcs := sprig.FuncMap()
+// handleError returns true if there was an error and the request should stop. The error is
+// rendered with ErrorRenderer if set, or else with the first of ErrorTemplateNames that exists,
+// such as "404.html" (normalized with tm.Templates' name normalizer), with ErrorTemplateData.
+// Without such a template, or if it fails to render, the error is written as plain text as by
+// HandleError. If the response was already started, the error is only logged. Unless an
+// ErrorResponse in its chain says otherwise, a context.DeadlineExceeded error is a 504, and a
+// context.Canceled one, meaning the client went away, is not rendered at all. An error raised
+// while handling another, such as a panic in an error template, is only logged and written as
+// the plain status text.
+func (tm *TemplateMiddleware) handleError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if !isErrorResponse(err) && clientGone(r, err) {
+		// There is no one to render an error for.
+		tm.logger(r).Debug("request canceled", "path", r.URL.Path, "error", err)
+		return true
+	}
+	er := asTemplateErrorResponse(err)
+	statusCode := er.Status()
+	capW := capturerOf(w)
+	if capW != nil {
+		if capW.handlingError {
+			// Rendering the first error failed; rendering this one could fail the same way.
+			tm.logger(r).Error("error while handling an error; not rendering it",
+				"status", statusCode, "error", err)
+			if !capW.wroteHeader() && !capW.wroteBody() {
+				writeBasicErrorResponse(w, statusCode, errors.New(http.StatusText(statusCode)))
+			}
+			return true
+		}
+		capW.handlingError = true
+	}
+	kind := errorKind(err)
+	defer func() {
+		tm.incError(statusCode, kind)
+	}()
+	if sent, ok := sentResponse(w); ok {
+		// Another status cannot be sent, and an error page would be appended to what was.
+		tm.logger(r).Warn("error after the response was started; not rendering it",
+			"status", sent.Status(), "error_status", statusCode, "error", err)
+		tm.onError(r, err, statusCode)
+		return true
+	}
+	logger := tm.logger(r)
+	errorID := tm.errorID(r, statusCode)
+	if errorID != "" {
+		logger = loggerWith(logger, "error_id", errorID)
+	}
+	logErrorResponseAt(logger, tm.logLevelFor(statusCode, err), statusCode, err)
+	tm.onError(r, err, statusCode)
+	setRetryAfter(w, statusCode, err)
 
-	// Support optional protoJson
-	funcs["protoJson"] = createToProtoJSON(opts)
+	// What the client is shown of err, which a DetailedErrorResponse limits to its public message.
+	shown := err
+	if public, ok := asPublicError(err); ok {
+		shown = public
+	} else if tm.SanitizeErrors && statusCode >= 500 && !isErrorResponse(err) {
+		shown = statusErrorResponse{errors.New(http.StatusText(statusCode)), statusCode}
+	}
+	if errorID != "" {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyErrorID, errorID))
+	}
+	if !tm.renderError(w, r, statusCode, shown) {
+		kind = ErrorKindErrorTemplateMissing
+	}
+	return true
+}
 
-	return template.New("app").Funcs(funcs)
+// clientGone reports whether r's client has disconnected, judging by r's context or by err
+// being the failure to write to a closed connection.
+func clientGone(r *http.Request, err error) bool {
+	return errors.Is(r.Context().Err(), context.Canceled) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// asTemplateErrorResponse is asErrorResponse, except that running out of time is a 504 Gateway
+// Timeout. An ErrorResponse in err's chain still decides the status.
+func asTemplateErrorResponse(err error) ErrorResponse {
+	if !isErrorResponse(err) && errors.Is(err, context.DeadlineExceeded) {
+		return statusErrorResponse{err, http.StatusGatewayTimeout}
+	}
+	return asErrorResponse(err)
+}
+
+// logLevelFor returns the level to log err, answered with status, at.
+func (tm *TemplateMiddleware) logLevelFor(status int, err error) Level {
+	if tm.LogLevelFor != nil {
+		return tm.LogLevelFor(status, err)
+	}
+	return DefaultLogLevelFor(status, err)
+}
+
+// onError calls OnError, if set, shielding the error response from any panic in it.
+func (tm *TemplateMiddleware) onError(r *http.Request, err error, status int) {
+	if tm.OnError == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tm.logger(r).Error("panic in OnError hook", "panic", p)
+		}
+	}()
+	tm.OnError(r, err, status)
+}
+
+func baseTemplate(opts templateManagerOptions) *template.Template {
+	funcs := template.FuncMap(opts.htmlTemplateFuncs())
+	main := template.New(opts.baseName).Delims(opts.leftDelim, opts.rightDelim).Funcs(funcs)
+	if opts.strictKeys {
+		main = main.Option("missingkey=error")
+	}
+	return main
 }
 
 // createToProtoJson returns a function to encode an item into a json inteface using the protojson marshaler.
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// templateRequest records how TemplateMiddleware served one request.
+type templateRequest struct {
+	start time.Time
+	// handlerDone is when the handler returned, or zero if it has not.
+	handlerDone time.Time
+	// template is the name of the page template the handler asked for, if any.
+	template string
+	// err is the first error rendering the response.
+	err error
+	// streaming is whether the response is sent as it is rendered.
+	streaming bool
+	// cache is "hit" or "miss" when the response was looked up in the render cache.
+	cache string
+
+	// handlerSpan and renderSpan are the open spans, if tracing.
+	handlerSpan, renderSpan TemplateSpan
+}
+
+// handlerReturned records that the handler returned t and err.
+func (req *templateRequest) handlerReturned(t *Template, err error) {
+	req.handlerDone = time.Now()
+	req.streaming = req.streaming || t != nil && t.streaming
+	switch {
+	case t == nil:
+	case t.direct != nil:
+		req.template = t.direct.Name()
+	default:
+		req.template = t.named
+	}
+	endSpan(req.handlerSpan, req.template, 0, err)
+	req.handlerSpan = nil
+}
+
+// failed records err, if it is the first error rendering the response, and returns it.
+func (req *templateRequest) failed(err error) error {
+	if req.err == nil {
+		req.err = err
+	}
+	return err
+}
+
+// durations returns how long the handler took and how long the response took after it.
+func (req *templateRequest) durations() (handler, render time.Duration) {
+	if req.handlerDone.IsZero() {
+		return time.Since(req.start), 0
+	}
+	return req.handlerDone.Sub(req.start), time.Since(req.handlerDone)
+}
+
+// finishRequest reports a request once it has been served. It must be deferred before any
+// deferred panic recovery so that it sees the response written for the panic.
+func (tm *TemplateMiddleware) finishRequest(w *responseWriterCapturer, r *http.Request, req *templateRequest) {
+	status := w.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	handlerDuration, renderDuration := req.durations()
+	// A panicking handler leaves its span open.
+	endSpan(req.handlerSpan, req.template, status, errors.New("handler panicked"))
+	endSpan(req.renderSpan, req.template, status, req.err)
+	if tm.Metrics != nil {
+		tm.Metrics.ObserveRender(req.template, status, handlerDuration, renderDuration)
+	}
+	if tm.LogRequests {
+		tm.logger(r).Info("served template request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", w.BytesWritten(),
+			"handler_duration", handlerDuration,
+			"render_duration", renderDuration,
+			"template", req.template,
+		)
+	}
+	if tm.AfterServe != nil {
+		tm.AfterServe(r, status, w.BytesWritten(), time.Since(req.start))
+	}
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareLogRequests(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"404.html":  "not found",
+	})
+	serve := func(h TemplateHandler, logRequests bool) map[string]interface{} {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, h, logger)
+		mw.LogRequests = logRequests
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/some/path", nil))
+		entries := logs.FilterMessage("served template request").All()
+		if !logRequests {
+			test.That(t, entries, test.ShouldBeEmpty)
+			return nil
+		}
+		test.That(t, entries, test.ShouldHaveLength, 1)
+		return entries[0].ContextMap()
+	}
+
+	t.Run("success", func(t *testing.T) {
+		fields := serve(staticHandler("page.html", nil, nil), true)
+		test.That(t, fields["method"], test.ShouldEqual, http.MethodGet)
+		test.That(t, fields["path"], test.ShouldEqual, "/some/path")
+		test.That(t, fields["status"], test.ShouldEqual, http.StatusOK)
+		test.That(t, fields["bytes"], test.ShouldEqual, 4)
+		test.That(t, fields["template"], test.ShouldEqual, "page.html")
+		test.That(t, fields["handler_duration"], test.ShouldHaveSameTypeAs, time.Duration(0))
+		test.That(t, fields["render_duration"], test.ShouldHaveSameTypeAs, time.Duration(0))
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		fields := serve(staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound)), true)
+		test.That(t, fields["status"], test.ShouldEqual, http.StatusNotFound)
+		test.That(t, fields["bytes"], test.ShouldEqual, len("not found"))
+		test.That(t, fields["template"], test.ShouldEqual, "page.html")
+	})
+
+	t.Run("lookup failure", func(t *testing.T) {
+		fields := serve(staticHandler("missing.html", nil, nil), true)
+		test.That(t, fields["status"], test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, fields["template"], test.ShouldEqual, "missing.html")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		serve(staticHandler("page.html", nil, nil), false)
+	})
+}
+
+func TestTemplateMiddlewareAfterServe(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"404.html":  "not found",
+	})
+	type call struct {
+		status int
+		bytes  int64
+	}
+	serve := func(h TemplateHandler) (*httptest.ResponseRecorder, []call) {
+		var calls []call
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.AfterServe = func(r *http.Request, status int, bytesWritten int64, dur time.Duration) {
+			test.That(t, r.URL.Path, test.ShouldEqual, "/path")
+			test.That(t, dur, test.ShouldBeGreaterThan, 0)
+			calls = append(calls, call{status, bytesWritten})
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/path", nil))
+		return rr, calls
+	}
+
+	t.Run("success", func(t *testing.T) {
+		_, calls := serve(staticHandler("page.html", nil, nil))
+		test.That(t, calls, test.ShouldResemble, []call{{http.StatusOK, 4}})
+	})
+
+	t.Run("handler handled", func(t *testing.T) {
+		_, calls := serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			w.WriteHeader(http.StatusAccepted)
+			_, err := w.Write([]byte("queued"))
+			return nil, nil, err
+		}))
+		test.That(t, calls, test.ShouldResemble, []call{{http.StatusAccepted, 6}})
+	})
+
+	t.Run("templated error", func(t *testing.T) {
+		_, calls := serve(staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound)))
+		test.That(t, calls, test.ShouldResemble, []call{{http.StatusNotFound, 9}})
+	})
+
+	t.Run("basic error", func(t *testing.T) {
+		rr, calls := serve(staticHandler("missing.html", nil, nil))
+		test.That(t, calls, test.ShouldResemble, []call{{http.StatusInternalServerError, int64(rr.Body.Len())}})
+		test.That(t, rr.Body.Len(), test.ShouldBeGreaterThan, 0)
+	})
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/edaniels/golog"
+)
+
+// TemplateMiddlewareOption configures the TemplateMiddlewares created by WrapTemplateHandler and
+// NewTemplateMiddlewareWithOptions.
+type TemplateMiddlewareOption interface {
+	apply(*TemplateMiddleware)
+}
+
+type funcTemplateMiddlewareOption struct {
+	f func(*TemplateMiddleware)
+}
+
+func (fmo *funcTemplateMiddlewareOption) apply(mw *TemplateMiddleware) {
+	fmo.f(mw)
+}
+
+// WithMiddlewareConfig returns a TemplateMiddlewareOption which calls configure with every
+// middleware created, to set any of its fields.
+func WithMiddlewareConfig(configure func(mw *TemplateMiddleware)) TemplateMiddlewareOption {
+	return &funcTemplateMiddlewareOption{configure}
+}
+
+// WithMiddlewareLogger returns a TemplateMiddlewareOption which has the middleware log to logger.
+func WithMiddlewareLogger(logger Logger) TemplateMiddlewareOption {
+	return &funcTemplateMiddlewareOption{func(mw *TemplateMiddleware) {
+		mw.Log = logger
+	}}
+}
+
+// NewTemplateMiddlewareWithOptions returns a TemplateMiddleware rendering with tm and h, configured
+// with opts. Unlike NewTemplateMiddleware it checks that it was given what it needs, and fills in
+// the defaults: DefaultTemplateTimeout, and a logger that discards everything unless one is set.
+func NewTemplateMiddlewareWithOptions(
+	tm TemplateManager,
+	h TemplateHandler,
+	opts ...TemplateMiddlewareOption,
+) (*TemplateMiddleware, error) {
+	mw := &TemplateMiddleware{Templates: tm, Handler: h}
+	for _, opt := range opts {
+		opt.apply(mw)
+	}
+	if err := mw.checkConfigured(); err != nil {
+		return nil, err
+	}
+	if mw.Log == nil {
+		mw.Log = GologLogger(mw.Logger)
+	}
+	if mw.Timeout == 0 {
+		mw.Timeout = DefaultTemplateTimeout
+	}
+	return mw, nil
+}
+
+// WrapTemplateHandler returns a function turning TemplateHandlers into http.Handlers that render
+// with tm, each by way of its own TemplateMiddleware configured with opts. It suits routers that
+// take plain http.Handlers and compose them with func(http.Handler) http.Handler middleware.
+func WrapTemplateHandler(tm TemplateManager, logger golog.Logger, opts ...TemplateMiddlewareOption) func(TemplateHandler) http.Handler {
+	return func(h TemplateHandler) http.Handler {
+		mw := NewTemplateMiddleware(tm, h, logger)
+		for _, opt := range opts {
+			opt.apply(mw)
+		}
+		return mw
+	}
+}
+
+// AsTemplateHandler returns a TemplateHandler that serves requests with h, such as a file server
+// or a proxy. The response h writes is sent as is; if it writes nothing, a 204 No Content is
+// sent, as for any TemplateHandler returning no template.
+func AsTemplateHandler(h http.Handler) TemplateHandler {
+	return TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		h.ServeHTTP(w, r)
+		return nil, nil, nil
+	})
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestWrapTemplateHandler(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"404.html":  "not found",
+	})
+	var logged []string
+	logging := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logged = append(logged, r.Method+" "+r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+	header := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Chained", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}
+	// chain composes middleware the way chi does, the first being outermost.
+	chain := func(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+	wrap := WrapTemplateHandler(tm, golog.NewTestLogger(t), WithMiddlewareConfig(func(mw *TemplateMiddleware) {
+		mw.ContentType = "text/html; charset=utf-8; wrapped"
+	}))
+	serve := func(h http.Handler, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	t.Run("terminal template handler", func(t *testing.T) {
+		logged = nil
+		rr := serve(chain(wrap(staticHandler("page.html", nil, nil)), logging, header), "/page")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/html; charset=utf-8; wrapped")
+		test.That(t, rr.Header().Get("X-Chained"), test.ShouldEqual, "yes")
+		test.That(t, logged, test.ShouldResemble, []string{"GET /page"})
+
+		rr = serve(chain(wrap(staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound))), logging), "/gone")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "not found")
+	})
+
+	t.Run("plain handler in the template pipeline", func(t *testing.T) {
+		plain := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			_, err := w.Write([]byte("plain"))
+			test.That(t, err, test.ShouldBeNil)
+		})
+		rr := serve(chain(wrap(AsTemplateHandler(plain)), logging), "/plain")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusAccepted)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "plain")
+
+		rr = serve(wrap(AsTemplateHandler(http.NotFoundHandler())), "/missing")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+
+		rr = serve(wrap(AsTemplateHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))), "/empty")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNoContent)
+	})
+}
+
+func TestNewTemplateMiddlewareWithOptions(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	h := staticHandler("page.html", nil, nil)
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := NewTemplateMiddlewareWithOptions(nil, h)
+		test.That(t, err, test.ShouldBeError, "template middleware has no TemplateManager")
+
+		_, err = NewTemplateMiddlewareWithOptions(tm, nil)
+		test.That(t, err, test.ShouldBeError, "template middleware has no TemplateHandler")
+
+		_, err = NewTemplateMiddlewareWithOptions(tm, h, WithMiddlewareConfig(func(mw *TemplateMiddleware) {
+			mw.Handler = nil
+		}))
+		test.That(t, err, test.ShouldBeError, "template middleware has no TemplateHandler")
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		mw, err := NewTemplateMiddlewareWithOptions(tm, h)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, mw.Timeout, test.ShouldEqual, DefaultTemplateTimeout)
+		test.That(t, mw.Log, test.ShouldResemble, Logger(nopLogger{}))
+
+		mw.Handler = staticHandler("page.html", nil, ErrorResponseStatus(http.StatusTeapot))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusTeapot)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		logger := &recordingLogger{}
+		mw, err := NewTemplateMiddlewareWithOptions(tm, h,
+			WithMiddlewareLogger(logger),
+			WithMiddlewareConfig(func(mw *TemplateMiddleware) {
+				mw.Timeout = -1
+			}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, mw.Timeout, test.ShouldEqual, time.Duration(-1))
+		test.That(t, mw.Log, test.ShouldEqual, logger)
+
+		gologger := golog.NewTestLogger(t)
+		mw, err = NewTemplateMiddlewareWithOptions(tm, h, WithMiddlewareConfig(func(mw *TemplateMiddleware) {
+			mw.Logger = gologger
+		}))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, mw.Log, test.ShouldResemble, GologLogger(gologger))
+	})
+}
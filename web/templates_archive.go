@@ -0,0 +1,33 @@
+package web
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+
+	"go.viam.com/utils"
+)
+
+// NewTemplateManagerArchive creates a TemplateManager from the zip archive of the given size read
+// from r. Templates are found with the same globs and exclusions as on the file system, including
+// in subdirectories, and are named by their slash-separated path within the archive. The
+// templates are parsed once, so r is not used after this returns. Use NewTemplateManagerFSys with
+// fs.Sub of a zip.Reader to load templates from a directory within an archive.
+func NewTemplateManagerArchive(r io.ReaderAt, size int64, tmOpts ...TemplateManagerOption) (TemplateManager, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template archive: %w", err)
+	}
+	return NewTemplateManagerFSys(zr, ".", tmOpts...)
+}
+
+// NewTemplateManagerArchiveFile creates a TemplateManager from the zip archive at path as
+// described by NewTemplateManagerArchive.
+func NewTemplateManagerArchiveFile(path string, tmOpts ...TemplateManagerOption) (TemplateManager, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template archive %s: %w", path, err)
+	}
+	defer utils.UncheckedErrorFunc(zr.Close)
+	return NewTemplateManagerFSys(zr, ".", tmOpts...)
+}
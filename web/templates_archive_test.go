@@ -0,0 +1,55 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestNewTemplateManagerArchive(t *testing.T) {
+	t.Run("lookup", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/templates.zip")
+		test.That(t, err, test.ShouldBeNil)
+		fromReader, err := NewTemplateManagerArchive(bytes.NewReader(data), int64(len(data)))
+		test.That(t, err, test.ShouldBeNil)
+		fromFile, err := NewTemplateManagerArchiveFile("testdata/templates.zip")
+		test.That(t, err, test.ShouldBeNil)
+
+		for name, tm := range map[string]TemplateManager{"reader": fromReader, "file": fromFile} {
+			tm := tm
+			t.Run(name, func(t *testing.T) {
+				test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "index header")
+				names, err := listTemplates(tm)
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, names, test.ShouldResemble, []string{"index.html", "partials/header.html"})
+			})
+		}
+	})
+
+	t.Run("corrupt archive", func(t *testing.T) {
+		data := []byte("not a zip archive")
+		_, err := NewTemplateManagerArchive(bytes.NewReader(data), int64(len(data)))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "error reading template archive")
+
+		_, err = NewTemplateManagerArchiveFile("testdata/missing.zip")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("no template files", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("docs/README.txt")
+		test.That(t, err, test.ShouldBeNil)
+		_, err = w.Write([]byte("readme"))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, zw.Close(), test.ShouldBeNil)
+
+		_, err = NewTemplateManagerArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "no template files found")
+	})
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/edaniels/golog"
+
+	"go.viam.com/utils/web/protojson"
+)
+
+// TemplateMode selects where NewTemplateManagerAuto loads templates from.
+type TemplateMode int
+
+const (
+	// TemplateModeAuto uses the live directory when asked to and it exists, and the embedded
+	// templates otherwise.
+	TemplateModeAuto TemplateMode = iota
+	// TemplateModeEmbedded always uses the embedded templates.
+	TemplateModeEmbedded
+	// TemplateModeLive always uses the live directory and fails if it does not exist.
+	TemplateModeLive
+)
+
+// WithTemplateMode returns a TemplateManagerOption which overrides the choice NewTemplateManagerAuto
+// makes from its useLive argument. It has no effect on the other constructors.
+func WithTemplateMode(mode TemplateMode) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.mode = mode
+	})
+}
+
+// NewTemplateManagerAuto creates a TemplateManager from either a live directory on the file system
+// or an embedded file system. This is meant for serving embedded templates in production while
+// editing them in place during development. When useLive is true and liveDir exists, the templates
+// are loaded as with NewTemplateManagerFS; otherwise a warning is logged if useLive was set and the
+// embedded templates are loaded as with NewTemplateManagerEmbed. Pass WithTemplateMode to force
+// one or the other.
+func NewTemplateManagerAuto(
+	embedded fs.ReadDirFS,
+	embedDir string,
+	liveDir string,
+	useLive bool,
+	tmOpts ...TemplateManagerOption,
+) (TemplateManager, error) {
+	o := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), tmOpts)
+	switch o.mode {
+	case TemplateModeAuto:
+		if !useLive {
+			break
+		}
+		if err := checkTemplateDir(liveDir); err != nil {
+			golog.Global().Warnw("live templates unavailable, using embedded templates", "dir", liveDir, "error", err)
+			break
+		}
+		return NewTemplateManagerFS(liveDir, tmOpts...)
+	case TemplateModeLive:
+		if err := checkTemplateDir(liveDir); err != nil {
+			return nil, err
+		}
+		return NewTemplateManagerFS(liveDir, tmOpts...)
+	case TemplateModeEmbedded:
+	default:
+		return nil, fmt.Errorf("unknown template mode %d", o.mode)
+	}
+	return NewTemplateManagerEmbed(embedded, embedDir, tmOpts...)
+}
+
+// checkTemplateDir returns an error unless dir is an existing directory.
+func checkTemplateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("error reading template directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("template directory %s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestNewTemplateManagerAuto(t *testing.T) {
+	liveDir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(liveDir, "index.html"), "live", time.Now())
+	missingDir := filepath.Join(liveDir, "missing")
+
+	t.Run("live dir present", func(t *testing.T) {
+		tm, err := NewTemplateManagerAuto(nestedTemplates, "testdata/nested", liveDir, true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "live")
+		_, ok := tm.(ReloadableTemplateManager)
+		test.That(t, ok, test.ShouldBeTrue)
+	})
+
+	t.Run("live dir absent falls back", func(t *testing.T) {
+		tm, err := NewTemplateManagerAuto(nestedTemplates, "testdata/nested", missingDir, true)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "top users")
+	})
+
+	t.Run("embedded only", func(t *testing.T) {
+		tm, err := NewTemplateManagerAuto(nestedTemplates, "testdata/nested", liveDir, false)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "top users")
+		test.That(t, renderTemplate(t, tm, "admin/users.html"), test.ShouldEqual, "users")
+	})
+
+	t.Run("mode overrides useLive", func(t *testing.T) {
+		tm, err := NewTemplateManagerAuto(nestedTemplates, "testdata/nested", liveDir, true, WithTemplateMode(TemplateModeEmbedded))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "top users")
+
+		tm, err = NewTemplateManagerAuto(nestedTemplates, "testdata/nested", liveDir, false, WithTemplateMode(TemplateModeLive))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "live")
+
+		_, err = NewTemplateManagerAuto(nestedTemplates, "testdata/nested", missingDir, false, WithTemplateMode(TemplateModeLive))
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
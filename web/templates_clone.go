@@ -0,0 +1,249 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sync"
+)
+
+// TemplateCloner is implemented by TemplateManagers that can hand out private copies of their
+// templates. The managers created by this package implement it.
+type TemplateCloner interface {
+	// LookupTemplateClone returns a clone of the named template that the caller owns, so it may
+	// install its own functions with Funcs without affecting other requests. Cloning copies the
+	// whole set, so prefer ExecuteWithFuncs when rendering once.
+	LookupTemplateClone(name string) (*template.Template, error)
+}
+
+// templateFuncsExecutor is implemented by the managers in this package to render with extra
+// functions using pooled clones.
+type templateFuncsExecutor interface {
+	executeWithFuncs(w io.Writer, name string, data interface{}, funcs template.FuncMap) error
+}
+
+// funcsExecute renders a template that was already looked up with data and extra functions.
+type funcsExecute func(w io.Writer, data interface{}, funcs template.FuncMap) error
+
+// templateFuncsLookup is implemented by the managers in this package to look a template up once,
+// honoring ctx, for rendering with extra functions. The returned function renders the set the
+// template was found in, even if the templates are reloaded meanwhile.
+type templateFuncsLookup interface {
+	lookupWithFuncs(ctx context.Context, name string) (funcsExecute, error)
+}
+
+// lookupTemplateWithFuncs looks the named template up in tm and returns a function rendering it
+// with extra functions, as ExecuteWithFuncs does.
+func lookupTemplateWithFuncs(ctx context.Context, tm TemplateManager, name string) (funcsExecute, error) {
+	if l, ok := tm.(templateFuncsLookup); ok {
+		return l.lookupWithFuncs(ctx, name)
+	}
+	if _, err := lookupTemplateCtx(ctx, tm, name); err != nil {
+		return nil, err
+	}
+	return func(w io.Writer, data interface{}, funcs template.FuncMap) error {
+		return ExecuteWithFuncs(tm, w, name, data, funcs)
+	}, nil
+}
+
+// ExecuteWithFuncs looks up the named template and executes it with data into w after installing
+// funcs, which replace functions of the same name for this execution only. Functions a template
+// calls must still be defined when it is parsed, for instance as placeholders passed to WithFuncs.
+// The managers in this package reuse clones of their templates across calls to keep this cheap.
+// Errors are reported as in ExecuteTo.
+func ExecuteWithFuncs(tm TemplateManager, w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	if e, ok := tm.(templateFuncsExecutor); ok {
+		return e.executeWithFuncs(w, name, data, funcs)
+	}
+	t, err := lookupTemplateClone(tm, name)
+	if err != nil {
+		return err
+	}
+	if err := t.Funcs(funcs).Execute(w, data); err != nil {
+		return &TemplateExecError{Name: name, Err: err}
+	}
+	return nil
+}
+
+// templateClones is a pool of executable clones of a template set's pristine templates.
+type templateClones struct {
+	pool sync.Pool
+
+	funcsOnce sync.Once
+	// funcs are the functions the set was parsed with, used to undo per-execution functions
+	// before a clone is reused.
+	funcs template.FuncMap
+}
+
+// clone returns a fresh clone of the named template and the rest of its set.
+func (ts *templateSet) clone(name string) (*template.Template, error) {
+	root, err := ts.pristine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return lookupTemplate(root, name)
+}
+
+// executeWithFuncs renders the named template in a pooled clone of the set with funcs installed.
+// opts must be the options the set was parsed with.
+func (ts *templateSet) executeWithFuncs(
+	w io.Writer,
+	name string,
+	data interface{},
+	funcs template.FuncMap,
+	opts templateManagerOptions,
+) error {
+	ts.clones.funcsOnce.Do(func() {
+		ts.clones.funcs = opts.htmlTemplateFuncs()
+	})
+
+	root, ok := ts.clones.pool.Get().(*template.Template)
+	if !ok {
+		var err error
+		if root, err = ts.pristine.Clone(); err != nil {
+			return err
+		}
+	}
+	t, err := lookupTemplate(root, name)
+	if err != nil {
+		ts.clones.pool.Put(root)
+		return err
+	}
+
+	t.Funcs(funcs)
+	execErr := t.Execute(w, data)
+
+	// Restore the functions the set was parsed with. A clone holding functions the set never had
+	// is dropped rather than keep whatever they reference alive.
+	reusable := true
+	original := make(template.FuncMap, len(funcs))
+	for fn := range funcs {
+		f, ok := ts.clones.funcs[fn]
+		if !ok {
+			reusable = false
+			break
+		}
+		original[fn] = f
+	}
+	if reusable {
+		root.Funcs(original)
+		ts.clones.pool.Put(root)
+	}
+
+	if execErr != nil {
+		return &TemplateExecError{Name: name, Err: execErr}
+	}
+	return nil
+}
+
+// funcsExecute returns a function rendering the named template of the set with extra functions.
+// opts must be the options the set was parsed with.
+func (ts *templateSet) funcsExecute(name string, opts templateManagerOptions) (funcsExecute, error) {
+	if _, err := ts.lookup(name); err != nil {
+		return nil, err
+	}
+	return func(w io.Writer, data interface{}, funcs template.FuncMap) error {
+		return ts.executeWithFuncs(w, name, data, funcs, opts)
+	}, nil
+}
+
+func (tm *embedTM) LookupTemplateClone(name string) (*template.Template, error) {
+	t, err := tm.cachedTemplates.clone(name)
+	tm.stats.lookedUp(err)
+	return t, err
+}
+
+func (tm *embedTM) executeWithFuncs(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	return tm.cachedTemplates.executeWithFuncs(w, name, data, funcs, tm.opts)
+}
+
+func (tm *embedTM) lookupWithFuncs(ctx context.Context, name string) (funcsExecute, error) {
+	execute, err := tm.cachedTemplates.funcsExecute(name, tm.opts)
+	tm.stats.cached(true)
+	tm.stats.lookedUp(err)
+	return execute, err
+}
+
+func (tm *fsTM) LookupTemplateClone(name string) (*template.Template, error) {
+	ts, err := tm.templates()
+	if err != nil {
+		tm.stats.lookedUp(err)
+		return nil, err
+	}
+	t, err := ts.clone(name)
+	tm.stats.lookedUp(err)
+	return t, err
+}
+
+func (tm *fsTM) executeWithFuncs(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	ts, err := tm.templates()
+	if err != nil {
+		return err
+	}
+	return ts.executeWithFuncs(w, name, data, funcs, tm.opts)
+}
+
+func (tm *fsTM) lookupWithFuncs(ctx context.Context, name string) (funcsExecute, error) {
+	ts, err := tm.templatesCtx(ctx)
+	if err != nil {
+		tm.stats.lookedUp(err)
+		return nil, err
+	}
+	execute, err := ts.funcsExecute(name, tm.opts)
+	tm.stats.lookedUp(err)
+	return execute, err
+}
+
+func (tm *watchedTM) LookupTemplateClone(name string) (*template.Template, error) {
+	return tm.templates.loaded().clone(name)
+}
+
+func (tm *watchedTM) executeWithFuncs(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	return tm.templates.loaded().executeWithFuncs(w, name, data, funcs, tm.templates.opts)
+}
+
+func (tm *watchedTM) lookupWithFuncs(ctx context.Context, name string) (funcsExecute, error) {
+	execute, err := tm.templates.loaded().funcsExecute(name, tm.templates.opts)
+	tm.templates.stats.cached(true)
+	tm.templates.stats.lookedUp(err)
+	return execute, err
+}
+
+func (tm *overlayTM) LookupTemplateClone(name string) (*template.Template, error) {
+	t, err := lookupTemplateClone(tm.primary, name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return t, err
+	}
+	return lookupTemplateClone(tm.fallback, name)
+}
+
+func (tm *overlayTM) executeWithFuncs(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	// Look the name up first so that a template missing from primary is rendered by fallback
+	// without writing anything to w.
+	if _, err := tm.primary.LookupTemplate(name); err != nil {
+		if !errors.Is(err, ErrTemplateNotFound) {
+			return err
+		}
+		return ExecuteWithFuncs(tm.fallback, w, name, data, funcs)
+	}
+	return ExecuteWithFuncs(tm.primary, w, name, data, funcs)
+}
+
+func (tm *overlayTM) lookupWithFuncs(ctx context.Context, name string) (funcsExecute, error) {
+	execute, err := lookupTemplateWithFuncs(ctx, tm.primary, name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return execute, err
+	}
+	return lookupTemplateWithFuncs(ctx, tm.fallback, name)
+}
+
+// lookupTemplateClone clones the named template from tm if tm supports it.
+func lookupTemplateClone(tm TemplateManager, name string) (*template.Template, error) {
+	c, ok := tm.(TemplateCloner)
+	if !ok {
+		return nil, fmt.Errorf("template manager does not support cloning template %s", name)
+	}
+	return c.LookupTemplateClone(name)
+}
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"sync"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestExecuteWithFuncs(t *testing.T) {
+	placeholders := WithFuncs(template.FuncMap{
+		"csrfToken": func() string { return "" },
+	})
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"form":   `<input value="{{ csrfToken }}">`,
+		"static": `static`,
+	}, placeholders)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("concurrent renders install different funcs", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				token := fmt.Sprintf("token-%d", i)
+				for j := 0; j < 20; j++ {
+					var buf bytes.Buffer
+					err := ExecuteWithFuncs(tm, &buf, "form", nil, template.FuncMap{
+						"csrfToken": func() string { return token },
+					})
+					test.That(t, err, test.ShouldBeNil)
+					test.That(t, buf.String(), test.ShouldEqual, fmt.Sprintf(`<input value="%s">`, token))
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("funcs do not leak into later renders", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := ExecuteWithFuncs(tm, &buf, "form", nil, template.FuncMap{
+			"csrfToken": func() string { return "secret" },
+			"unused":    func() string { return "" },
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "form"), test.ShouldEqual, `<input value="">`)
+
+		buf.Reset()
+		test.That(t, ExecuteWithFuncs(tm, &buf, "form", nil, nil), test.ShouldBeNil)
+		test.That(t, buf.String(), test.ShouldEqual, `<input value="">`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := ExecuteWithFuncs(tm, &buf, "missing", nil, nil)
+		test.That(t, errors.Is(err, ErrTemplateNotFound), test.ShouldBeTrue)
+
+		err = ExecuteWithFuncs(tm, &buf, "form", nil, template.FuncMap{
+			"csrfToken": func() (string, error) { return "", errors.New("no session") },
+		})
+		var execErr *TemplateExecError
+		test.That(t, errors.As(err, &execErr), test.ShouldBeTrue)
+		test.That(t, execErr.Name, test.ShouldEqual, "form")
+	})
+}
+
+func TestLookupTemplateClone(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page": `{{ upper "page" }}`})
+	// executing the shared template first must not prevent cloning.
+	test.That(t, renderTemplate(t, tm, "page"), test.ShouldEqual, "PAGE")
+
+	clone, err := tm.(TemplateCloner).LookupTemplateClone("page")
+	test.That(t, err, test.ShouldBeNil)
+	clone.Funcs(template.FuncMap{"upper": func(s string) string { return "overridden" }})
+
+	var buf bytes.Buffer
+	test.That(t, clone.Execute(&buf, nil), test.ShouldBeNil)
+	test.That(t, buf.String(), test.ShouldEqual, "overridden")
+	test.That(t, renderTemplate(t, tm, "page"), test.ShouldEqual, "PAGE")
+}
@@ -0,0 +1,34 @@
+package web
+
+import "net/http"
+
+// TemplateData is what templates are rendered with when TemplateMiddleware's CommonData is set
+// and the handler's data is not a map: the handler's data as Data and the common data as Common,
+// reachable as {{ .Data.Title }} and {{ .Common.User }}.
+type TemplateData struct {
+	Data   interface{}
+	Common map[string]interface{}
+}
+
+// withCommonData combines the handler's data with the request's common data.
+func (tm *TemplateMiddleware) withCommonData(r *http.Request, data interface{}) (interface{}, error) {
+	if tm.CommonData == nil {
+		return data, nil
+	}
+	common, err := tm.CommonData(r)
+	if err != nil {
+		return nil, err
+	}
+	handlerData, ok := data.(map[string]interface{})
+	if !ok {
+		return TemplateData{Data: data, Common: common}, nil
+	}
+	merged := make(map[string]interface{}, len(common)+len(handlerData))
+	for k, v := range common {
+		merged[k] = v
+	}
+	for k, v := range handlerData {
+		merged[k] = v
+	}
+	return merged, nil
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareCommonData(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"struct.html": "{{ .Data.Title }} for {{ .Common.User }}",
+		"map.html":    "{{ .title }} for {{ .user }}",
+		"403.html":    "forbidden",
+	})
+	serve := func(name string, data interface{}, common func(*http.Request) (map[string]interface{}, error)) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler(name, data, nil), golog.NewTestLogger(t))
+		mw.CommonData = common
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+	common := func(r *http.Request) (map[string]interface{}, error) {
+		return map[string]interface{}{"user": "alice", "title": "common title"}, nil
+	}
+
+	t.Run("struct data", func(t *testing.T) {
+		rr := serve("struct.html", struct{ Title string }{"Home"}, func(r *http.Request) (map[string]interface{}, error) {
+			return map[string]interface{}{"User": "alice"}, nil
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "Home for alice")
+	})
+
+	t.Run("map data", func(t *testing.T) {
+		data := map[string]interface{}{"title": "Home"}
+		rr := serve("map.html", data, common)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "Home for alice")
+		test.That(t, data, test.ShouldResemble, map[string]interface{}{"title": "Home"})
+	})
+
+	t.Run("hook error", func(t *testing.T) {
+		rr := serve("map.html", nil, func(r *http.Request) (map[string]interface{}, error) {
+			return nil, ErrorResponseStatus(http.StatusForbidden)
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusForbidden)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "forbidden")
+	})
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMinCompressSize is the smallest rendered page TemplateMiddleware compresses when
+// MinCompressSize is not set.
+const DefaultMinCompressSize = 1024
+
+// contentEncoding returns the encoding to compress a page of the given size rendered for r with,
+// or "" to send it as is. A negative size means the size is not known in advance.
+func (tm *TemplateMiddleware) contentEncoding(r *http.Request, size int) string {
+	if !tm.Compress {
+		return ""
+	}
+	minSize := tm.MinCompressSize
+	if minSize == 0 {
+		minSize = DefaultMinCompressSize
+	}
+	if size >= 0 && size < minSize {
+		return ""
+	}
+	return acceptedEncoding(r.Header.Get("Accept-Encoding"))
+}
+
+// acceptedEncoding returns the preferred of gzip and deflate in an Accept-Encoding header, or ""
+// if it accepts neither. gzip wins ties.
+func acceptedEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		if coding == "*" {
+			coding = "gzip"
+		}
+		if q <= 0 || (coding != "gzip" && coding != "deflate") {
+			continue
+		}
+		if q > bestQ || (q == bestQ && coding == "gzip") {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// pooledGzipWriter returns its gzip.Writer to the pool once closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+}
+
+func (w pooledGzipWriter) Close() error {
+	err := w.Writer.Close()
+	gzipWriters.Put(w.Writer)
+	return err
+}
+
+// newCompressWriter returns a writer compressing into w with the given content encoding.
+func newCompressWriter(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "deflate" {
+		// HTTP's deflate is the zlib format.
+		return zlib.NewWriter(w)
+	}
+	gz := gzipWriters.Get().(*gzip.Writer)
+	gz.Reset(w)
+	return pooledGzipWriter{gz}
+}
+
+// compressedResponseWriter sends everything written to it through a compressing writer.
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *compressedResponseWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareCompression(t *testing.T) {
+	big := strings.Repeat("compress me ", 200)
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"big.html":    big,
+		"small.html":  "small",
+		"broken.html": big + `{{ fail }}`,
+		"500.html":    "error page",
+	}, WithFuncs(template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("failed mid render") },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(name, acceptEncoding string, unbuffered bool) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler(name, nil, nil), golog.NewTestLogger(t))
+		mw.Compress = true
+		mw.Unbuffered = unbuffered
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) string {
+		t.Helper()
+		var r io.Reader = rr.Body
+		var err error
+		switch rr.Header().Get("Content-Encoding") {
+		case "gzip":
+			r, err = gzip.NewReader(rr.Body)
+		case "deflate":
+			r, err = zlib.NewReader(rr.Body)
+		}
+		test.That(t, err, test.ShouldBeNil)
+		b, err := io.ReadAll(r)
+		test.That(t, err, test.ShouldBeNil)
+		return string(b)
+	}
+
+	t.Run("with accept encoding", func(t *testing.T) {
+		rr := serve("big.html", "gzip, deflate", false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldEqual, "gzip")
+		test.That(t, rr.Header().Get("Vary"), test.ShouldEqual, "Accept-Encoding")
+		test.That(t, rr.Header().Get("Content-Length"), test.ShouldEqual, strconv.Itoa(rr.Body.Len()))
+		test.That(t, rr.Body.Len(), test.ShouldBeLessThan, len(big))
+		test.That(t, decode(t, rr), test.ShouldEqual, big)
+
+		rr = serve("big.html", "deflate", false)
+		test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldEqual, "deflate")
+		test.That(t, decode(t, rr), test.ShouldEqual, big)
+
+		rr = serve("big.html", "gzip", true)
+		test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldEqual, "gzip")
+		test.That(t, decode(t, rr), test.ShouldEqual, big)
+	})
+
+	t.Run("without accept encoding", func(t *testing.T) {
+		for _, acceptEncoding := range []string{"", "br", "gzip;q=0"} {
+			rr := serve("big.html", acceptEncoding, false)
+			test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldBeEmpty)
+			test.That(t, rr.Body.String(), test.ShouldEqual, big)
+		}
+	})
+
+	t.Run("small output is not compressed", func(t *testing.T) {
+		rr := serve("small.html", "gzip", false)
+		test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldBeEmpty)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "small")
+	})
+
+	t.Run("error mid render", func(t *testing.T) {
+		rr := serve("broken.html", "gzip", false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, decode(t, rr), test.ShouldEqual, "error page")
+
+		// unbuffered output is already on its way, so it is cut short, but the stream stays
+		// decodable.
+		rr = serve("broken.html", "gzip", true)
+		test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldEqual, "gzip")
+		body := decode(t, rr)
+		test.That(t, body, test.ShouldStartWith, "compress me")
+		test.That(t, body, test.ShouldNotContainSubstring, "error page")
+	})
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	for header, expected := range map[string]string{
+		"":                      "",
+		"gzip":                  "gzip",
+		"deflate, gzip":         "gzip",
+		"gzip;q=0.5, deflate":   "deflate",
+		"*":                     "gzip",
+		"identity, br;q=0.9":    "",
+		"gzip;q=0, deflate;q=0": "",
+	} {
+		test.That(t, acceptedEncoding(header), test.ShouldEqual, expected)
+	}
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// CSPNoncePlaceholder is replaced with the request's nonce in
+// TemplateMiddleware.ContentSecurityPolicy.
+const CSPNoncePlaceholder = "{nonce}"
+
+// cspNonceSize is the number of random bytes in a nonce.
+const cspNonceSize = 16
+
+// CSPNonce returns the Content-Security-Policy nonce generated for the request with the given
+// context by a TemplateMiddleware, or "" if there is none. Handlers that build their own
+// responses can use it for inline scripts.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(ctxKeyCSPNonce).(string)
+	return nonce
+}
+
+// newCSPNonce returns a fresh random nonce.
+func newCSPNonce() (string, error) {
+	b := make([]byte, cspNonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// URL safe characters are left as is by the HTML escaper, so the nonce renders verbatim.
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// withCSP generates a nonce for r, sets the Content-Security-Policy header with it and returns r
+// carrying it.
+func (tm *TemplateMiddleware) withCSP(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	nonce, err := newCSPNonce()
+	if err != nil {
+		return r, err
+	}
+	w.Header().Set("Content-Security-Policy", strings.ReplaceAll(tm.ContentSecurityPolicy, CSPNoncePlaceholder, nonce))
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyCSPNonce, nonce)), nil
+}
+
+// requestFuncs returns the functions to install in the template rendered for r, or nil if there
+// are none.
+func (tm *TemplateMiddleware) requestFuncs(r *http.Request) template.FuncMap {
+	var funcs template.FuncMap
+	if tm.RequestFuncs != nil {
+		funcs = tm.RequestFuncs(r)
+	}
+	if nonce := CSPNonce(r.Context()); nonce != "" {
+		if funcs == nil {
+			funcs = template.FuncMap{}
+		}
+		funcs["cspNonce"] = func() string { return nonce }
+	}
+	if id := RequestID(r.Context()); id != "" {
+		if funcs == nil {
+			funcs = template.FuncMap{}
+		}
+		funcs["requestID"] = func() string { return id }
+	}
+	if token := CSRFToken(r.Context()); token != "" {
+		if funcs == nil {
+			funcs = template.FuncMap{}
+		}
+		tm.csrfFuncs(funcs, token)
+	}
+	return funcs
+}
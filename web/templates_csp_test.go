@@ -0,0 +1,50 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareCSP(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": `<script nonce="{{ cspNonce }}">go()</script>{{ cspNonce }}`,
+	})
+	var handlerNonce string
+	h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		handlerNonce = CSPNonce(r.Context())
+		return NamedTemplate("page.html"), nil, nil
+	})
+	mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+	mw.ContentSecurityPolicy = "default-src 'self'; script-src 'nonce-{nonce}'"
+
+	serve := func() string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+
+		header := rr.Header().Get("Content-Security-Policy")
+		test.That(t, header, test.ShouldStartWith, "default-src 'self'; script-src 'nonce-")
+		nonce := strings.TrimSuffix(strings.TrimPrefix(header, "default-src 'self'; script-src 'nonce-"), "'")
+		test.That(t, len(nonce), test.ShouldBeGreaterThanOrEqualTo, 22)
+		test.That(t, rr.Body.String(), test.ShouldEqual, `<script nonce="`+nonce+`">go()</script>`+nonce)
+		test.That(t, handlerNonce, test.ShouldEqual, nonce)
+		return nonce
+	}
+
+	first := serve()
+	second := serve()
+	test.That(t, second, test.ShouldNotEqual, first)
+
+	t.Run("without a policy", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		NewTemplateMiddleware(tm, h, golog.NewTestLogger(t)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Header().Get("Content-Security-Policy"), test.ShouldBeEmpty)
+		test.That(t, rr.Body.String(), test.ShouldEqual, `<script nonce="">go()</script>`)
+	})
+}
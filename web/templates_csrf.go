@@ -0,0 +1,153 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+)
+
+// Defaults for CSRFOptions.
+const (
+	DefaultCSRFCookieName = "csrf_token"
+	DefaultCSRFFieldName  = "csrf_token"
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+)
+
+// csrfTokenSize is the number of random bytes in a token.
+const csrfTokenSize = 32
+
+// CSRFOptions configures TemplateMiddleware's CSRF protection, which uses double-submit cookies:
+// a random token is kept in a cookie and must be sent back in a form field or header with every
+// unsafe request. The zero value uses the defaults below with a cookie for path "/" that is
+// HttpOnly and SameSite=Lax.
+type CSRFOptions struct {
+	// CookieName is the cookie holding the token. Empty uses DefaultCSRFCookieName.
+	CookieName string
+	// FieldName is the form field forms submit the token in. Empty uses DefaultCSRFFieldName.
+	FieldName string
+	// HeaderName is the header scripts may send the token in instead. Empty uses
+	// DefaultCSRFHeaderName.
+	HeaderName string
+
+	// Path, Domain, MaxAge, Secure and SameSite are set on the token cookie. Empty Path uses "/"
+	// and zero SameSite uses http.SameSiteLaxMode.
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func (o *CSRFOptions) cookieName() string {
+	if o.CookieName == "" {
+		return DefaultCSRFCookieName
+	}
+	return o.CookieName
+}
+
+func (o *CSRFOptions) fieldName() string {
+	if o.FieldName == "" {
+		return DefaultCSRFFieldName
+	}
+	return o.FieldName
+}
+
+func (o *CSRFOptions) headerName() string {
+	if o.HeaderName == "" {
+		return DefaultCSRFHeaderName
+	}
+	return o.HeaderName
+}
+
+func (o *CSRFOptions) cookie(token string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     o.cookieName(),
+		Value:    token,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: true,
+		SameSite: o.SameSite,
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	return c
+}
+
+var (
+	errCSRFTokenMissing = statusErrorResponse{errors.New("missing CSRF token"), http.StatusForbidden}
+	errCSRFTokenInvalid = statusErrorResponse{errors.New("invalid CSRF token"), http.StatusForbidden}
+)
+
+// CSRFToken returns the CSRF token for the request with the given context when a
+// TemplateMiddleware with CSRF protection is serving it, or "" otherwise.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(ctxKeyCSRFToken).(string)
+	return token
+}
+
+// csrfSafeMethod reports whether requests with the given method need no token.
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// withCSRF checks the token of an unsafe request, or issues one for a safe request, and returns r
+// carrying the token.
+func (tm *TemplateMiddleware) withCSRF(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	opts := tm.CSRF
+	var token string
+	if c, err := r.Cookie(opts.cookieName()); err == nil {
+		token = c.Value
+	}
+
+	if !csrfSafeMethod(r.Method) {
+		if token == "" {
+			return r, errCSRFTokenMissing
+		}
+		submitted := r.Header.Get(opts.headerName())
+		if submitted == "" {
+			submitted = r.PostFormValue(opts.fieldName())
+		}
+		if submitted == "" {
+			return r, errCSRFTokenMissing
+		}
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			return r, errCSRFTokenInvalid
+		}
+	} else {
+		if len(token) != base64.RawURLEncoding.EncodedLen(csrfTokenSize) {
+			b := make([]byte, csrfTokenSize)
+			if _, err := rand.Read(b); err != nil {
+				return r, err
+			}
+			token = base64.RawURLEncoding.EncodeToString(b)
+		}
+		// Setting the cookie again refreshes its expiry.
+		http.SetCookie(w, opts.cookie(token))
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyCSRFToken, token)), nil
+}
+
+// csrfFuncs adds the CSRF template functions for token to funcs.
+func (tm *TemplateMiddleware) csrfFuncs(funcs template.FuncMap, token string) {
+	field := tm.CSRF.fieldName()
+	funcs["csrfToken"] = func() string { return token }
+	funcs["csrfField"] = func() template.HTML {
+		return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(field) +
+			`" value="` + template.HTMLEscapeString(token) + `">`) //nolint:gosec
+	}
+}
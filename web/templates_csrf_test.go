@@ -0,0 +1,97 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareCSRF(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"form.html": `<form>{{ csrfField }}</form>{{ csrfToken }}`,
+		"done.html": "done",
+		"403.html":  "forbidden: {{ .Error }}",
+	})
+	var handled int
+	h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		if r.Method == http.MethodGet {
+			return NamedTemplate("form.html"), nil, nil
+		}
+		handled++
+		return NamedTemplate("done.html"), nil, nil
+	})
+	mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+	mw.CSRF = &CSRFOptions{Secure: true, SameSite: http.SameSiteStrictMode}
+
+	rr := httptest.NewRecorder()
+	mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+	cookies := rr.Result().Cookies()
+	test.That(t, cookies, test.ShouldHaveLength, 1)
+	cookie := cookies[0]
+	test.That(t, cookie.Name, test.ShouldEqual, DefaultCSRFCookieName)
+	test.That(t, cookie.Secure, test.ShouldBeTrue)
+	test.That(t, cookie.HttpOnly, test.ShouldBeTrue)
+	test.That(t, cookie.SameSite, test.ShouldEqual, http.SameSiteStrictMode)
+	token := cookie.Value
+	test.That(t, token, test.ShouldNotBeEmpty)
+	test.That(t, rr.Body.String(), test.ShouldEqual,
+		`<form><input type="hidden" name="csrf_token" value="`+token+`"></form>`+token)
+
+	t.Run("token is kept across requests", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		test.That(t, rr.Result().Cookies()[0].Value, test.ShouldEqual, token)
+	})
+
+	post := func(submitted string, viaHeader bool) *httptest.ResponseRecorder {
+		form := url.Values{}
+		if submitted != "" && !viaHeader {
+			form.Set(DefaultCSRFFieldName, submitted)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if viaHeader {
+			req.Header.Set(DefaultCSRFHeaderName, submitted)
+		}
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("valid submit", func(t *testing.T) {
+		handled = 0
+		rr := post(token, false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "done")
+		rr = post(token, true)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, handled, test.ShouldEqual, 2)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		handled = 0
+		rr := post("", false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusForbidden)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "forbidden: missing CSRF token")
+		test.That(t, handled, test.ShouldEqual, 0)
+	})
+
+	t.Run("tampered token", func(t *testing.T) {
+		handled = 0
+		tampered := []byte(token)
+		tampered[0] ^= 1
+		rr := post(string(tampered), false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusForbidden)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "forbidden: invalid CSRF token")
+		test.That(t, handled, test.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,278 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+
+	"github.com/Masterminds/sprig"
+
+	"go.viam.com/utils"
+)
+
+// templateDebugger is implemented by the managers in this package to expose what
+// TemplateDebugHandler shows beyond the TemplateManager interface.
+type templateDebugger interface {
+	// templateFuncNames returns the sorted names of the functions installed in every template.
+	templateFuncNames() []string
+	// templateSource returns the source of the named template as it was parsed.
+	templateSource(name string) (string, error)
+	// templateFileContents returns the contents of the file parsed as the named template.
+	templateFileContents(name string) ([]byte, error)
+}
+
+// funcNames returns the sorted names of the functions templates parsed with o can call.
+func (o templateManagerOptions) funcNames() []string {
+	funcs := o.templateFuncs(sprig.FuncMap())
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// source returns the named template rendered back from its pristine parse tree.
+func (ts *templateSet) source(name string) (string, error) {
+	t, err := lookupTemplate(ts.pristine, name)
+	if err != nil {
+		return "", err
+	}
+	return t.Tree.Root.String(), nil
+}
+
+// fileContents returns the contents of the file parsed as the named template.
+func (ts *templateSet) fileContents(name string) ([]byte, error) {
+	if ts.src == nil {
+		return nil, errors.New("template files are not available")
+	}
+	for _, f := range ts.files {
+		if f.name == name {
+			fsys, _ := ts.src.templateFS()
+			return fs.ReadFile(fsys, f.path)
+		}
+	}
+	return nil, templateNotFoundError(name)
+}
+
+func (tm *embedTM) templateFuncNames() []string {
+	return tm.opts.funcNames()
+}
+
+func (tm *embedTM) templateSource(name string) (string, error) {
+	return tm.cachedTemplates.source(name)
+}
+
+func (tm *embedTM) templateFileContents(name string) ([]byte, error) {
+	return tm.cachedTemplates.fileContents(name)
+}
+
+func (tm *fsTM) templateFuncNames() []string {
+	return tm.opts.funcNames()
+}
+
+func (tm *fsTM) templateSource(name string) (string, error) {
+	ts, err := tm.templates()
+	if err != nil {
+		return "", err
+	}
+	return ts.source(name)
+}
+
+func (tm *fsTM) templateFileContents(name string) ([]byte, error) {
+	ts, err := tm.templates()
+	if err != nil {
+		return nil, err
+	}
+	return ts.fileContents(name)
+}
+
+func (tm *watchedTM) templateFuncNames() []string {
+	return tm.templates.templateFuncNames()
+}
+
+func (tm *watchedTM) templateSource(name string) (string, error) {
+	return tm.templates.loaded().source(name)
+}
+
+func (tm *watchedTM) templateFileContents(name string) ([]byte, error) {
+	return tm.templates.loaded().fileContents(name)
+}
+
+func (tm *overlayTM) templateFuncNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range []TemplateManager{tm.primary, tm.fallback} {
+		if d, ok := m.(templateDebugger); ok {
+			for _, name := range d.templateFuncNames() {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (tm *overlayTM) templateSource(name string) (string, error) {
+	src, err := templateSourceOf(tm.primary, name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return src, err
+	}
+	return templateSourceOf(tm.fallback, name)
+}
+
+func (tm *overlayTM) templateFileContents(name string) ([]byte, error) {
+	b, err := templateFileContentsOf(tm.primary, name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return b, err
+	}
+	return templateFileContentsOf(tm.fallback, name)
+}
+
+// templateFileContentsOf returns the contents of the file parsed as the named template if tm can
+// provide them.
+func templateFileContentsOf(tm TemplateManager, name string) ([]byte, error) {
+	d, ok := tm.(templateDebugger)
+	if !ok {
+		return nil, errors.New("template manager does not expose template files")
+	}
+	return d.templateFileContents(name)
+}
+
+// templateSourceOf returns the source of the named template if tm can provide it.
+func templateSourceOf(tm TemplateManager, name string) (string, error) {
+	d, ok := tm.(templateDebugger)
+	if !ok {
+		return "", errors.New("template manager does not expose template source")
+	}
+	return d.templateSource(name)
+}
+
+// TemplateDebugOption configures a TemplateDebugHandler.
+type TemplateDebugOption interface {
+	apply(*templateDebugOptions)
+}
+
+type templateDebugOptions struct {
+	includeSource bool
+}
+
+type funcTemplateDebugOption struct {
+	f func(*templateDebugOptions)
+}
+
+func (fdo *funcTemplateDebugOption) apply(o *templateDebugOptions) {
+	fdo.f(o)
+}
+
+// WithTemplateSource returns a TemplateDebugOption which includes the source of every template
+// in the listing. Template source is left out by default.
+func WithTemplateSource() TemplateDebugOption {
+	return &funcTemplateDebugOption{func(o *templateDebugOptions) {
+		o.includeSource = true
+	}}
+}
+
+// TemplateDebugInfo is the listing served by TemplateDebugHandler.
+type TemplateDebugInfo struct {
+	Templates []TemplateDebugEntry `json:"templates"`
+	Funcs     []string             `json:"funcs"`
+}
+
+// TemplateDebugEntry describes one template in a TemplateDebugInfo.
+type TemplateDebugEntry struct {
+	Name       string `json:"name"`
+	SourcePath string `json:"source_path,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+type templateDebugHandler struct {
+	tm   TemplateManager
+	opts templateDebugOptions
+}
+
+// TemplateDebugHandler returns an http.Handler listing every template defined by tm along with
+// the file it came from, when known, and the names of the functions templates can call. This is
+// meant for troubleshooting missing templates; it does no authentication of its own so it should
+// be mounted behind some. The listing is JSON when the request accepts application/json and an
+// HTML page otherwise.
+func TemplateDebugHandler(tm TemplateManager, opts ...TemplateDebugOption) http.Handler {
+	h := &templateDebugHandler{tm: tm}
+	for _, opt := range opts {
+		opt.apply(&h.opts)
+	}
+	return h
+}
+
+func (h *templateDebugHandler) info() (TemplateDebugInfo, error) {
+	names, err := listTemplates(h.tm)
+	if err != nil {
+		return TemplateDebugInfo{}, err
+	}
+
+	info := TemplateDebugInfo{Templates: make([]TemplateDebugEntry, 0, len(names)), Funcs: []string{}}
+	d, _ := h.tm.(templateDebugger)
+	if d != nil {
+		info.Funcs = d.templateFuncNames()
+	}
+	for _, name := range names {
+		entry := TemplateDebugEntry{Name: name}
+		// a template without a known source file is still listed.
+		if ti, err := lookupTemplateInfo(h.tm, name); err == nil {
+			entry.SourcePath = ti.SourcePath
+		}
+		if h.opts.includeSource && d != nil {
+			if entry.Source, err = d.templateSource(name); err != nil {
+				return TemplateDebugInfo{}, err
+			}
+		}
+		info.Templates = append(info.Templates, entry)
+	}
+	return info, nil
+}
+
+func (h *templateDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	info, err := h.info()
+	if err != nil {
+		writeBasicErrorResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if acceptPrefersJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/json")
+		utils.UncheckedError(json.NewEncoder(w).Encode(info))
+		return
+	}
+	w.Header().Set("Content-Type", DefaultTemplateContentType)
+	utils.UncheckedError(templateDebugPage.Execute(w, info))
+}
+
+var templateDebugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Templates</title></head>
+<body>
+<h1>Templates</h1>
+<table>
+<tr><th>Name</th><th>Source file</th></tr>
+{{- range .Templates}}
+<tr><td>{{.Name}}</td><td>{{.SourcePath}}</td></tr>
+{{- if .Source}}
+<tr><td colspan="2"><pre>{{.Source}}</pre></td></tr>
+{{- end}}
+{{- end}}
+</table>
+<h1>Functions</h1>
+<ul>
+{{- range .Funcs}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestTemplateDebugHandler(t *testing.T) {
+	tm, err := NewTemplateManagerEmbed(nestedTemplates, "testdata/nested")
+	test.That(t, err, test.ShouldBeNil)
+
+	get := func(t *testing.T, h http.Handler, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/debug/templates", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		test.That(t, w.Code, test.ShouldEqual, http.StatusOK)
+		return w
+	}
+
+	t.Run("json", func(t *testing.T) {
+		w := get(t, TemplateDebugHandler(tm), "application/json")
+		test.That(t, w.Header().Get("Content-Type"), test.ShouldEqual, "application/json")
+
+		var info TemplateDebugInfo
+		test.That(t, json.Unmarshal(w.Body.Bytes(), &info), test.ShouldBeNil)
+		test.That(t, info.Templates, test.ShouldResemble, []TemplateDebugEntry{
+			{Name: "admin/index.html", SourcePath: "testdata/nested/admin/index.html"},
+			{Name: "admin/users.html", SourcePath: "testdata/nested/admin/users.html"},
+			{Name: "index.html", SourcePath: "testdata/nested/index.html"},
+		})
+		test.That(t, info.Funcs, test.ShouldContain, "protoJson")
+		test.That(t, info.Funcs, test.ShouldContain, "upper")
+		test.That(t, w.Body.String(), test.ShouldNotContainSubstring, `"source"`)
+	})
+
+	t.Run("json with source", func(t *testing.T) {
+		w := get(t, TemplateDebugHandler(tm, WithTemplateSource()), "application/json")
+
+		var info TemplateDebugInfo
+		test.That(t, json.Unmarshal(w.Body.Bytes(), &info), test.ShouldBeNil)
+		test.That(t, info.Templates, test.ShouldHaveLength, 3)
+		test.That(t, info.Templates[1].Source, test.ShouldEqual, "users")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		w := get(t, TemplateDebugHandler(tm), "text/html")
+		test.That(t, w.Header().Get("Content-Type"), test.ShouldStartWith, "text/html")
+		test.That(t, w.Body.String(), test.ShouldContainSubstring, "<td>admin/users.html</td>")
+		test.That(t, w.Body.String(), test.ShouldContainSubstring, "<li>protoJson</li>")
+
+		// a browser listing JSON below HTML still gets the page.
+		w = get(t, TemplateDebugHandler(tm), "text/html, application/json;q=0.1")
+		test.That(t, w.Header().Get("Content-Type"), test.ShouldStartWith, "text/html")
+	})
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	pkgerrors "github.com/pkg/errors"
+
+	"go.viam.com/utils"
+)
+
+// devSourceContext is how many lines either side of a failing template line the development
+// error page shows.
+const devSourceContext = 3
+
+// panicError is what a recovered panic is handled as in development mode, so that the error page
+// can show where it happened.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// execErrorLocation matches the "template: name:line:" prefix of template execution errors.
+var execErrorLocation = regexp.MustCompile(`template: ([^:\s]+):(\d+):`)
+
+type devErrorPage struct {
+	Status     int
+	StatusText string
+	Errors     []string
+	Stack      string
+	// StackOrigin says where Stack was taken.
+	StackOrigin string
+	Source      *devSourceExcerpt
+}
+
+// stackTracer is implemented by errors from github.com/pkg/errors, which record the stack where
+// they were made.
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// devStack returns the stack trace to show for err and where it was taken: where a panic
+// happened, where the innermost error from github.com/pkg/errors in its chain was made or,
+// failing both, where it is being handled.
+func devStack(err error) (stack, origin string) {
+	var pe panicError
+	if errors.As(err, &pe) {
+		return string(pe.stack), "where the panic happened"
+	}
+	var innermost stackTracer
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if st, ok := e.(stackTracer); ok {
+			innermost = st
+		}
+	}
+	if innermost != nil {
+		return strings.TrimPrefix(fmt.Sprintf("%+v", innermost.StackTrace()), "\n"), "where the error was made"
+	}
+	return string(debug.Stack()), "where the error was handled; return errors from github.com/pkg/errors to see where they were made"
+}
+
+type devSourceExcerpt struct {
+	File  string
+	Lines []devSourceLine
+}
+
+type devSourceLine struct {
+	Number int
+	Text   string
+	Failed bool
+}
+
+var devErrorTemplate = template.Must(template.New("dev-error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Status }} {{ .StatusText }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f4f4f4; padding: 1em; overflow: auto; }
+.failed { background: #fdd; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{ .Status }} {{ .StatusText }}</h1>
+<h2>Error</h2>
+<ol>{{ range .Errors }}<li><code>{{ . }}</code></li>{{ end }}</ol>
+{{- with .Source }}
+<h2>{{ .File }}</h2>
+<pre>{{ range .Lines }}<span{{ if .Failed }} class="failed"{{ end }}>{{ printf "%4d" .Number }}  {{ .Text }}</span>
+{{ end }}</pre>
+{{- end }}
+{{- if .Stack }}
+<h2>Stack trace</h2>
+<p>Taken {{ .StackOrigin }}.</p>
+<pre>{{ .Stack }}</pre>
+{{- end }}
+</body>
+</html>
+`))
+
+// isErrorResponse reports whether err's chain holds an ErrorResponse, meaning its status was
+// chosen deliberately.
+func isErrorResponse(err error) bool {
+	_, ok := findErrorResponse(err)
+	return ok
+}
+
+// writeDevErrorPage writes the development mode diagnostic page for err.
+func (tm *TemplateMiddleware) writeDevErrorPage(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+	page := devErrorPage{
+		Status:     statusCode,
+		StatusText: http.StatusText(statusCode),
+		Source:     tm.devSource(err),
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		page.Errors = append(page.Errors, e.Error())
+	}
+	page.Stack, page.StackOrigin = devStack(err)
+
+	var buf bytes.Buffer
+	if execErr := devErrorTemplate.Execute(&buf, page); execErr != nil {
+		tm.logger(r).Error("failed to render development error page", "error", execErr)
+		writeBasicErrorResponse(w, statusCode, err)
+		return
+	}
+	setErrorHeaders(w, DefaultTemplateContentType)
+	w.WriteHeader(statusCode)
+	_, writeErr := buf.WriteTo(w)
+	utils.UncheckedError(writeErr)
+}
+
+// devSource returns the template source around where err happened, if err comes from parsing or
+// executing a template whose source is available.
+func (tm *TemplateMiddleware) devSource(err error) *devSourceExcerpt {
+	var parseErr *TemplateParseError
+	if errors.As(err, &parseErr) {
+		if parseErr.Line == 0 || parseErr.Source == nil {
+			return nil
+		}
+		return newDevSourceExcerpt(parseErr.File, parseErr.Source, parseErr.Line)
+	}
+
+	m := execErrorLocation.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+	line, _ := strconv.Atoi(m[2])
+	contents, readErr := templateFileContentsOf(tm.Templates, m[1])
+	if readErr != nil {
+		return nil
+	}
+	return newDevSourceExcerpt(m[1], contents, line)
+}
+
+func newDevSourceExcerpt(file string, contents []byte, line int) *devSourceExcerpt {
+	lines := strings.Split(string(contents), "\n")
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	excerpt := &devSourceExcerpt{File: file}
+	first, last := line-devSourceContext, line+devSourceContext
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	for n := first; n <= last; n++ {
+		excerpt.Lines = append(excerpt.Lines, devSourceLine{Number: n, Text: lines[n-1], Failed: n == line})
+	}
+	return excerpt
+}
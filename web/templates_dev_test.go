@@ -0,0 +1,87 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edaniels/golog"
+	pkgerrors "github.com/pkg/errors"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareDevMode(t *testing.T) {
+	dir := t.TempDir()
+	test.That(t, os.WriteFile(filepath.Join(dir, "page.html"), []byte("<ul>\n<li>first</li>\n<li>{{ index .Items 5 }}</li>\n</ul>\n"), 0o600), test.ShouldBeNil)
+	test.That(t, os.WriteFile(filepath.Join(dir, "404.html"), []byte("not found"), 0o600), test.ShouldBeNil)
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	data := map[string]interface{}{"Items": []string{"a"}}
+	serve := func(h TemplateHandler, devMode bool) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.DevMode = devMode
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+	panicking := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		panic("boom")
+	})
+
+	t.Run("dev", func(t *testing.T) {
+		rr := serve(staticHandler("page.html", data, nil), true)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, DefaultTemplateContentType)
+		body := rr.Body.String()
+		test.That(t, body, test.ShouldContainSubstring, "Stack trace")
+		test.That(t, body, test.ShouldContainSubstring, "index out of range")
+		test.That(t, body, test.ShouldContainSubstring, `<span class="failed">   3  &lt;li&gt;{{ index .Items 5 }}&lt;/li&gt;</span>`)
+		test.That(t, body, test.ShouldContainSubstring, "   1  &lt;ul&gt;")
+
+		rr = serve(panicking, true)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "panic: boom")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "Stack trace")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "goroutine")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "TestTemplateMiddlewareDevMode")
+
+		rr = serve(staticHandler("page.html", nil, errors.New("plain failure")), true)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "plain failure")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "Stack trace")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "where the error was handled")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "goroutine")
+
+		rr = serve(staticHandler("page.html", nil, fmt.Errorf("loading: %w", newStackError())), true)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "where the error was made")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "web.newStackError")
+
+		rr = serve(staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound)), true)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "not found")
+	})
+
+	t.Run("prod", func(t *testing.T) {
+		for _, h := range []TemplateHandler{
+			staticHandler("page.html", data, nil),
+			panicking,
+			staticHandler("page.html", nil, errors.New("plain failure")),
+			staticHandler("page.html", nil, newStackError()),
+		} {
+			rr := serve(h, false)
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+			test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "goroutine")
+			test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "Stack trace")
+		}
+	})
+}
+
+// newStackError returns an error recording the stack it was made at.
+func newStackError() error {
+	return pkgerrors.New("stack failure")
+}
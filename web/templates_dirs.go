@@ -0,0 +1,105 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// mergedFS presents several file systems as one. When more than one contains a path, the last
+// one wins, and directory listings are the union of every file system's listing.
+type mergedFS []fs.FS
+
+func (m mergedFS) Open(name string) (fs.File, error) {
+	for i := len(m) - 1; i >= 0; i-- {
+		f, err := m[i].Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m mergedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	byName := map[string]fs.DirEntry{}
+	found := false
+	for _, fsys := range m {
+		entries, err := fs.ReadDir(fsys, name)
+		// a subdirectory need only exist in some of the file systems, but every root must exist.
+		if errors.Is(err, fs.ErrNotExist) && name != "." {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, e := range entries {
+			byName[e.Name()] = e
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+type dirsTemplateSource []string
+
+func (s dirsTemplateSource) templateFS() (fs.FS, string) {
+	fsys := make(mergedFS, 0, len(s))
+	for _, dir := range s {
+		fsys = append(fsys, os.DirFS(dir))
+	}
+	return fsys, "."
+}
+
+func (s dirsTemplateSource) static() bool {
+	return false
+}
+
+func (s dirsTemplateSource) sourcePath(p string) string {
+	for i := len(s) - 1; i > 0; i-- {
+		candidate := filepath.Join(s[i], filepath.FromSlash(p))
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return filepath.Join(s[0], filepath.FromSlash(p))
+}
+
+// DirsTemplateSource returns a TemplateSource for several directories on the file system whose
+// files are parsed into one template set as if they were a single directory. When the same
+// relative path exists in more than one directory, the file from the later directory is used.
+// Like DirTemplateSource, the templates are reparsed whenever the files change.
+func DirsTemplateSource(srcDirs ...string) TemplateSource {
+	return dirsTemplateSource(append([]string(nil), srcDirs...))
+}
+
+// NewTemplateManagerFSDirs creates a new TemplateManager from several directories on the file
+// system, with later directories overriding earlier ones as described by DirsTemplateSource.
+// Every directory must exist. It is NewTemplateManagerFS for more than one directory, which
+// takes a slice because the options are already variadic.
+func NewTemplateManagerFSDirs(srcDirs []string, tmOpts ...TemplateManagerOption) (TemplateManager, error) {
+	if len(srcDirs) == 0 {
+		return nil, errors.New("at least one template directory is required")
+	}
+	for _, dir := range srcDirs {
+		if err := checkTemplateDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	return NewTemplateManager(DirsTemplateSource(srcDirs...), tmOpts...)
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestNewTemplateManagerFSDirs(t *testing.T) {
+	shared := t.TempDir()
+	site := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, filepath.Join(shared, "layout.html"), `shared layout {{ template "nav.html" }}`, modTime)
+	writeTemplateFile(t, filepath.Join(shared, "nav.html"), `shared nav`, modTime)
+	test.That(t, os.Mkdir(filepath.Join(shared, "partials"), 0o700), test.ShouldBeNil)
+	writeTemplateFile(t, filepath.Join(shared, "partials", "footer.html"), `shared footer`, modTime)
+	writeTemplateFile(t, filepath.Join(site, "nav.html"), `site nav`, modTime)
+	writeTemplateFile(t, filepath.Join(site, "page.html"), `page {{ template "partials/footer.html" }}`, modTime)
+
+	tm, err := NewTemplateManagerFSDirs([]string{shared, site})
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("later directories override earlier ones", func(t *testing.T) {
+		test.That(t, renderTemplate(t, tm, "layout.html"), test.ShouldEqual, "shared layout site nav")
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page shared footer")
+
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"layout.html", "nav.html", "page.html", "partials/footer.html"})
+
+		info, err := lookupTemplateInfo(tm, "nav.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, filepath.Join(site, "nav.html"))
+		info, err = lookupTemplateInfo(tm, "layout.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, filepath.Join(shared, "layout.html"))
+	})
+
+	t.Run("changes in any directory are picked up", func(t *testing.T) {
+		writeTemplateFile(t, filepath.Join(shared, "partials", "footer.html"), `new footer`, modTime.Add(time.Minute))
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page new footer")
+
+		test.That(t, os.Remove(filepath.Join(site, "nav.html")), test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "layout.html"), test.ShouldEqual, "shared layout shared nav")
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing")
+		_, err := NewTemplateManagerFSDirs([]string{shared, missing})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err, test.ShouldWrap, fs.ErrNotExist)
+		test.That(t, err.Error(), test.ShouldContainSubstring, missing)
+
+		_, err = NewTemplateManagerFSDirs(nil)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("directory removed after construction", func(t *testing.T) {
+		gone := t.TempDir()
+		writeTemplateFile(t, filepath.Join(gone, "gone.html"), `gone`, modTime)
+		tm, err := NewTemplateManagerFSDirs([]string{shared, gone})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "gone.html"), test.ShouldEqual, "gone")
+
+		test.That(t, os.RemoveAll(gone), test.ShouldBeNil)
+		_, err = tm.LookupTemplate("nav.html")
+		test.That(t, err, test.ShouldWrap, fs.ErrNotExist)
+	})
+}
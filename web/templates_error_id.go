@@ -0,0 +1,36 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// errorIDBytes is the number of random bytes in a generated error ID.
+const errorIDBytes = 6
+
+// newErrorID returns a random ID for an error.
+func newErrorID() (string, error) {
+	b := make([]byte, errorIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// errorID returns the ID to show and log for an error with the given status, or "" if it gets
+// none. The request's ID is used when it has one.
+func (tm *TemplateMiddleware) errorID(r *http.Request, status int) string {
+	if status < 500 && !(tm.ClientErrorIDs && status >= 400) {
+		return ""
+	}
+	if id := RequestID(r.Context()); id != "" {
+		return id
+	}
+	id, err := newErrorID()
+	if err != nil {
+		tm.logger(r).Error("failed to generate error ID", "error", err)
+		return ""
+	}
+	return id
+}
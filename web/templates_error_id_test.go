@@ -0,0 +1,90 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareErrorIDs(t *testing.T) {
+	withTemplate := mustTemplateManagerFromMap(t, map[string]string{
+		"500.html": "something broke; quote {{ .ErrorID }}",
+		"4xx.html": "client error [{{ .ErrorID }}]",
+	})
+	plain := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	accept := "text/html"
+	serve := func(tm TemplateManager, handlerErr error, configure func(*TemplateMiddleware)) (*httptest.ResponseRecorder, []map[string]interface{}) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), logger)
+		if configure != nil {
+			configure(mw)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "incoming-id")
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		var fields []map[string]interface{}
+		for _, entry := range logs.All() {
+			fields = append(fields, entry.ContextMap())
+		}
+		return rr, fields
+	}
+	errorID := regexp.MustCompile(`[0-9a-f]{12}`)
+
+	t.Run("template", func(t *testing.T) {
+		rr, logged := serve(withTemplate, errors.New("boom"), nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		id := errorID.FindString(rr.Body.String())
+		test.That(t, id, test.ShouldNotBeEmpty)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "something broke; quote "+id)
+		test.That(t, logged, test.ShouldHaveLength, 1)
+		test.That(t, logged[0]["error_id"], test.ShouldEqual, id)
+
+		rr2, _ := serve(withTemplate, errors.New("boom"), nil)
+		test.That(t, errorID.FindString(rr2.Body.String()), test.ShouldNotEqual, id)
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		rr, logged := serve(plain, errors.New("boom"), nil)
+		id := errorID.FindString(rr.Body.String())
+		test.That(t, rr.Body.String(), test.ShouldEqual, "boom\nerror ID: "+id+"\n")
+		test.That(t, logged[0]["error_id"], test.ShouldEqual, id)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		accept = "application/json"
+		defer func() { accept = "text/html" }()
+		rr, logged := serve(plain, errors.New("boom"), nil)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "application/json")
+		id := errorID.FindString(rr.Body.String())
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, `"error_id":"`+id+`"`)
+		test.That(t, logged[0]["error_id"], test.ShouldEqual, id)
+	})
+
+	t.Run("request ID", func(t *testing.T) {
+		rr, logged := serve(withTemplate, errors.New("boom"), func(mw *TemplateMiddleware) {
+			mw.RequestIDs = true
+		})
+		test.That(t, rr.Body.String(), test.ShouldEqual, "something broke; quote incoming-id")
+		test.That(t, logged[0]["error_id"], test.ShouldEqual, "incoming-id")
+	})
+
+	t.Run("client errors", func(t *testing.T) {
+		rr, logged := serve(withTemplate, ErrNotFound, nil)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "client error []")
+		test.That(t, logged[0], test.ShouldNotContainKey, "error_id")
+
+		rr, logged = serve(withTemplate, ErrNotFound, func(mw *TemplateMiddleware) {
+			mw.ClientErrorIDs = true
+		})
+		id := errorID.FindString(rr.Body.String())
+		test.That(t, rr.Body.String(), test.ShouldEqual, "client error ["+id+"]")
+		test.That(t, logged[0]["error_id"], test.ShouldEqual, id)
+	})
+}
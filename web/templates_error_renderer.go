@@ -0,0 +1,115 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.viam.com/utils"
+)
+
+// An ErrorRenderer writes the response for an error TemplateMiddleware answers with status. err
+// is what the client may be shown of the error: the public error of a DetailedErrorResponse, or
+// the status text of a 5xx error hidden by SanitizeErrors. The full error has been logged and
+// passed to OnError by then. The request's context carries the error's ID, if it has one, for
+// ErrorID.
+type ErrorRenderer interface {
+	RenderError(w http.ResponseWriter, r *http.Request, status int, err error)
+}
+
+// ErrorRendererFunc the func version of the ErrorRenderer.
+type ErrorRendererFunc func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// RenderError calls f(w, r, status, err).
+func (f ErrorRendererFunc) RenderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	f(w, r, status, err)
+}
+
+// ErrorID returns the ID given to the error being rendered with ctx, or "" if it has none.
+func ErrorID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyErrorID).(string)
+	return id
+}
+
+// DefaultErrorRenderer returns the ErrorRenderer tm uses when its ErrorRenderer is not set: a
+// JSON body for clients that want one, the DevMode page, the first of ErrorTemplateNames that
+// exists and, failing that, plain text. A custom ErrorRenderer can fall back to it.
+func (tm *TemplateMiddleware) DefaultErrorRenderer() ErrorRenderer {
+	return templateErrorRenderer{tm}
+}
+
+type templateErrorRenderer struct {
+	tm *TemplateMiddleware
+}
+
+func (er templateErrorRenderer) RenderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	er.render(w, r, status, err)
+}
+
+// render writes the error and reports whether it found an error template when it needed one.
+func (er templateErrorRenderer) render(w http.ResponseWriter, r *http.Request, status int, err error) bool {
+	tm := er.tm
+	errorID := ErrorID(r.Context())
+	if tm.wantsJSONError(r) {
+		writeJSONError(w, status, err, errorID)
+		return true
+	}
+	if tm.DevMode && !tm.SanitizeErrors && !isErrorResponse(err) {
+		tm.writeDevErrorPage(w, r, status, err)
+		return true
+	}
+
+	found := false
+	if name, execute, ok := tm.lookupErrorTemplate(r, status); ok {
+		found = true
+		resp := asTemplateErrorResponse(err)
+		if resp.Status() != status {
+			resp = statusErrorResponse{err, status}
+		}
+		data := errorTemplateData(r, resp, errorID)
+		// The template is rendered in full before anything is written, so that if it fails the
+		// plain text response is all the client gets.
+		var buf bytes.Buffer
+		execErr := recoverExecute(name, func(out io.Writer) error { return execute(out, data) })(&buf)
+		if execErr == nil {
+			setErrorHeaders(w, DefaultTemplateContentType)
+			w.WriteHeader(status)
+			_, writeErr := buf.WriteTo(w)
+			utils.UncheckedError(writeErr)
+			return true
+		}
+		tm.logger(r).Error("failed to render error template", "template", name, "error", execErr)
+	}
+
+	if errorID != "" {
+		err = fmt.Errorf("%s\nerror ID: %s", errorMessage(err), errorID)
+	}
+	writeBasicErrorResponse(w, status, err)
+	return found
+}
+
+// renderError writes the response for err with ErrorRenderer, or the default renderer, and
+// reports whether an error template was found when one was needed. A panic in a custom
+// ErrorRenderer is logged and, if the response was not started, answered with plain text.
+func (tm *TemplateMiddleware) renderError(w http.ResponseWriter, r *http.Request, status int, err error) bool {
+	if tm.ErrorRenderer == nil {
+		return templateErrorRenderer{tm}.render(w, r, status, err)
+	}
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		if p == http.ErrAbortHandler {
+			panic(p)
+		}
+		tm.logger(r).Error("panic in ErrorRenderer", "panic", p, "error", err)
+		if _, sent := sentResponse(w); !sent {
+			writeBasicErrorResponse(w, status, err)
+		}
+	}()
+	tm.ErrorRenderer.RenderError(w, r, status, err)
+	return true
+}
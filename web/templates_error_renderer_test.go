@@ -0,0 +1,141 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareErrorRenderer(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"500.html":  "error page",
+	})
+	serve := func(handlerErr error, renderer ErrorRenderer, configure func(*TemplateMiddleware)) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), golog.NewTestLogger(t))
+		mw.ErrorRenderer = renderer
+		if configure != nil {
+			configure(mw)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	t.Run("custom", func(t *testing.T) {
+		var gotStatus int
+		var gotErr error
+		var gotID string
+		renderer := ErrorRendererFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			gotStatus, gotErr, gotID = status, err, ErrorID(r.Context())
+			w.Header().Set("Content-Type", "text/x-component")
+			w.WriteHeader(status)
+			w.Write([]byte("component: " + err.Error()))
+		})
+		var reported error
+		rr := serve(errors.New("db down"), renderer, func(mw *TemplateMiddleware) {
+			mw.OnError = func(r *http.Request, err error, status int) { reported = err }
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/x-component")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "component: db down")
+		test.That(t, gotStatus, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, gotErr.Error(), test.ShouldEqual, "db down")
+		test.That(t, gotID, test.ShouldNotBeEmpty)
+		test.That(t, reported, test.ShouldNotBeNil)
+
+		rr = serve(ErrNotFound, renderer, nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, gotID, test.ShouldBeEmpty)
+
+		// SanitizeErrors still applies to what the renderer is given.
+		rr = serve(errors.New("db down"), renderer, func(mw *TemplateMiddleware) { mw.SanitizeErrors = true })
+		test.That(t, rr.Body.String(), test.ShouldEqual, "component: Internal Server Error")
+	})
+
+	t.Run("falls back to the default", func(t *testing.T) {
+		var mw *TemplateMiddleware
+		renderer := ErrorRendererFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			mw.DefaultErrorRenderer().RenderError(w, r, status, err)
+		})
+		rr := serve(errors.New("boom"), renderer, func(m *TemplateMiddleware) { mw = m })
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+	})
+
+	t.Run("panicking", func(t *testing.T) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, ErrConflict), logger)
+		mw.ErrorRenderer = ErrorRendererFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			panic("renderer broke")
+		})
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusConflict)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/plain; charset=utf-8")
+		test.That(t, rr.Body.String(), test.ShouldEqual, ErrConflict.Error()+"\n")
+		test.That(t, logs.FilterMessage("panic in ErrorRenderer").Len(), test.ShouldEqual, 1)
+
+		// A renderer that started the response before panicking is left with what it wrote.
+		mw.ErrorRenderer = ErrorRendererFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("partial"))
+			panic("renderer broke")
+		})
+		rr = httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusTeapot)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "partial")
+	})
+}
+
+func TestTemplateMiddlewareBrokenErrorTemplate(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"500.html":  "<h1>Something broke</h1>{{ .Err.Nope }}",
+		"4xx.html":  "<h1>{{ .Status }}</h1>{{ index .Path 99 }}",
+	})
+	serve := func(handlerErr error) (*httptest.ResponseRecorder, int) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), logger)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, logs.FilterMessage("failed to render error template").Len()
+	}
+
+	rr, failures := serve(errors.New("boom"))
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+	test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/plain; charset=utf-8")
+	test.That(t, rr.Body.String(), test.ShouldStartWith, "boom\nerror ID: ")
+	test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "<h1>")
+	test.That(t, failures, test.ShouldEqual, 1)
+
+	rr, failures = serve(ErrNotFound)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+	test.That(t, rr.Body.String(), test.ShouldEqual, ErrNotFound.Error()+"\n")
+	test.That(t, failures, test.ShouldEqual, 1)
+}
+
+func TestTemplateMiddlewareNestedError(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html":  "page",
+		"error.html": "error page",
+	})
+	logger, logs := golog.NewObservedTestLogger(t)
+	mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, ErrBadRequest), logger)
+	var nested bool
+	mw.ErrorRenderer = ErrorRendererFunc(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		// Handling an error while one is handled must not render, or recurse, again.
+		nested = mw.handleError(w, r, errors.New("renderer failed"))
+	})
+	rr := httptest.NewRecorder()
+	mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	test.That(t, nested, test.ShouldBeTrue)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "Internal Server Error\n")
+	test.That(t, logs.FilterMessage("error while handling an error; not rendering it").Len(), test.ShouldEqual, 1)
+}
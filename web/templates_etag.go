@@ -0,0 +1,45 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxETagSize is the largest page TemplateMiddleware computes an ETag for when
+// MaxETagSize is not set.
+const DefaultMaxETagSize = 1 << 20
+
+// etag returns a strong entity tag for output.
+func etag(output []byte) string {
+	sum := sha256.Sum256(output)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// usesETag reports whether a page rendered for r with the given status and size gets an ETag.
+func (tm *TemplateMiddleware) usesETag(r *http.Request, status, size int) bool {
+	if !tm.ETags || status != http.StatusOK {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	maxSize := tm.MaxETagSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxETagSize
+	}
+	return maxSize < 0 || size <= maxSize
+}
+
+// etagMatches reports whether an If-None-Match header matches tag. As RFC 7232 requires for
+// If-None-Match, weak tags in the header match too.
+func etagMatches(ifNoneMatch, tag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareETags(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"big.html":  strings.Repeat("x", 100),
+	})
+	serve := func(name, method, ifNoneMatch string, configure func(*TemplateMiddleware)) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler(name, nil, nil), golog.NewTestLogger(t))
+		mw.ETags = true
+		if configure != nil {
+			configure(mw)
+		}
+		req := httptest.NewRequest(method, "/", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := serve("page.html", http.MethodGet, "", nil)
+	test.That(t, first.Code, test.ShouldEqual, http.StatusOK)
+	tag := first.Header().Get("ETag")
+	test.That(t, tag, test.ShouldStartWith, `"`)
+	test.That(t, first.Body.String(), test.ShouldEqual, "page")
+
+	t.Run("match", func(t *testing.T) {
+		rr := serve("page.html", http.MethodGet, tag, nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotModified)
+		test.That(t, rr.Body.Len(), test.ShouldEqual, 0)
+		test.That(t, rr.Header().Get("ETag"), test.ShouldEqual, tag)
+
+		rr = serve("page.html", http.MethodHead, `"other", W/`+tag, nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotModified)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		rr := serve("page.html", http.MethodGet, `"stale"`, nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+	})
+
+	t.Run("post is excluded", func(t *testing.T) {
+		rr := serve("page.html", http.MethodPost, tag, nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Get("ETag"), test.ShouldBeEmpty)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+	})
+
+	t.Run("non-200 and oversized responses are excluded", func(t *testing.T) {
+		mw := NewTemplateMiddleware(tm, TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate("page.html").WithStatus(http.StatusCreated), nil, nil
+		}), golog.NewTestLogger(t))
+		mw.ETags = true
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusCreated)
+		test.That(t, rr.Header().Get("ETag"), test.ShouldBeEmpty)
+
+		rr = serve("big.html", http.MethodGet, "", func(mw *TemplateMiddleware) { mw.MaxETagSize = 50 })
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Get("ETag"), test.ShouldBeEmpty)
+	})
+}
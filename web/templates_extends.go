@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"text/template/parse"
+)
+
+// ExtendsTemplate is the name of the block a template file defines to extend a layout, as in
+// {{define "extends"}}base.html{{end}}. The file is then rendered as the named layout with the
+// file as the layout's LayoutContentTemplate. Layouts may themselves extend other layouts.
+const ExtendsTemplate = "extends"
+
+// extendsPartPrefix prefixes the names of the templates that make up a resolved inheritance chain.
+const extendsPartPrefix = ExtendsTemplate + ":"
+
+// isInternalTemplateName reports whether name is only used to implement template inheritance and
+// should be hidden from template listings.
+func isInternalTemplateName(name string) bool {
+	return name == ExtendsTemplate || strings.HasPrefix(name, extendsPartPrefix)
+}
+
+// templateExtends returns the layout the file just parsed as name into main extends, if any.
+// It must be called before the next file is parsed since that file may redefine ExtendsTemplate.
+func templateExtends(main *template.Template, name string) (string, error) {
+	t := main.Lookup(ExtendsTemplate)
+	if t == nil || t.Tree == nil || t.Tree.ParseName != name {
+		return "", nil
+	}
+	var layout strings.Builder
+	for _, n := range t.Tree.Root.Nodes {
+		text, ok := n.(*parse.TextNode)
+		if !ok {
+			return "", fmt.Errorf("%s block of %s must only contain the name of a template", ExtendsTemplate, name)
+		}
+		layout.Write(text.Text)
+	}
+	return strings.TrimSpace(layout.String()), nil
+}
+
+// resolveExtends replaces every file template that extends a layout with its fully resolved
+// inheritance chain, so looking it up returns the outermost layout rendering the file within it.
+func resolveExtends(main *template.Template, files []templateFile) error {
+	extends := map[string]string{}
+	for _, f := range files {
+		if f.extends != "" {
+			extends[f.name] = f.extends
+		}
+	}
+	if len(extends) == 0 {
+		return nil
+	}
+
+	// resolve against the original trees, before any are replaced.
+	trees := map[string]*parse.Tree{}
+	for _, t := range main.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree.Copy()
+		}
+	}
+
+	for _, f := range files {
+		if f.extends == "" {
+			continue
+		}
+		chain := []string{f.name}
+		for layout := f.extends; layout != ""; layout = extends[layout] {
+			for _, name := range chain {
+				if name == layout {
+					return fmt.Errorf("template inheritance cycle: %s", strings.Join(append(chain, layout), " -> "))
+				}
+			}
+			if trees[layout] == nil {
+				return fmt.Errorf("template %s extends unknown template %s", chain[len(chain)-1], layout)
+			}
+			chain = append(chain, layout)
+		}
+
+		// each level renders the one before it in place of its content.
+		content := ""
+		for i, name := range chain {
+			tree := trees[name].Copy()
+			if content != "" {
+				renameTemplateCalls(tree.Root, LayoutContentTemplate, content)
+			}
+			partName := fmt.Sprintf("%s%s:%d", extendsPartPrefix, f.name, i)
+			if i == len(chain)-1 {
+				partName = f.name
+				// report the extending file as the source of the resolved template.
+				tree.ParseName = f.name
+			}
+			tree.Name = partName
+			if _, err := main.AddParseTree(partName, tree); err != nil {
+				return err
+			}
+			content = partName
+		}
+	}
+	return nil
+}
+
+// renameTemplateCalls changes every {{template from}} beneath node to {{template to}}.
+func renameTemplateCalls(node parse.Node, from, to string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			renameTemplateCalls(child, from, to)
+		}
+	case *parse.TemplateNode:
+		if n.Name == from {
+			n.Name = to
+		}
+	case *parse.IfNode:
+		renameTemplateCalls(n.List, from, to)
+		renameTemplateCalls(n.ElseList, from, to)
+	case *parse.RangeNode:
+		renameTemplateCalls(n.List, from, to)
+		renameTemplateCalls(n.ElseList, from, to)
+	case *parse.WithNode:
+		renameTemplateCalls(n.List, from, to)
+		renameTemplateCalls(n.ElseList, from, to)
+	}
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestTemplateExtends(t *testing.T) {
+	files := map[string]string{
+		"base.html":    `<html>{{ block "content" . }}default{{ end }}</html>`,
+		"page.html":    `{{ define "extends" }}base.html{{ end }}page {{ . }}`,
+		"section.html": `{{ define "extends" }} base.html {{ end }}<section>{{ if . }}{{ template "content" . }}{{ end }}</section>`,
+		"article.html": `{{ define "extends" }}section.html{{ end }}article {{ . }}`,
+		"plain.html":   `plain {{ template "page.html" "nested" }}`,
+	}
+	fsys := fstest.MapFS{}
+	dir := t.TempDir()
+	for name, contents := range files {
+		fsys["templates/"+name] = &fstest.MapFile{Data: []byte(contents)}
+		writeTemplateFile(t, filepath.Join(dir, name), contents, time.Now())
+	}
+	embedTM, err := NewTemplateManagerEmbed(fsys, "templates")
+	test.That(t, err, test.ShouldBeNil)
+	dirTM, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+	mapTM, err := NewTemplateManagerFromMap(files)
+	test.That(t, err, test.ShouldBeNil)
+
+	render := func(t *testing.T, tm TemplateManager, name string, data interface{}) string {
+		t.Helper()
+		out, err := ExecuteToString(tm, name, data)
+		test.That(t, err, test.ShouldBeNil)
+		return out
+	}
+
+	for name, tm := range map[string]TemplateManager{"embed": embedTM, "fs": dirTM, "map": mapTM} {
+		tm := tm
+		t.Run(name, func(t *testing.T) {
+			// two levels
+			test.That(t, render(t, tm, "page.html", "x"), test.ShouldEqual, "<html>page x</html>")
+			// three levels
+			test.That(t, render(t, tm, "article.html", "y"), test.ShouldEqual, "<html><section>article y</section></html>")
+			test.That(t, render(t, tm, "section.html", "z"), test.ShouldEqual, "<html><section>default</section></html>")
+			test.That(t, render(t, tm, "base.html", nil), test.ShouldEqual, "<html>default</html>")
+			test.That(t, render(t, tm, "plain.html", nil), test.ShouldEqual, "plain <html>page nested</html>")
+
+			names, err := listTemplates(tm)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, names, test.ShouldResemble, []string{
+				"article.html", "base.html", "content", "page.html", "plain.html", "section.html",
+			})
+
+			info, err := lookupTemplateInfo(tm, "article.html")
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, info.SourcePath, test.ShouldEndWith, "article.html")
+		})
+	}
+
+	t.Run("cycles are reported with the chain", func(t *testing.T) {
+		_, err := NewTemplateManagerFromMap(map[string]string{
+			"a.html": `{{ define "extends" }}b.html{{ end }}a`,
+			"b.html": `{{ define "extends" }}c.html{{ end }}b`,
+			"c.html": `{{ define "extends" }}a.html{{ end }}c`,
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldEqual, "template inheritance cycle: a.html -> b.html -> c.html -> a.html")
+
+		_, err = NewTemplateManagerFromMap(map[string]string{
+			"self.html": `{{ define "extends" }}self.html{{ end }}self`,
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldEqual, "template inheritance cycle: self.html -> self.html")
+	})
+
+	t.Run("unknown layouts are reported", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(fstest.MapFS{
+			"templates/page.html": &fstest.MapFile{Data: []byte(`{{ define "extends" }}missing.html{{ end }}page`)},
+		}, "templates")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "template page.html extends unknown template missing.html")
+	})
+
+	t.Run("extends must be a plain name", func(t *testing.T) {
+		_, err := NewTemplateManagerFromMap(map[string]string{
+			"page.html": `{{ define "extends" }}{{ "base.html" }}{{ end }}page`,
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "must only contain the name of a template")
+	})
+}
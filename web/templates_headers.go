@@ -0,0 +1,34 @@
+package web
+
+import "net/http"
+
+// WithHeader returns a copy of the Template that is sent with the given response header. Headers
+// given this way replace any the handler set under the same key and leave the others alone; given
+// more than once for a key, all the values are sent.
+func (t *Template) WithHeader(key, value string) *Template {
+	withHeader := *t
+	withHeader.header = t.header.Clone()
+	if withHeader.header == nil {
+		withHeader.header = http.Header{}
+	}
+	withHeader.header.Add(key, value)
+	return &withHeader
+}
+
+// WithCookie returns a copy of the Template that sets the given cookie, in addition to any set
+// before. Invalid cookies are dropped, as by http.SetCookie.
+func (t *Template) WithCookie(cookie *http.Cookie) *Template {
+	withCookie := *t
+	withCookie.cookies = append(append([]*http.Cookie(nil), t.cookies...), cookie)
+	return &withCookie
+}
+
+// writeHeaders adds the headers and cookies t was given to the response.
+func (t *Template) writeHeaders(w http.ResponseWriter) {
+	for key, values := range t.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	for _, cookie := range t.cookies {
+		http.SetCookie(w, cookie)
+	}
+}
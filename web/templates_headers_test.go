@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateHeadersAndCookies(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(tmpl *Template, ifNoneMatch string) *httptest.ResponseRecorder {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			w.Header().Set("X-Handler", "handler")
+			w.Header().Set("X-Both", "handler")
+			return tmpl, nil, nil
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.ETags = true
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+	page := NamedTemplate("page.html").
+		WithHeader("X-Both", "template").
+		WithHeader("x-template", "one").
+		WithHeader("X-Template", "two").
+		WithCookie(&http.Cookie{Name: "session", Value: "abc"}).
+		WithCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	checkHeaders := func(t *testing.T, rr *httptest.ResponseRecorder) {
+		t.Helper()
+		test.That(t, rr.Header().Get("X-Handler"), test.ShouldEqual, "handler")
+		test.That(t, rr.Header().Values("X-Both"), test.ShouldResemble, []string{"template"})
+		test.That(t, rr.Header().Values("X-Template"), test.ShouldResemble, []string{"one", "two"})
+		test.That(t, rr.Header().Values("Set-Cookie"), test.ShouldResemble, []string{"session=abc", "theme=dark"})
+	}
+
+	t.Run("buffered", func(t *testing.T) {
+		rr := serve(page, "")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		checkHeaders(t, rr)
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		tag := serve(page, "").Header().Get("ETag")
+		rr := serve(page, tag)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotModified)
+		checkHeaders(t, rr)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		rr := serve(page.Streaming(), "")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		checkHeaders(t, rr)
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		redirect, err := Redirect("/next", http.StatusSeeOther)
+		test.That(t, err, test.ShouldBeNil)
+		rr := serve(redirect.WithCookie(&http.Cookie{Name: "flash", Value: "saved"}), "")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusSeeOther)
+		test.That(t, rr.Header().Get("Set-Cookie"), test.ShouldEqual, "flash=saved")
+	})
+
+	t.Run("copies", func(t *testing.T) {
+		base := NamedTemplate("page.html").WithHeader("X-Template", "base")
+		_ = base.WithHeader("X-Template", "more").WithCookie(&http.Cookie{Name: "a", Value: "b"})
+		rr := serve(base, "")
+		test.That(t, rr.Header().Values("X-Template"), test.ShouldResemble, []string{"base"})
+		test.That(t, rr.Header().Values("Set-Cookie"), test.ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,32 @@
+package web
+
+import "net/http"
+
+// WithPartial returns a copy of the Template that renders the named template instead for HTMX
+// requests, those with an "HX-Request: true" header, so that one handler serves both the full
+// page and the fragment HTMX swaps in. Boosted requests, with "HX-Boosted: true", replace the
+// whole page and so get the full template. Responses carry "Vary: HX-Request".
+func (t *Template) WithPartial(name string) *Template {
+	withPartial := *t
+	withPartial.partial = name
+	return &withPartial
+}
+
+// htmxPartialRequest reports whether r is an HTMX request for a fragment.
+func htmxPartialRequest(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true"
+}
+
+// forRequest returns the template to render for r.
+func (t *Template) forRequest(w http.ResponseWriter, r *http.Request) *Template {
+	if t.partial == "" {
+		return t
+	}
+	w.Header().Add("Vary", "HX-Request")
+	if !htmxPartialRequest(r) {
+		return t
+	}
+	partial := *t
+	partial.named, partial.direct, partial.layout, partial.partial, partial.then = t.partial, nil, "", "", nil
+	return &partial
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewarePartial(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html":    `<html>{{ template "content.html" . }}</html>`,
+		"content.html": `<p>{{ . }}</p>`,
+	})
+	h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		return NamedTemplate("page.html").WithPartial("content.html"), "hi", nil
+	})
+	mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Values("Vary"), test.ShouldContain, "HX-Request")
+		return rr
+	}
+
+	test.That(t, serve(nil).Body.String(), test.ShouldEqual, "<html><p>hi</p></html>")
+	test.That(t, serve(map[string]string{"HX-Request": "true"}).Body.String(), test.ShouldEqual, "<p>hi</p>")
+	test.That(t, serve(map[string]string{"HX-Request": "true", "HX-Boosted": "true"}).Body.String(),
+		test.ShouldEqual, "<html><p>hi</p></html>")
+
+	t.Run("render cache keeps fragments apart", func(t *testing.T) {
+		mw.RenderCache = NewMemoryResponseCache(10)
+		defer func() { mw.RenderCache = nil }()
+		test.That(t, serve(nil).Body.String(), test.ShouldEqual, "<html><p>hi</p></html>")
+		test.That(t, serve(map[string]string{"HX-Request": "true"}).Body.String(), test.ShouldEqual, "<p>hi</p>")
+		test.That(t, serve(nil).Body.String(), test.ShouldEqual, "<html><p>hi</p></html>")
+	})
+}
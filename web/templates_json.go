@@ -0,0 +1,116 @@
+package web
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.viam.com/utils"
+	"go.viam.com/utils/web/protojson"
+)
+
+// jsonContentType is the media type TemplateMiddleware serves when negotiating JSON.
+const jsonContentType = "application/json"
+
+// wantsJSON reports whether the request should be answered with JSON rather than HTML.
+func (tm *TemplateMiddleware) wantsJSON(r *http.Request) bool {
+	if !tm.NegotiateJSON {
+		return false
+	}
+	if tm.FormatParam != "" {
+		if format := r.URL.Query().Get(tm.FormatParam); format != "" {
+			return format == "json"
+		}
+	}
+	return acceptPrefersJSON(r.Header.Get("Accept"))
+}
+
+// wantsJSONError reports whether an error for the request should be answered with JSON rather
+// than an error page: as for wantsJSON when negotiating JSON, and otherwise whenever the request's
+// Accept header prefers JSON, as for fetch calls expecting it.
+func (tm *TemplateMiddleware) wantsJSONError(r *http.Request) bool {
+	if tm.NegotiateJSON {
+		return tm.wantsJSON(r)
+	}
+	return acceptPrefersJSON(r.Header.Get("Accept"))
+}
+
+// acceptPrefersJSON reports whether an Accept header ranks application/json above HTML. Wildcards
+// count for neither, so clients that accept anything get HTML. When both are ranked equally, the
+// one listed first wins.
+func acceptPrefersJSON(accept string) bool {
+	jsonQ, htmlQ := -1.0, -1.0
+	jsonFirst := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case jsonContentType:
+			if jsonQ < 0 && htmlQ < 0 {
+				jsonFirst = true
+			}
+			if q > jsonQ {
+				jsonQ = q
+			}
+		case "text/html", "application/xhtml+xml":
+			if q > htmlQ {
+				htmlQ = q
+			}
+		}
+	}
+	if jsonQ <= 0 {
+		return false
+	}
+	return jsonQ > htmlQ || (jsonQ == htmlQ && jsonFirst)
+}
+
+// writeJSON writes data as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) error {
+	js, err := protojson.Marshal(data)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(js)))
+	w.WriteHeader(statusCode)
+	_, err = w.Write(js)
+	utils.UncheckedError(err)
+	return nil
+}
+
+// writeJSONError writes err as a JSON object holding the status, message, error ID and the
+// fields of a ValidationError, if any, along with the message as "err", the shape APIMiddleware
+// uses for errors.
+func writeJSONError(w http.ResponseWriter, statusCode int, err error, errorID string) {
+	message := errorMessage(err)
+	body := map[string]interface{}{
+		"status":  statusCode,
+		"message": message,
+		"err":     message,
+	}
+	if errorID != "" {
+		body["error_id"] = errorID
+	}
+	if fields := fieldErrors(err); fields != nil {
+		body["fields"] = fields
+	}
+	js, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		writeBasicErrorResponse(w, statusCode, err)
+		return
+	}
+	setErrorHeaders(w, jsonContentType)
+	w.WriteHeader(statusCode)
+	_, writeErr := w.Write(js)
+	utils.UncheckedError(writeErr)
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareNegotiateJSON(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": `<p>{{ .Name }}</p>`,
+		"404.html":  `<p>not found</p>`,
+	})
+	type page struct {
+		Name string `json:"name"`
+	}
+	serve := func(negotiate bool, err error, target string, accept string) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", page{Name: "gopher"}, err), golog.NewTestLogger(t))
+		mw.NegotiateJSON = negotiate
+		mw.FormatParam = "format"
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+	notFound := ErrorResponseStatus(http.StatusNotFound)
+
+	t.Run("accept json", func(t *testing.T) {
+		rr := serve(true, nil, "/", "application/json")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "application/json")
+		test.That(t, rr.Body.String(), test.ShouldEqual, `{"name":"gopher"}`)
+		test.That(t, rr.Header().Values("Vary"), test.ShouldContain, "Accept")
+
+		rr = serve(true, notFound, "/", "application/json")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "application/json")
+		test.That(t, rr.Body.String(), test.ShouldEqual, `{"err":"Not Found","message":"Not Found","status":404}`)
+	})
+
+	t.Run("accept html", func(t *testing.T) {
+		rr := serve(true, nil, "/", "text/html,application/xhtml+xml,application/json;q=0.9,*/*;q=0.8")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<p>gopher</p>")
+		test.That(t, rr.Header().Values("Vary"), test.ShouldContain, "Accept")
+
+		rr = serve(true, notFound, "/", "text/html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<p>not found</p>")
+		test.That(t, rr.Header().Values("Vary"), test.ShouldContain, "Accept")
+
+		rr = serve(false, nil, "/", "text/html")
+		test.That(t, rr.Header().Values("Vary"), test.ShouldNotContain, "Accept")
+	})
+
+	t.Run("format param overrides accept", func(t *testing.T) {
+		rr := serve(true, nil, "/?format=json", "text/html")
+		test.That(t, rr.Body.String(), test.ShouldEqual, `{"name":"gopher"}`)
+		rr = serve(true, nil, "/?format=html", "application/json")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<p>gopher</p>")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		rr := serve(false, nil, "/?format=json", "application/json")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<p>gopher</p>")
+	})
+
+	t.Run("errors for clients accepting json", func(t *testing.T) {
+		// even without NegotiateJSON, the same failing handler answers each client in kind.
+		rr := serve(false, notFound, "/", "application/json")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "application/json")
+		test.That(t, rr.Body.String(), test.ShouldEqual, `{"err":"Not Found","message":"Not Found","status":404}`)
+
+		rr = serve(false, notFound, "/", "text/html,application/xhtml+xml,*/*;q=0.8")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, DefaultTemplateContentType)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<p>not found</p>")
+
+		rr = serve(false, errors.New("boom"), "/", "application/json")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, `{"err":"boom","error_id":"`)
+		test.That(t, rr.Body.String(), test.ShouldEndWith, `","message":"boom","status":500}`)
+
+		rr = serve(false, context.DeadlineExceeded, "/", "application/json")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusGatewayTimeout)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, `"status":504`)
+
+		// with NegotiateJSON, the format parameter decides for errors too.
+		rr = serve(true, notFound, "/?format=html", "application/json")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<p>not found</p>")
+	})
+}
+
+func TestAcceptPrefersJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"application/json":                  true,
+		"application/json, */*":             true,
+		"text/html, application/json":       false,
+		"application/json, text/html":       true,
+		"text/html;q=0.5, application/json": true,
+		"application/json;q=0, text/plain":  false,
+		"application/json;q=0.4, text/html;q=0.5": false,
+	} {
+		test.That(t, acceptPrefersJSON(accept), test.ShouldEqual, expected)
+	}
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+	"net/http"
+	"time"
+)
+
+// LastModifier is implemented by template data that knows when it last changed, such as a record
+// with an UpdatedAt field. TemplateMiddleware uses it as by Template.WithLastModified.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// WithLastModified returns a copy of the Template whose response is marked as last modified at
+// modTime. The middleware sends a Last-Modified header and answers requests whose
+// If-Modified-Since is no earlier with 304 Not Modified, without running the template. Requests
+// with If-None-Match are left to ETags when they are enabled. A zero time disables this, even
+// when the data is a LastModifier.
+func (t *Template) WithLastModified(modTime time.Time) *Template {
+	withLastModified := *t
+	withLastModified.lastModified = modTime
+	withLastModified.lastModifiedSet = true
+	return &withLastModified
+}
+
+// lastModified returns when the response for t and data last changed, or the zero time if that
+// is unknown.
+func lastModified(t *Template, data interface{}) time.Time {
+	if t.lastModifiedSet {
+		return t.lastModified
+	}
+	if lm, ok := data.(LastModifier); ok {
+		return lm.LastModified()
+	}
+	return time.Time{}
+}
+
+// notModified sets Last-Modified for the response and reports whether the client's copy is
+// current, in which case a 304 has been sent.
+func (tm *TemplateMiddleware) notModified(w http.ResponseWriter, r *http.Request, status int, modTime time.Time) bool {
+	if modTime.IsZero() || status != http.StatusOK {
+		return false
+	}
+	modTime = modTime.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if tm.ETags && r.Header.Get("If-None-Match") != "" {
+		// RFC 7232 has If-None-Match take precedence.
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modTime.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+type article struct {
+	updatedAt time.Time
+}
+
+func (a article) LastModified() time.Time {
+	return a.updatedAt
+}
+
+func TestTemplateMiddlewareLastModified(t *testing.T) {
+	var rendered int
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"page.html": "{{ count }}page",
+	}, WithFuncs(template.FuncMap{
+		"count": func() string { rendered++; return "" },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	updated := time.Date(2024, 3, 1, 12, 30, 15, 500, time.UTC)
+
+	serve := func(h TemplateHandler, ifModifiedSince, ifNoneMatch string) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.ETags = true
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+	withTemplate := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		return NamedTemplate("page.html").WithLastModified(updated), nil, nil
+	})
+	withData := staticHandler("page.html", article{updated}, nil)
+
+	for name, h := range map[string]TemplateHandler{"template": withTemplate, "data": withData} {
+		h := h
+		t.Run(name, func(t *testing.T) {
+			t.Run("fresh", func(t *testing.T) {
+				rendered = 0
+				for _, since := range []time.Time{updated.Truncate(time.Second), updated.Add(time.Hour)} {
+					rr := serve(h, since.Format(http.TimeFormat), "")
+					test.That(t, rr.Code, test.ShouldEqual, http.StatusNotModified)
+					test.That(t, rr.Body.Len(), test.ShouldEqual, 0)
+					test.That(t, rr.Header().Get("Last-Modified"), test.ShouldEqual, "Fri, 01 Mar 2024 12:30:15 GMT")
+				}
+				test.That(t, rendered, test.ShouldEqual, 0)
+			})
+
+			t.Run("stale", func(t *testing.T) {
+				rr := serve(h, updated.Add(-time.Second).Format(http.TimeFormat), "")
+				test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+				test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+				test.That(t, rr.Header().Get("Last-Modified"), test.ShouldEqual, "Fri, 01 Mar 2024 12:30:15 GMT")
+			})
+
+			t.Run("malformed", func(t *testing.T) {
+				rr := serve(h, "yesterday-ish", "")
+				test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+				test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+			})
+
+			t.Run("ETag takes precedence", func(t *testing.T) {
+				rr := serve(h, updated.Format(http.TimeFormat), `"something else"`)
+				test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+				test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+			})
+		})
+	}
+
+	t.Run("zero time disables", func(t *testing.T) {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate("page.html").WithLastModified(time.Time{}), article{updated}, nil
+		})
+		rr := serve(h, updated.Format(http.TimeFormat), "")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Header().Get("Last-Modified"), test.ShouldBeEmpty)
+	})
+}
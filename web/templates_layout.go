@@ -0,0 +1,70 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+)
+
+// LayoutContentTemplate is the name of the template a layout invokes to render the page it
+// wraps, typically with {{block "content" .}}{{end}}.
+const LayoutContentTemplate = "content"
+
+// LayoutTemplateManager is a TemplateManager that can render a page inside a layout. The
+// managers created by this package implement it.
+type LayoutTemplateManager interface {
+	TemplateManager
+
+	// LookupLayout returns a new copy of the named layout whose LayoutContentTemplate is the
+	// named page. Each call returns an independent template, so concurrent renders of different
+	// pages into the same layout do not interfere.
+	LookupLayout(layout, page string) (*template.Template, error)
+}
+
+// layout clones the unexecuted templates of the set and makes the page the content of the layout
+// within the clone.
+func (ts *templateSet) layout(layout, page string) (*template.Template, error) {
+	set, err := ts.pristine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return composeLayout(set, set, layout, page)
+}
+
+// composeLayout associates a copy of page from pages as the content of layout from layouts.
+// layouts must not have been executed yet since it is modified in place.
+func composeLayout(layouts, pages *template.Template, layout, page string) (*template.Template, error) {
+	lt, err := lookupTemplate(layouts, layout)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := lookupTemplate(pages, page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := lt.AddParseTree(LayoutContentTemplate, pt.Tree.Copy()); err != nil {
+		return nil, fmt.Errorf("error rendering %s in layout %s: %w", page, layout, err)
+	}
+	return lt, nil
+}
+
+// lookupLayout renders page inside layout using tm. TemplateManagers that are not a
+// LayoutTemplateManager are only supported as long as none of their templates have been executed.
+func lookupLayout(tm TemplateManager, layout, page string) (*template.Template, error) {
+	if ltm, ok := tm.(LayoutTemplateManager); ok {
+		return ltm.LookupLayout(layout, page)
+	}
+
+	lt, err := tm.LookupTemplate(layout)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := tm.LookupTemplate(page)
+	if err != nil {
+		return nil, err
+	}
+	set, err := lt.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s in layout %s: %w", page, layout, err)
+	}
+	return composeLayout(set, pt, layout, page)
+}
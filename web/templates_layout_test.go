@@ -0,0 +1,85 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+var layoutTemplateFiles = map[string]string{
+	"base.html": `<main>{{ block "content" . }}default{{ end }}</main>`,
+	"a.html":    `page a {{ . }}`,
+	"b.html":    `page b {{ . }}`,
+}
+
+func TestTemplateLayout(t *testing.T) {
+	fsys := fstest.MapFS{}
+	dir := t.TempDir()
+	for name, contents := range layoutTemplateFiles {
+		fsys["templates/"+name] = &fstest.MapFile{Data: []byte(contents)}
+		writeTemplateFile(t, filepath.Join(dir, name), contents, time.Now())
+	}
+	embedTM, err := NewTemplateManagerEmbed(fsys, "templates")
+	test.That(t, err, test.ShouldBeNil)
+	dirTM, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	for name, tm := range map[string]TemplateManager{"embed": embedTM, "fs": dirTM} {
+		tm := tm
+		t.Run(name, func(t *testing.T) {
+			handler := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+				page := r.URL.Query().Get("page")
+				return NamedTemplate(page + ".html").WithLayout("base.html"), "<" + page + ">", nil
+			})
+			mw := NewTemplateMiddleware(tm, handler, golog.NewTestLogger(t))
+
+			render := func(page string) (int, string) {
+				rr := httptest.NewRecorder()
+				mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?page="+page, nil))
+				return rr.Code, rr.Body.String()
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 100)
+			for i := 0; i < 100; i++ {
+				page := "a"
+				if i%2 == 1 {
+					page = "b"
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					expected := fmt.Sprintf("<main>page %s &lt;%s&gt;</main>", page, page)
+					if code, body := render(page); code != http.StatusOK || body != expected {
+						errs <- fmt.Errorf("unexpected response %d %q, expected %q", code, body, expected)
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			// the layout itself still renders its default content.
+			test.That(t, renderTemplate(t, tm, "base.html"), test.ShouldEqual, "<main>default</main>")
+
+			code, body := render("missing")
+			test.That(t, code, test.ShouldEqual, http.StatusInternalServerError)
+			test.That(t, body, test.ShouldContainSubstring, "cannot find template missing.html")
+		})
+	}
+
+	t.Run("unknown layout", func(t *testing.T) {
+		_, err := embedTM.(LayoutTemplateManager).LookupLayout("nope.html", "a.html")
+		test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+	})
+}
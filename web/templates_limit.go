@@ -0,0 +1,46 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrResponseTooLarge is returned, wrapped, when a template renders more than
+// TemplateMiddleware's MaxResponseBytes.
+var ErrResponseTooLarge = errors.New("rendered response too large")
+
+// limitedWriter fails writes that would take it past its limit.
+type limitedWriter struct {
+	w         io.Writer
+	limit     int64
+	remaining int64
+}
+
+func (lw *limitedWriter) Write(b []byte) (int, error) {
+	if int64(len(b)) > lw.remaining {
+		return 0, fmt.Errorf("%w: more than MaxResponseBytes (%d bytes)", ErrResponseTooLarge, lw.limit)
+	}
+	n, err := lw.w.Write(b)
+	lw.remaining -= int64(n)
+	return n, err
+}
+
+// limitOutput returns w, limited to MaxResponseBytes if it is set.
+func (tm *TemplateMiddleware) limitOutput(w io.Writer) io.Writer {
+	if tm.MaxResponseBytes <= 0 {
+		return w
+	}
+	return &limitedWriter{w: w, limit: tm.MaxResponseBytes, remaining: tm.MaxResponseBytes}
+}
+
+// abortIfTooLarge closes the connection if err is a response growing too large after part of it
+// was sent, since the client cannot be told in any other way that it is incomplete.
+func (tm *TemplateMiddleware) abortIfTooLarge(r *http.Request, err error) {
+	if !errors.Is(err, ErrResponseTooLarge) {
+		return
+	}
+	tm.logger(r).Error("closing connection for response exceeding MaxResponseBytes", "path", r.URL.Path, "error", err)
+	panic(http.ErrAbortHandler)
+}
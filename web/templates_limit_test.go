@@ -0,0 +1,65 @@
+package web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareMaxResponseBytes(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "{{ range . }}runaway row {{ . }}\n{{ end }}",
+	})
+	huge := make([]int, 100000)
+	small := make([]int, 10)
+	newMiddleware := func(t *testing.T, data []int, streaming bool, limit int64) *TemplateMiddleware {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			tmpl := NamedTemplate("page.html")
+			if streaming {
+				tmpl = tmpl.Streaming()
+			}
+			return tmpl, data, nil
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.MaxResponseBytes = limit
+		mw.FlushBytes = 1024
+		return mw
+	}
+
+	t.Run("buffered", func(t *testing.T) {
+		var seen error
+		mw := newMiddleware(t, huge, false, 4<<10)
+		mw.OnError = func(r *http.Request, err error, status int) { seen = err }
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "MaxResponseBytes (4096 bytes)")
+		test.That(t, errors.Is(seen, ErrResponseTooLarge), test.ShouldBeTrue)
+
+		rr = httptest.NewRecorder()
+		newMiddleware(t, small, false, 4<<10).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+
+		rr = httptest.NewRecorder()
+		newMiddleware(t, huge, false, 0).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.Len(), test.ShouldBeGreaterThan, 1<<20)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		server := httptest.NewServer(newMiddleware(t, huge, true, 4<<10))
+		defer server.Close()
+		resp, err := http.Get(server.URL)
+		test.That(t, err, test.ShouldBeNil)
+		defer resp.Body.Close()
+		test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusOK)
+		body, err := io.ReadAll(resp.Body)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, len(body), test.ShouldBeLessThanOrEqualTo, 4<<10)
+	})
+}
@@ -0,0 +1,421 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// templateFile is a template source found while walking a template directory. Its size and
+// modification time are used to cheaply decide whether a cached parse is still valid.
+type templateFile struct {
+	// name is the template name: the slash-separated path relative to the template root, as
+	// normalized by the configured name normalizer.
+	name string
+	// path is the location of the file within its fs.FS.
+	path    string
+	modTime time.Time
+	size    int64
+	// hash is the hex encoded sha256 of the contents, set once the file is parsed.
+	hash string
+	// extends is the layout the file extends, set once the file is parsed.
+	extends string
+}
+
+func hashTemplateSource(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// findTemplateFiles recursively walks root in fsys and returns every template file found
+// in lexical order.
+func findTemplateFiles(fsys fs.FS, root string, opts templateManagerOptions) ([]templateFile, error) {
+	return findTemplateFilesCtx(context.Background(), fsys, root, opts)
+}
+
+// maxTemplateSymlinkDepth bounds how many directory symlinks may be followed within one another.
+const maxTemplateSymlinkDepth = 16
+
+// findTemplateFilesCtx is findTemplateFiles but stops walking once ctx is done. Symlinks to files
+// and directories are followed, with a file's size and modification time taken from its target. A
+// symlinked directory is only walked if its target has not been walked already, which also
+// prevents cycles.
+func findTemplateFilesCtx(ctx context.Context, fsys fs.FS, root string, opts templateManagerOptions) ([]templateFile, error) {
+	rootInfo, err := fs.Stat(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	if !rootInfo.IsDir() {
+		return nil, fmt.Errorf("template root %s is not a directory", root)
+	}
+
+	w := templateWalker{ctx: ctx, fsys: fsys, root: root, opts: opts, visited: []fs.FileInfo{rootInfo}}
+	if err := w.walk(root, 0); err != nil {
+		return nil, err
+	}
+	if len(w.files) == 0 {
+		return nil, fmt.Errorf("no template files found in %s", root)
+	}
+	if err := checkTemplateNamesUnique(w.files); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+// templateWalker collects the template files beneath a root directory.
+type templateWalker struct {
+	ctx  context.Context
+	fsys fs.FS
+	root string
+	opts templateManagerOptions
+
+	// visited are the directories walked so far.
+	visited []fs.FileInfo
+	files   []templateFile
+}
+
+// walk collects the files in dir, which is within linkDepth symlinked directories.
+func (w *templateWalker) walk(dir string, linkDepth int) error {
+	entries, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range entries {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		if w.opts.exclude(d.Name()) {
+			continue
+		}
+
+		p := path.Join(dir, d.Name())
+		name := p
+		if w.root != "." {
+			name = strings.TrimPrefix(p, w.root+"/")
+		}
+		isLink := d.Type()&fs.ModeSymlink != 0
+		if !isLink && !d.IsDir() {
+			// Files that are not templates, such as an editor's temporary ones, can be removed
+			// while templates load, so they are skipped without being stat-ed. A template removed
+			// since ReadDir is skipped too.
+			if !w.opts.matchesGlobs(name) {
+				continue
+			}
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := w.add(p, name, info); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var info fs.FileInfo
+		if isLink {
+			// Stat follows the link. A link whose name no template could have is only followed
+			// in case it leads to a directory, so if it cannot be resolved it is skipped like
+			// any other file that is not a template.
+			if info, err = fs.Stat(w.fsys, p); err != nil {
+				if !w.opts.matchesGlobs(name) {
+					continue
+				}
+				return fmt.Errorf("cannot resolve template symlink %s: %w", p, err)
+			}
+		} else if info, err = d.Info(); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if isLink && w.seen(info) {
+				continue
+			}
+			depth := linkDepth
+			if isLink {
+				if depth++; depth > maxTemplateSymlinkDepth {
+					return fmt.Errorf("too many levels of template directory symlinks at %s", p)
+				}
+			}
+			w.visited = append(w.visited, info)
+			if err := w.walk(p, depth); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !w.opts.matchesGlobs(name) {
+			continue
+		}
+		if err := w.add(p, name, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add records the template file at p, named name relative to the root and described by info.
+func (w *templateWalker) add(p, name string, info fs.FileInfo) error {
+	if max := w.opts.maxFileSize; max > 0 && info.Size() > max {
+		return fmt.Errorf("template file %s is %d bytes, more than the limit of %d bytes", p, info.Size(), max)
+	}
+	if max := w.opts.maxFiles; max > 0 && len(w.files) >= max {
+		return fmt.Errorf("more than %d template files found in %s", max, w.root)
+	}
+	w.files = append(w.files, templateFile{
+		name:    w.opts.normalizeName(name),
+		path:    p,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	})
+	return nil
+}
+
+// seen reports whether the directory described by info was already walked. Only directories on
+// an operating system file system can be identified; others are never considered seen.
+func (w *templateWalker) seen(info fs.FileInfo) bool {
+	for _, v := range w.visited {
+		if os.SameFile(v, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTemplateNamesUnique makes sure no two files were given the same name by a name normalizer.
+func checkTemplateNamesUnique(files []templateFile) error {
+	paths := make(map[string]string, len(files))
+	for _, f := range files {
+		if other, ok := paths[f.name]; ok {
+			return fmt.Errorf("template files %s and %s are both named %s", other, f.path, f.name)
+		}
+		paths[f.name] = f.path
+	}
+	return nil
+}
+
+// parseTemplateFiles parses each file into a new base template as a template named after the
+// file's relative path and records the hash of each file's contents in files.
+func parseTemplateFiles(fsys fs.FS, files []templateFile, opts templateManagerOptions) (*template.Template, error) {
+	main := baseTemplate(opts)
+	for i, f := range files {
+		b, err := fs.ReadFile(fsys, f.path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := main.New(f.name).Parse(string(b)); err != nil {
+			parseErr := newTemplateParseError(f.path, err)
+			parseErr.Source = b
+			return nil, parseErr
+		}
+		files[i].hash = hashTemplateSource(b)
+		if files[i].extends, err = templateExtends(main, f.name); err != nil {
+			return nil, err
+		}
+	}
+	return main, nil
+}
+
+// parseTemplateSet parses files as by parseTemplateFiles and then resolves which layouts they
+// extend. Unlike parseTemplateFiles, it needs the complete set of files.
+func parseTemplateSet(fsys fs.FS, files []templateFile, opts templateManagerOptions) (*template.Template, error) {
+	main, err := parseTemplateFiles(fsys, files, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveExtends(main, files); err != nil {
+		return nil, err
+	}
+	return main, nil
+}
+
+// TemplateParseError describes a template file that failed to parse. When several files fail,
+// the errors are combined and each can be found with errors.As.
+type TemplateParseError struct {
+	// File is the path of the file within the template file system, or the key of an in-memory
+	// template.
+	File string
+	// Line is the line the error was found on, or zero if it is unknown.
+	Line int
+	// Message describes the problem, without the file and line.
+	Message string
+	// Err is the underlying error from the template package.
+	Err error
+	// Source is the contents of the file, if known, for showing the error in context.
+	Source []byte
+}
+
+// parseErrorPrefix matches the "template: name:line: " prefix of the template packages' parse errors.
+var parseErrorPrefix = regexp.MustCompile(`^template: .*?:(\d+): `)
+
+func newTemplateParseError(file string, err error) *TemplateParseError {
+	parseErr := &TemplateParseError{File: file, Message: err.Error(), Err: err}
+	if m := parseErrorPrefix.FindStringSubmatchIndex(parseErr.Message); m != nil {
+		parseErr.Line, _ = strconv.Atoi(parseErr.Message[m[2]:m[3]])
+		parseErr.Message = parseErr.Message[m[1]:]
+	}
+	return parseErr
+}
+
+func (e *TemplateParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("error parsing template %s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("error parsing template %s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Unwrap returns the underlying error from the template package.
+func (e *TemplateParseError) Unwrap() error {
+	return e.Err
+}
+
+// templateSet is an immutable, fully parsed set of templates along with the files it was parsed from.
+type templateSet struct {
+	main *template.Template
+	// pristine is a copy of main that is never executed so that it can always be cloned.
+	pristine *template.Template
+	files    []templateFile
+	src      TemplateSource
+
+	// clones are reused by executeWithFuncs.
+	clones templateClones
+
+	// generation distinguishes this set from every other, including later parses of the same files.
+	generation uint64
+}
+
+func newTemplateSet(pristine *template.Template, files []templateFile, src TemplateSource) (*templateSet, error) {
+	main, err := pristine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &templateSet{main: main, pristine: pristine, files: files, src: src, generation: nextTemplateGeneration()}, nil
+}
+
+// loadTemplateSet finds and parses every template file in src. If parsing fails, the
+// returned error lists every file that is broken rather than just the first.
+func loadTemplateSet(src TemplateSource, opts templateManagerOptions) (*templateSet, error) {
+	fsys, srcDir := src.templateFS()
+	files, err := findTemplateFiles(fsys, srcDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	main, err := parseTemplateSet(fsys, files, opts)
+	if err != nil {
+		if validateErr := validateTemplateFiles(fsys, files, opts, parseTemplateFilesErr); validateErr != nil {
+			err = validateErr
+		}
+		return nil, err
+	}
+	return newTemplateSet(main, files, src)
+}
+
+func (ts *templateSet) lookup(name string) (*template.Template, error) {
+	return lookupTemplate(ts.main, name)
+}
+
+// names inspects the parse trees of pristine, as does info, since executing templates in main
+// modifies theirs.
+func (ts *templateSet) names() []string {
+	return templateNames(ts.pristine)
+}
+
+func (ts *templateSet) info(name string) (TemplateInfo, error) {
+	t, err := lookupTemplate(ts.pristine, name)
+	if err != nil {
+		return TemplateInfo{}, err
+	}
+
+	// ParseName is the name of the file level template being parsed when t was defined,
+	// which is how {{define}} blocks are traced back to their file.
+	fileName := name
+	if t.Tree != nil && t.Tree.ParseName != "" {
+		fileName = t.Tree.ParseName
+	}
+	for _, f := range ts.files {
+		if f.name == fileName {
+			return TemplateInfo{
+				Name:       name,
+				SourcePath: ts.sourcePath(f.path),
+				ModTime:    f.modTime,
+				Size:       f.size,
+				Hash:       f.hash,
+			}, nil
+		}
+	}
+	return TemplateInfo{}, fmt.Errorf("cannot find source file for template %s", name)
+}
+
+// sourcePath presents the path of a file in the set. Sets without a source, such as those created
+// from a map, present the path as is.
+func (ts *templateSet) sourcePath(p string) string {
+	if ts.src == nil {
+		return p
+	}
+	return ts.src.sourcePath(p)
+}
+
+func validateTemplateSource(src TemplateSource, opts templateManagerOptions) error {
+	fsys, srcDir := src.templateFS()
+	files, err := findTemplateFiles(fsys, srcDir, opts)
+	if err != nil {
+		return err
+	}
+	return validateTemplateFiles(fsys, files, opts, parseTemplateFilesErr)
+}
+
+func parseTemplateFilesErr(fsys fs.FS, files []templateFile, opts templateManagerOptions) error {
+	_, err := parseTemplateFiles(fsys, files, opts)
+	return err
+}
+
+// validateTemplateFiles parses each file on its own with parse and combines the errors of
+// every file that fails.
+func validateTemplateFiles(
+	fsys fs.FS,
+	files []templateFile,
+	opts templateManagerOptions,
+	parse func(fsys fs.FS, files []templateFile, opts templateManagerOptions) error,
+) error {
+	var err error
+	for _, f := range files {
+		parseErr := parse(fsys, []templateFile{f}, opts)
+		if parseErr == nil {
+			continue
+		}
+		// parse errors already name the file.
+		var tpe *TemplateParseError
+		if !errors.As(parseErr, &tpe) {
+			parseErr = fmt.Errorf("invalid template file %s: %w", f.path, parseErr)
+		}
+		err = multierr.Combine(err, parseErr)
+	}
+	return err
+}
+
+func templateFilesEqual(a, b []templateFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].path != b[i].path || a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
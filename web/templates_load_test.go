@@ -0,0 +1,123 @@
+package web
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.viam.com/test"
+
+	"go.viam.com/utils/web/protojson"
+)
+
+func TestFindTemplateFilesSymlinks(t *testing.T) {
+	store := t.TempDir()
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// a content addressed store that the template directory links into.
+	test.That(t, os.Mkdir(filepath.Join(store, "partials"), 0o700), test.ShouldBeNil)
+	writeTemplateFile(t, filepath.Join(store, "abc123"), `page {{ template "partials/nav.html" }}`, modTime)
+	writeTemplateFile(t, filepath.Join(store, "partials", "nav.html"), `nav`, modTime)
+	writeTemplateFile(t, filepath.Join(dir, "plain.html"), `plain`, modTime)
+
+	symlink := func(target, link string) {
+		t.Helper()
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("cannot create symlinks: %s", err)
+		}
+	}
+	symlink(filepath.Join(store, "abc123"), filepath.Join(dir, "page.html"))
+	symlink(filepath.Join(store, "partials"), filepath.Join(dir, "partials"))
+	// a second link to an already walked directory and a link back to the root are not followed.
+	symlink(filepath.Join(store, "partials"), filepath.Join(dir, "zpartials"))
+	symlink(dir, filepath.Join(store, "partials", "loop"))
+
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("file and directory symlinks are followed", func(t *testing.T) {
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page nav")
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"page.html", "partials/nav.html", "plain.html"})
+
+		info, err := lookupTemplateInfo(tm, "page.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.ModTime.Equal(modTime), test.ShouldBeTrue)
+		test.That(t, info.Size, test.ShouldEqual, len(`page {{ template "partials/nav.html" }}`))
+	})
+
+	t.Run("changes to link targets are detected", func(t *testing.T) {
+		writeTemplateFile(t, filepath.Join(store, "partials", "nav.html"), `new nav`, modTime.Add(time.Minute))
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page new nav")
+	})
+
+	t.Run("dangling symlinks are reported", func(t *testing.T) {
+		link := filepath.Join(dir, "dangling.html")
+		symlink(filepath.Join(store, "missing"), link)
+		defer func() {
+			test.That(t, os.Remove(link), test.ShouldBeNil)
+		}()
+
+		_, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "cannot resolve template symlink dangling.html")
+		test.That(t, err, test.ShouldWrap, os.ErrNotExist)
+	})
+
+	t.Run("dangling symlinks that are not templates are skipped", func(t *testing.T) {
+		// an emacs lock file is a dangling symlink.
+		for _, name := range []string{"README.md", ".#page.html"} {
+			link := filepath.Join(dir, name)
+			symlink(filepath.Join(store, "missing"), link)
+			defer func() {
+				test.That(t, os.Remove(link), test.ShouldBeNil)
+			}()
+		}
+
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page new nav")
+	})
+}
+
+// vanishingFS lists the files named by vanished in the root directory, as if they were removed
+// right after it was read.
+type vanishingFS struct {
+	fstest.MapFS
+	vanished []string
+}
+
+func (fsys vanishingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fsys.MapFS.ReadDir(name)
+	if err != nil || name != "." {
+		return entries, err
+	}
+	for _, v := range fsys.vanished {
+		entries = append(entries, vanishedEntry(v))
+	}
+	return entries, nil
+}
+
+type vanishedEntry string
+
+func (e vanishedEntry) Name() string      { return string(e) }
+func (e vanishedEntry) IsDir() bool       { return false }
+func (e vanishedEntry) Type() fs.FileMode { return 0 }
+
+func (e vanishedEntry) Info() (fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "lstat", Path: string(e), Err: fs.ErrNotExist}
+}
+
+func TestFindTemplateFilesVanishing(t *testing.T) {
+	fsys := vanishingFS{
+		MapFS:    fstest.MapFS{"page.html": {Data: []byte("page")}},
+		vanished: []string{"page.html.tmp", "gone.html"},
+	}
+	files, err := findTemplateFiles(fsys, ".", newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, files, test.ShouldHaveLength, 1)
+	test.That(t, files[0].name, test.ShouldEqual, "page.html")
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"sort"
+	"time"
+
+	"go.uber.org/multierr"
+
+	"go.viam.com/utils/web/protojson"
+)
+
+// NewTemplateManagerFromMap creates a TemplateManager from templates held in memory, such as
+// templates stored in a database or written inline in tests. Each entry is parsed as a template
+// named by its key with the same base functions as the other managers, so entries may invoke each
+// other. Globs and exclusions do not apply. Entries are parsed in key order, so when several
+// entries {{define}} the same name, the last key wins. A parse error is reported for every
+// broken entry, naming its key.
+func NewTemplateManagerFromMap(templates map[string]string, opts ...TemplateManagerOption) (TemplateManager, error) {
+	o := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	files := make([]templateFile, 0, len(templates))
+	for key, contents := range templates {
+		files = append(files, templateFile{
+			name: o.normalizeName(key),
+			path: key,
+			size: int64(len(contents)),
+			hash: hashTemplateSource([]byte(contents)),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	if err := checkTemplateNamesUnique(files); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	main := baseTemplate(o)
+	var err error
+	for i, f := range files {
+		if _, parseErr := main.New(f.name).Parse(templates[f.path]); parseErr != nil {
+			tpe := newTemplateParseError(f.path, parseErr)
+			tpe.Source = []byte(templates[f.path])
+			err = multierr.Combine(err, tpe)
+			continue
+		}
+		var extendsErr error
+		if files[i].extends, extendsErr = templateExtends(main, f.name); extendsErr != nil {
+			err = multierr.Combine(err, extendsErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveExtends(main, files); err != nil {
+		return nil, err
+	}
+
+	ts, err := newTemplateSet(main, files, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newEmbedTM(o, ts, time.Since(start)), nil
+}
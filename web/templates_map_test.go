@@ -0,0 +1,81 @@
+package web
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestNewTemplateManagerFromMap(t *testing.T) {
+	t.Run("templates reference each other", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(map[string]string{
+			"page":   `{{ template "header" }} {{ upper "body" }}`,
+			"header": `header`,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page"), test.ShouldEqual, "header BODY")
+
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"header", "page"})
+
+		info, err := lookupTemplateInfo(tm, "page")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, "page")
+		test.That(t, info.Size, test.ShouldEqual, len(`{{ template "header" }} {{ upper "body" }}`))
+		test.That(t, validateTemplates(tm), test.ShouldBeNil)
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(map[string]string{"page": "page"})
+		test.That(t, err, test.ShouldBeNil)
+		_, err = tm.LookupTemplate("missing")
+		test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+		test.That(t, err.Error(), test.ShouldEqual, "cannot find template missing")
+	})
+
+	t.Run("empty map", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(nil)
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldBeEmpty)
+		_, err = tm.LookupTemplate("page")
+		test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+	})
+
+	t.Run("duplicate define names", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(map[string]string{
+			"a":    `{{ define "shared" }}from a{{ end }}`,
+			"b":    `{{ define "shared" }}from b{{ end }}`,
+			"page": `{{ template "shared" }}`,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page"), test.ShouldEqual, "from b")
+
+		info, err := lookupTemplateInfo(tm, "shared")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, "b")
+	})
+
+	t.Run("parse errors name every broken key", func(t *testing.T) {
+		_, err := NewTemplateManagerFromMap(map[string]string{
+			"good":    `good`,
+			"broken1": `{{ .Unclosed `,
+			"broken2": `{{ undefinedFunc }}`,
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "error parsing template broken1")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "error parsing template broken2")
+		test.That(t, err.Error(), test.ShouldNotContainSubstring, "error parsing template good")
+	})
+
+	t.Run("options apply", func(t *testing.T) {
+		_, err := NewTemplateManagerFromMap(map[string]string{"page": "page"}, WithDelims("", ""))
+		test.That(t, err, test.ShouldNotBeNil)
+
+		tm, err := NewTemplateManagerFromMap(map[string]string{"page": `[[ upper "x" ]]`}, WithDelims("[[", "]]"))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page"), test.ShouldEqual, "X")
+	})
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"errors"
+	"html/template"
+	"sort"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// TemplateMetrics receives an observation for every request a TemplateMiddleware serves. It
+// lets rendering be measured without depending on a particular metrics library; adapt it to
+// Prometheus or similar, or use TemplateRenderMetrics.
+type TemplateMetrics interface {
+	// ObserveRender is called once the response has been written. template is the page template
+	// the handler asked for, or "" if it returned none. status is the status sent, including the
+	// status of errors. handlerDuration is the time spent in the handler and renderDuration the
+	// time spent writing the response after it, including any error template.
+	ObserveRender(template string, status int, handlerDuration, renderDuration time.Duration)
+}
+
+// TemplateErrorMetrics is implemented by TemplateMetrics that also count errors. IncError is
+// called once for every request failing with an error the middleware responds to, with the
+// status it is answered with and one of the ErrorKind constants.
+type TemplateErrorMetrics interface {
+	IncError(status int, kind string)
+}
+
+// The kinds of error reported to TemplateErrorMetrics.
+const (
+	// ErrorKindHandler is an error from the handler, or from the middleware itself such as a
+	// missing CSRF token.
+	ErrorKindHandler = "handler_error"
+	// ErrorKindLookupFailed is a page template that could not be found.
+	ErrorKindLookupFailed = "lookup_failed"
+	// ErrorKindRenderFailed is a page template that failed to render.
+	ErrorKindRenderFailed = "render_failed"
+	// ErrorKindErrorTemplateMissing is an error of any other kind that had to be written as plain
+	// text because none of its error templates exist.
+	ErrorKindErrorTemplateMissing = "error_template_missing"
+)
+
+// errorKind returns the kind of err, short of ErrorKindErrorTemplateMissing.
+func errorKind(err error) string {
+	var execErr texttemplate.ExecError
+	var escapeErr *template.Error
+	var panicErr templatePanicError
+	switch {
+	case errors.Is(err, ErrTemplateNotFound):
+		return ErrorKindLookupFailed
+	case errors.As(err, &execErr), errors.As(err, &escapeErr), errors.As(err, &panicErr),
+		errors.Is(err, ErrResponseTooLarge):
+		return ErrorKindRenderFailed
+	default:
+		return ErrorKindHandler
+	}
+}
+
+// incError reports an error to Metrics if it counts errors.
+func (tm *TemplateMiddleware) incError(status int, kind string) {
+	if m, ok := tm.Metrics.(TemplateErrorMetrics); ok {
+		m.IncError(status, kind)
+	}
+}
+
+// TemplateErrorKey identifies a count of errors kept by TemplateRenderMetrics.
+type TemplateErrorKey struct {
+	Status int
+	Kind   string
+}
+
+// DefaultRenderBuckets are the upper bounds of the render duration histogram used by
+// NewTemplateRenderMetrics when none are given.
+var DefaultRenderBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// TemplateRenderStats are the observations TemplateRenderMetrics has collected for one template.
+type TemplateRenderStats struct {
+	// Requests is the number of requests observed.
+	Requests uint64
+	// Statuses counts the requests by the status they were answered with.
+	Statuses map[int]uint64
+	// Buckets counts the requests whose handler and render time together was at most the
+	// corresponding bound in Bounds. Counts are cumulative, as in a Prometheus histogram, and
+	// requests slower than every bound are only counted in Requests.
+	Buckets []uint64
+	// Bounds are the upper bounds of Buckets.
+	Bounds []time.Duration
+	// HandlerDuration and RenderDuration are the total time spent in handlers and rendering.
+	HandlerDuration time.Duration
+	RenderDuration  time.Duration
+}
+
+// TemplateRenderMetrics is an in memory TemplateMetrics that keeps counters and a latency
+// histogram per template, and counts errors by status and kind as a TemplateErrorMetrics. It is
+// safe for concurrent use.
+type TemplateRenderMetrics struct {
+	bounds []time.Duration
+
+	mu     sync.Mutex
+	stats  map[string]*TemplateRenderStats
+	errors map[TemplateErrorKey]uint64
+}
+
+// NewTemplateRenderMetrics returns an empty TemplateRenderMetrics whose histograms have the given
+// upper bounds, or DefaultRenderBuckets if none are given.
+func NewTemplateRenderMetrics(bounds ...time.Duration) *TemplateRenderMetrics {
+	if len(bounds) == 0 {
+		bounds = DefaultRenderBuckets
+	}
+	bounds = append([]time.Duration(nil), bounds...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	return &TemplateRenderMetrics{
+		bounds: bounds,
+		stats:  map[string]*TemplateRenderStats{},
+		errors: map[TemplateErrorKey]uint64{},
+	}
+}
+
+// ObserveRender records one request.
+func (m *TemplateRenderMetrics) ObserveRender(template string, status int, handlerDuration, renderDuration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[template]
+	if !ok {
+		s = &TemplateRenderStats{
+			Statuses: map[int]uint64{},
+			Buckets:  make([]uint64, len(m.bounds)),
+			Bounds:   m.bounds,
+		}
+		m.stats[template] = s
+	}
+	s.Requests++
+	s.Statuses[status]++
+	s.HandlerDuration += handlerDuration
+	s.RenderDuration += renderDuration
+	total := handlerDuration + renderDuration
+	for i, bound := range m.bounds {
+		if total <= bound {
+			s.Buckets[i]++
+		}
+	}
+}
+
+// Snapshot returns a copy of the stats collected so far, keyed by template name.
+func (m *TemplateRenderMetrics) Snapshot() map[string]TemplateRenderStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]TemplateRenderStats, len(m.stats))
+	for name, s := range m.stats {
+		c := *s
+		c.Statuses = make(map[int]uint64, len(s.Statuses))
+		for status, n := range s.Statuses {
+			c.Statuses[status] = n
+		}
+		c.Buckets = append([]uint64(nil), s.Buckets...)
+		snapshot[name] = c
+	}
+	return snapshot
+}
+
+// IncError counts one error.
+func (m *TemplateRenderMetrics) IncError(status int, kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[TemplateErrorKey{status, kind}]++
+}
+
+// ErrorCounts returns a copy of the error counts so far.
+func (m *TemplateRenderMetrics) ErrorCounts() map[TemplateErrorKey]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[TemplateErrorKey]uint64, len(m.errors))
+	for key, n := range m.errors {
+		counts[key] = n
+	}
+	return counts
+}
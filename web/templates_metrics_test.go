@@ -0,0 +1,104 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareMetrics(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"500.html":  "error page",
+	})
+	metrics := NewTemplateRenderMetrics()
+	serve := func(h TemplateHandler) {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.Metrics = metrics
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	serve(staticHandler("page.html", nil, nil))
+	serve(staticHandler("page.html", nil, nil))
+	serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		return nil, nil, ErrorResponseStatus(http.StatusForbidden)
+	}))
+	serve(staticHandler("missing.html", nil, nil))
+
+	snapshot := metrics.Snapshot()
+	test.That(t, snapshot, test.ShouldHaveLength, 3)
+
+	page := snapshot["page.html"]
+	test.That(t, page.Requests, test.ShouldEqual, 2)
+	test.That(t, page.Statuses, test.ShouldResemble, map[int]uint64{http.StatusOK: 2})
+	test.That(t, page.Bounds, test.ShouldResemble, DefaultRenderBuckets)
+	test.That(t, page.Buckets[len(page.Buckets)-1], test.ShouldEqual, 2)
+
+	test.That(t, snapshot[""].Statuses, test.ShouldResemble, map[int]uint64{http.StatusForbidden: 1})
+	test.That(t, snapshot["missing.html"].Statuses, test.ShouldResemble, map[int]uint64{http.StatusInternalServerError: 1})
+}
+
+func TestTemplateRenderMetrics(t *testing.T) {
+	metrics := NewTemplateRenderMetrics(100*time.Millisecond, 10*time.Millisecond)
+	metrics.ObserveRender("page", http.StatusOK, time.Millisecond, 2*time.Millisecond)
+	metrics.ObserveRender("page", http.StatusOK, 20*time.Millisecond, 30*time.Millisecond)
+	metrics.ObserveRender("page", http.StatusOK, time.Second, 0)
+
+	s := metrics.Snapshot()["page"]
+	test.That(t, s.Requests, test.ShouldEqual, 3)
+	test.That(t, s.Bounds, test.ShouldResemble, []time.Duration{10 * time.Millisecond, 100 * time.Millisecond})
+	test.That(t, s.Buckets, test.ShouldResemble, []uint64{1, 2})
+	test.That(t, s.HandlerDuration, test.ShouldEqual, 1021*time.Millisecond)
+	test.That(t, s.RenderDuration, test.ShouldEqual, 32*time.Millisecond)
+
+	// snapshots are copies.
+	s.Buckets[0] = 100
+	test.That(t, metrics.Snapshot()["page"].Buckets[0], test.ShouldEqual, 1)
+}
+
+func TestTemplateMiddlewareErrorMetrics(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html":   "page",
+		"broken.html": "{{ .Nope }}",
+		"404.html":    "not found",
+		"5xx.html":    "error page",
+	})
+	metrics := NewTemplateRenderMetrics()
+	serve := func(h TemplateHandler) {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.Metrics = metrics
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	serve(staticHandler("page.html", nil, nil))
+	serve(staticHandler("page.html", nil, ErrNotFound))
+	serve(staticHandler("page.html", nil, ErrNotFound))
+	serve(staticHandler("page.html", nil, errors.New("boom")))
+	serve(staticHandler("missing.html", nil, nil))
+	serve(staticHandler("broken.html", 42, nil))
+	serve(staticHandler("page.html", nil, ErrConflict))
+
+	test.That(t, metrics.ErrorCounts(), test.ShouldResemble, map[TemplateErrorKey]uint64{
+		{http.StatusNotFound, ErrorKindHandler}:                 2,
+		{http.StatusInternalServerError, ErrorKindHandler}:      1,
+		{http.StatusInternalServerError, ErrorKindLookupFailed}: 1,
+		{http.StatusInternalServerError, ErrorKindRenderFailed}: 1,
+		{http.StatusConflict, ErrorKindErrorTemplateMissing}:    1,
+	})
+
+	// metrics that do not count errors are only given renders.
+	mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, ErrNotFound), golog.NewTestLogger(t))
+	mw.Metrics = renderOnlyMetrics{}
+	rr := httptest.NewRecorder()
+	mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+}
+
+type renderOnlyMetrics struct{}
+
+func (renderOnlyMetrics) ObserveRender(string, int, time.Duration, time.Duration) {}
@@ -0,0 +1,379 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/sprig"
+
+	"go.viam.com/utils/web/protojson"
+)
+
+const defaultBaseTemplateName = "app"
+
+// defaultTemplateGlobs select which files are parsed when no globs are configured.
+var defaultTemplateGlobs = []string{"*.html"}
+
+// templateManagerOptions configure how a TemplateManager parses its templates. templateManagerOptions
+// are set by the TemplateManagerOption values passed to the TemplateManager constructors.
+type templateManagerOptions struct {
+	marshalingOpts protojson.MarshalingOptions
+
+	// funcs are merged over the default template functions before parsing.
+	funcs template.FuncMap
+
+	// leftDelim and rightDelim are the action delimiters used when parsing.
+	leftDelim, rightDelim string
+
+	// globs restricts parsing to files matching one of these patterns. When empty,
+	// defaultTemplateGlobs is used.
+	globs []string
+
+	// baseName is the name of the root template that all files are parsed into.
+	baseName string
+
+	// strictKeys makes executing a template fail when it references a missing map key.
+	strictKeys bool
+
+	// exclude reports whether a file or directory with the given base name should be skipped.
+	exclude func(name string) bool
+
+	// defaultFuncs selects which sprig functions are installed before funcs.
+	defaultFuncs defaultFuncSet
+
+	// nameNormalizer maps the relative path of a file to the name of its template. When nil, the
+	// relative path is used as is.
+	nameNormalizer func(filename string) string
+
+	// checkInterval is how long a file system backed manager trusts its cached templates before
+	// checking the files for changes again. Zero checks on every lookup.
+	checkInterval time.Duration
+
+	// maxFileSize and maxFiles limit the size of each template file and the number of template
+	// files found while walking a template directory. Zero means no limit.
+	maxFileSize int64
+	maxFiles    int
+
+	// mode overrides how NewTemplateManagerAuto picks between its live and embedded templates.
+	mode TemplateMode
+}
+
+// defaultFuncSet selects the sprig functions available to templates.
+type defaultFuncSet int
+
+const (
+	defaultFuncsAll defaultFuncSet = iota
+	defaultFuncsSafe
+	defaultFuncsNone
+)
+
+// safeSprigFuncs are the sprig functions installed by WithSafeFuncs. They are limited to string,
+// date, math and default value helpers that cannot reach the environment, network or randomness.
+var safeSprigFuncs = []string{
+	// strings
+	"abbrev", "abbrevboth", "trunc", "trim", "trimall", "trimAll", "trimSuffix", "trimPrefix",
+	"upper", "lower", "title", "untitle", "substr", "repeat", "nospace", "initials", "swapcase",
+	"snakecase", "camelcase", "kebabcase", "wrap", "wrapWith", "contains", "hasPrefix", "hasSuffix",
+	"quote", "squote", "cat", "indent", "nindent", "replace", "plural", "toString", "split",
+	"splitList", "splitn", "toStrings", "join", "sortAlpha",
+	// dates
+	"date", "date_in_zone", "date_modify", "now", "htmlDate", "htmlDateInZone", "dateInZone",
+	"dateModify", "ago", "toDate", "unixEpoch",
+	// math
+	"atoi", "int64", "int", "float64", "add1", "add", "sub", "div", "mod", "mul", "biggest", "max",
+	"min", "ceil", "floor", "round", "until", "untilStep",
+	// defaults
+	"default", "empty", "coalesce", "ternary",
+}
+
+// templateFuncs returns the functions to install in a base template given the full sprig set for
+// the template package in use.
+func (o templateManagerOptions) templateFuncs(sprigFuncs map[string]interface{}) map[string]interface{} {
+	funcs := map[string]interface{}{}
+	switch o.defaultFuncs {
+	case defaultFuncsAll:
+		funcs = sprigFuncs
+	case defaultFuncsSafe:
+		for _, name := range safeSprigFuncs {
+			if f, ok := sprigFuncs[name]; ok {
+				funcs[name] = f
+			}
+		}
+	case defaultFuncsNone:
+	}
+
+	// Support optional protoJson
+	funcs["protoJson"] = createToProtoJSON(o.marshalingOpts)
+
+	// User provided functions take precedence over the defaults.
+	for name, f := range o.funcs {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// middlewareFuncPlaceholders stand in for the functions TemplateMiddleware installs per request,
+// so that html templates using them parse. They render nothing, and so do the functions of a
+// feature the middleware does not have enabled, such as {{ cspNonce }} without
+// ContentSecurityPolicy: templates must only rely on them with the feature on.
+var middlewareFuncPlaceholders = map[string]interface{}{
+	"cspNonce":  func() string { return "" },
+	"csrfToken": func() string { return "" },
+	"csrfField": func() template.HTML { return "" },
+	"requestID": func() string { return "" },
+}
+
+// htmlTemplateFuncs returns the functions to install in an html/template base template: those of
+// templateFuncs and the middlewareFuncPlaceholders, which functions of the same name from
+// WithFuncs override.
+func (o templateManagerOptions) htmlTemplateFuncs() map[string]interface{} {
+	funcs := map[string]interface{}{}
+	for name, f := range middlewareFuncPlaceholders {
+		funcs[name] = f
+	}
+	for name, f := range o.templateFuncs(sprig.FuncMap()) {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// normalizeName returns the name of the template for the file at the given relative path.
+func (o templateManagerOptions) normalizeName(filename string) string {
+	if o.nameNormalizer == nil {
+		return filename
+	}
+	return o.nameNormalizer(filename)
+}
+
+func (o templateManagerOptions) validate() error {
+	if o.leftDelim == "" || o.rightDelim == "" {
+		return errors.New("template delimiters must not be empty")
+	}
+	if o.baseName == "" {
+		return errors.New("base template name must not be empty")
+	}
+	if o.exclude == nil {
+		return errors.New("template exclude func must not be nil")
+	}
+	if o.checkInterval < 0 {
+		return errors.New("template check interval must not be negative")
+	}
+	if o.maxFileSize < 0 || o.maxFiles < 0 {
+		return errors.New("template file limits must not be negative")
+	}
+	for _, pattern := range o.globs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid template glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesGlobs reports whether the file at the given slash-separated relative path should be
+// parsed. Patterns containing a "/" are matched against the whole relative path while all
+// others are matched against the base name.
+func (o templateManagerOptions) matchesGlobs(relPath string) bool {
+	globs := o.globs
+	if len(globs) == 0 {
+		globs = defaultTemplateGlobs
+	}
+	for _, pattern := range globs {
+		target := path.Base(relPath)
+		if strings.Contains(pattern, "/") {
+			target = relPath
+		}
+		if ok, err := path.Match(pattern, target); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TemplateManagerOption configures how a TemplateManager parses its templates.
+type TemplateManagerOption interface {
+	apply(*templateManagerOptions)
+}
+
+// funcTemplateManagerOption wraps a function that modifies templateManagerOptions into an
+// implementation of the TemplateManagerOption interface.
+type funcTemplateManagerOption struct {
+	f func(*templateManagerOptions)
+}
+
+func (fto *funcTemplateManagerOption) apply(o *templateManagerOptions) {
+	fto.f(o)
+}
+
+func newFuncTemplateManagerOption(f func(*templateManagerOptions)) *funcTemplateManagerOption {
+	return &funcTemplateManagerOption{
+		f: f,
+	}
+}
+
+func newTemplateManagerOptions(marshalingOpts protojson.MarshalingOptions, opts []TemplateManagerOption) templateManagerOptions {
+	o := templateManagerOptions{
+		marshalingOpts: marshalingOpts,
+		leftDelim:      "{{",
+		rightDelim:     "}}",
+		baseName:       defaultBaseTemplateName,
+		exclude:        DefaultTemplateExclude,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return o
+}
+
+// WithFuncs returns a TemplateManagerOption which adds the given functions to every parsed
+// template. Functions are merged over the default sprig and protoJson functions, so a
+// function here wins over a default of the same name. It may be passed more than once.
+func WithFuncs(funcs template.FuncMap) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		if o.funcs == nil {
+			o.funcs = template.FuncMap{}
+		}
+		for name, f := range funcs {
+			o.funcs[name] = f
+		}
+	})
+}
+
+// WithMarshalingOptions returns a TemplateManagerOption which sets the protojson.MarshalingOptions
+// used by the protoJson template function.
+func WithMarshalingOptions(opts protojson.MarshalingOptions) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.marshalingOpts = opts
+	})
+}
+
+// WithDelims returns a TemplateManagerOption which sets the action delimiters used when parsing
+// templates. This is useful when templates contain another syntax using "{{" and "}}", such as Vue.
+// Neither delimiter may be empty.
+func WithDelims(left, right string) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.leftDelim = left
+		o.rightDelim = right
+	})
+}
+
+// WithGlobs returns a TemplateManagerOption which only parses files matching at least one of
+// the given path.Match patterns. Patterns are matched against a file's base name unless they
+// contain a "/", in which case they are matched against its path relative to the template
+// directory. Files not matching any pattern are skipped. Defaults to "*.html".
+func WithGlobs(patterns ...string) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.globs = append(o.globs, patterns...)
+	})
+}
+
+// WithExtensions returns a TemplateManagerOption which only parses files having one of the
+// given extensions (e.g. ".html"). It is shorthand for WithGlobs("*.html", ...).
+func WithExtensions(extensions ...string) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		for _, ext := range extensions {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			o.globs = append(o.globs, "*"+ext)
+		}
+	})
+}
+
+// WithBaseName returns a TemplateManagerOption which sets the name of the root template that all
+// files are parsed into. It defaults to "app".
+func WithBaseName(name string) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.baseName = name
+	})
+}
+
+// WithSafeFuncs returns a TemplateManagerOption which installs only a curated subset of the sprig
+// functions: string, date, math and default value helpers. Functions such as env and expandenv
+// that can read the process environment, reach the network or generate keys are left out, which
+// makes it suitable for templates edited by people who should not have that access.
+func WithSafeFuncs() TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.defaultFuncs = defaultFuncsSafe
+	})
+}
+
+// WithNoDefaultFuncs returns a TemplateManagerOption which installs none of the sprig functions.
+// Only protoJson and the functions from WithFuncs are available.
+func WithNoDefaultFuncs() TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.defaultFuncs = defaultFuncsNone
+	})
+}
+
+// WithNameNormalizer returns a TemplateManagerOption which controls the names templates are
+// registered under. The normalizer is called with the slash-separated path of each file relative
+// to the template directory and returns the template's name; by default the path is used as is.
+// It also applies to the keys of NewTemplateManagerFromMap and to the names TemplateMiddleware
+// uses to find error templates. Two files with the same normalized name are an error.
+func WithNameNormalizer(normalize func(filename string) string) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.nameNormalizer = normalize
+	})
+}
+
+// StripExtension is a name normalizer for WithNameNormalizer that drops the file extension, so
+// that "admin/users.html" is looked up as "admin/users".
+func StripExtension(filename string) string {
+	return strings.TrimSuffix(filename, path.Ext(filename))
+}
+
+// WithCheckInterval returns a TemplateManagerOption which controls how often a file system backed
+// TemplateManager checks its files for changes. Lookups within d of the last check use the cached
+// templates without touching the file system. It defaults to zero, which checks on every lookup.
+// It has no effect on embedded templates.
+func WithCheckInterval(d time.Duration) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.checkInterval = d
+	})
+}
+
+// WithMaxFileSize returns a TemplateManagerOption which makes finding a template file larger than
+// the given number of bytes an error, so that a directory of unexpected files is not read into
+// memory. Only files matching the globs are checked. It defaults to zero, which is no limit.
+func WithMaxFileSize(bytes int64) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.maxFileSize = bytes
+	})
+}
+
+// WithMaxFiles returns a TemplateManagerOption which makes finding more than n template files an
+// error. Only files matching the globs are counted. It defaults to zero, which is no limit.
+func WithMaxFiles(n int) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.maxFiles = n
+	})
+}
+
+// DefaultTemplateExclude is the default exclusion rule for template files and directories. It
+// skips names containing "#" or "~", which are commonly editor backup and lock files.
+func DefaultTemplateExclude(name string) bool {
+	return strings.ContainsAny(name, "#~")
+}
+
+// WithExcludeFunc returns a TemplateManagerOption which replaces DefaultTemplateExclude. The
+// function is called with the base name of every file and directory found while walking the
+// template directory; returning true skips the file or the whole directory. Call
+// DefaultTemplateExclude from the function to extend rather than replace the default rule.
+func WithExcludeFunc(exclude func(name string) bool) TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.exclude = exclude
+	})
+}
+
+// WithStrictKeys returns a TemplateManagerOption which makes template execution fail when a
+// template references a key missing from its map data, instead of rendering it as empty. This
+// is applied via template.Option("missingkey=error").
+func WithStrictKeys() TemplateManagerOption {
+	return newFuncTemplateManagerOption(func(o *templateManagerOptions) {
+		o.strictKeys = true
+	})
+}
@@ -0,0 +1,482 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+
+	"go.viam.com/utils/web/protojson"
+)
+
+func TestWithFuncs(t *testing.T) {
+	funcs := template.FuncMap{
+		"formatMoney": func(cents int) string {
+			return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+		},
+		// overrides sprig's upper
+		"upper": func(s string) string { return "custom:" + s },
+	}
+	const source = `{{ formatMoney 150 }} {{ upper "x" }}`
+
+	t.Run("embed", func(t *testing.T) {
+		fsys := fstest.MapFS{"templates/page.html": &fstest.MapFile{Data: []byte(source)}}
+		tm, err := NewTemplateManagerEmbed(fsys, "templates", WithFuncs(funcs))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "$1.50 custom:x")
+	})
+
+	t.Run("fs keeps funcs across reparses", func(t *testing.T) {
+		dir := t.TempDir()
+		pagePath := filepath.Join(dir, "page.html")
+		start := time.Now()
+		writeTemplateFile(t, pagePath, source, start)
+
+		tm, err := NewTemplateManagerFS(dir, WithFuncs(funcs))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "$1.50 custom:x")
+
+		writeTemplateFile(t, pagePath, `again {{ upper "y" }}`, start.Add(time.Second))
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "again custom:y")
+	})
+
+	t.Run("unknown funcs fail without the option", func(t *testing.T) {
+		fsys := fstest.MapFS{"templates/page.html": &fstest.MapFile{Data: []byte(source)}}
+		_, err := NewTemplateManagerEmbed(fsys, "templates")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "formatMoney")
+	})
+}
+
+func TestNewTemplateManager(t *testing.T) {
+	files := map[string]string{
+		"page.html":  `<[ upper "page" ]>`,
+		"notes.txt":  `not a template <[ .Broken`,
+		"other.tmpl": `other`,
+	}
+	fsys := fstest.MapFS{}
+	dir := t.TempDir()
+	for name, contents := range files {
+		fsys["templates/"+name] = &fstest.MapFile{Data: []byte(contents)}
+		writeTemplateFile(t, filepath.Join(dir, name), contents, time.Now())
+	}
+
+	opts := []TemplateManagerOption{
+		WithDelims("<[", "]>"),
+		WithExtensions(".html", "tmpl"),
+		WithBaseName("root"),
+	}
+	sources := map[string]TemplateSource{
+		"embed": EmbedTemplateSource(fsys, "templates"),
+		"dir":   DirTemplateSource(dir),
+	}
+	for name, src := range sources {
+		src := src
+		t.Run(name, func(t *testing.T) {
+			tm, err := NewTemplateManager(src, opts...)
+			test.That(t, err, test.ShouldBeNil)
+
+			test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "PAGE")
+			test.That(t, renderTemplate(t, tm, "other.tmpl"), test.ShouldEqual, "other")
+
+			_, err = tm.LookupTemplate("notes.txt")
+			test.That(t, err, test.ShouldNotBeNil)
+
+			root, err := tm.LookupTemplate("root")
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, root.Name(), test.ShouldEqual, "root")
+		})
+
+		t.Run(name+" validates options", func(t *testing.T) {
+			_, err := NewTemplateManager(src, WithDelims("", "]]"))
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, "delimiters")
+
+			_, err = NewTemplateManager(src, WithBaseName(""))
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, "base template name")
+		})
+	}
+}
+
+func TestWithDelims(t *testing.T) {
+	const source = `<div id="app">{{vueVar}}</div><p>[[ .GoVar ]]</p>`
+	const expected = `<div id="app">{{vueVar}}</div><p>from go</p>`
+	data := struct{ GoVar string }{"from go"}
+
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "vue.html"), source, time.Now())
+	onDisk, err := NewTemplateManagerFS(dir, WithDelims("[[", "]]"))
+	test.That(t, err, test.ShouldBeNil)
+
+	fsys := fstest.MapFS{"templates/vue.html": &fstest.MapFile{Data: []byte(source)}}
+	embedded, err := NewTemplateManagerEmbed(fsys, "templates", WithDelims("[[", "]]"))
+	test.That(t, err, test.ShouldBeNil)
+
+	for name, tm := range map[string]TemplateManager{"fs": onDisk, "embed": embedded} {
+		tm := tm
+		t.Run(name, func(t *testing.T) {
+			mw := NewTemplateMiddleware(tm, staticHandler("vue.html", data, nil), golog.NewTestLogger(t))
+
+			rr := httptest.NewRecorder()
+			mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+			test.That(t, rr.Body.String(), test.ShouldEqual, expected)
+		})
+	}
+}
+
+func TestWithGlobs(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeTemplateFile(t, filepath.Join(dir, "page.html"), "page", now)
+	writeTemplateFile(t, filepath.Join(dir, "mail.tmpl"), "mail", now)
+	// junk that the html parser chokes on
+	writeTemplateFile(t, filepath.Join(dir, ".DS_Store"), "\x00\x01{{", now)
+	writeTemplateFile(t, filepath.Join(dir, "README.md"), "use {{ .Like this", now)
+	writeTemplateFile(t, filepath.Join(dir, ".page.html.swp"), "{{ end }}", now)
+
+	t.Run("defaults to html files", func(t *testing.T) {
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"page.html"})
+	})
+
+	t.Run("multiple patterns", func(t *testing.T) {
+		tm, err := NewTemplateManagerFS(dir, WithGlobs("*.html", "*.tmpl"))
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"mail.tmpl", "page.html"})
+	})
+
+	t.Run("patterns with a slash match relative paths", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(nestedTemplates, "testdata/nested", WithGlobs("admin/*.html"))
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"admin/index.html", "admin/users.html"})
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := NewTemplateManagerFS(dir, WithGlobs("[.html"))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "invalid template glob")
+	})
+}
+
+func TestWithExcludeFunc(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeTemplateFile(t, filepath.Join(dir, "page.html"), "page", now)
+	writeTemplateFile(t, filepath.Join(dir, "_partial.html"), "partial", now)
+	writeTemplateFile(t, filepath.Join(dir, ".hidden.html"), "hidden", now)
+	writeTemplateFile(t, filepath.Join(dir, ".#page.html"), "{{ lock file", now)
+	test.That(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700), test.ShouldBeNil)
+	writeTemplateFile(t, filepath.Join(dir, "sub", "_nested.html"), "nested partial", now)
+	writeTemplateFile(t, filepath.Join(dir, "sub", "nested.html"), "nested", now)
+	test.That(t, os.Mkdir(filepath.Join(dir, "_drafts"), 0o700), test.ShouldBeNil)
+	writeTemplateFile(t, filepath.Join(dir, "_drafts", "draft.html"), "draft", now)
+
+	t.Run("default", func(t *testing.T) {
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{
+			".hidden.html", "_drafts/draft.html", "_partial.html", "page.html", "sub/_nested.html", "sub/nested.html",
+		})
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		exclude := func(name string) bool {
+			return DefaultTemplateExclude(name) || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+		}
+		for _, src := range []TemplateSource{
+			DirTemplateSource(dir),
+			EmbedTemplateSource(os.DirFS(dir).(fs.ReadDirFS), "."),
+		} {
+			tm, err := NewTemplateManager(src, WithExcludeFunc(exclude))
+			test.That(t, err, test.ShouldBeNil)
+			names, err := listTemplates(tm)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, names, test.ShouldResemble, []string{"page.html", "sub/nested.html"})
+		}
+	})
+
+	t.Run("nil func", func(t *testing.T) {
+		_, err := NewTemplateManagerFS(dir, WithExcludeFunc(nil))
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestWithStrictKeys(t *testing.T) {
+	fsys := fstest.MapFS{"templates/page.html": &fstest.MapFile{Data: []byte(`{{ .Missing }}{{ .Present }}`)}}
+	data := map[string]interface{}{"Present": "here"}
+
+	t.Run("default renders empty", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(fsys, "templates")
+		test.That(t, err, test.ShouldBeNil)
+
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", data, nil), golog.NewTestLogger(t))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "here")
+	})
+
+	t.Run("strict mode fails execution", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(fsys, "templates", WithStrictKeys())
+		test.That(t, err, test.ShouldBeNil)
+
+		tmpl, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		err = tmpl.Execute(io.Discard, data)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, `map has no entry for key "Missing"`)
+
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", data, nil), golog.NewTestLogger(t))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+	})
+}
+
+func TestWithBaseName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/app.html": &fstest.MapFile{Data: []byte(`app page {{ template "nav.html" }}`)},
+		"templates/nav.html": &fstest.MapFile{Data: []byte(`nav`)},
+		"templates/app":      &fstest.MapFile{Data: []byte(`extensionless app`)},
+	}
+
+	t.Run("default base name does not clobber app.html", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(fsys, "templates")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "app.html"), test.ShouldEqual, "app page nav")
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"app.html", "nav.html"})
+	})
+
+	t.Run("custom base name allows a file named app", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(fsys, "templates", WithGlobs("*"), WithBaseName("root"))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "app"), test.ShouldEqual, "extensionless app")
+		test.That(t, renderTemplate(t, tm, "app.html"), test.ShouldEqual, "app page nav")
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"app", "app.html", "nav.html"})
+	})
+}
+
+func TestWithSafeFuncs(t *testing.T) {
+	t.Setenv("TEMPLATE_SECRET", "hunter2")
+	newFS := func(source string) fstest.MapFS {
+		return fstest.MapFS{"templates/page.html": &fstest.MapFile{Data: []byte(source)}}
+	}
+	const envSource = `{{ env "TEMPLATE_SECRET" }}`
+
+	t.Run("default includes env", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(newFS(envSource), "templates")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "hunter2")
+
+		ttm, err := NewTextTemplateManager(EmbedTemplateSource(newFS(envSource), "templates"))
+		test.That(t, err, test.ShouldBeNil)
+		tt, err := ttm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		var sb strings.Builder
+		test.That(t, tt.Execute(&sb, nil), test.ShouldBeNil)
+		test.That(t, sb.String(), test.ShouldEqual, "hunter2")
+	})
+
+	t.Run("safe mode rejects env", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(newFS(envSource), "templates", WithSafeFuncs())
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, `function "env" not defined`)
+
+		_, err = NewTemplateManagerEmbed(newFS(`{{ expandenv "$TEMPLATE_SECRET" }}`), "templates", WithSafeFuncs())
+		test.That(t, err, test.ShouldNotBeNil)
+
+		_, err = NewTextTemplateManager(EmbedTemplateSource(newFS(envSource), "templates"), WithSafeFuncs())
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("safe mode keeps string, date and math helpers", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(
+			newFS(`{{ upper "a" }} {{ add 1 2 }} {{ default "x" "" }} {{ date "2006" (toDate "2006-01-02" "2021-05-06") }}`),
+			"templates",
+			WithSafeFuncs(),
+		)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "A 3 x 2021")
+	})
+
+	t.Run("no default funcs", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(newFS(`{{ upper "a" }}`), "templates", WithNoDefaultFuncs())
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, `function "upper" not defined`)
+
+		tm, err := NewTemplateManagerEmbed(
+			newFS(`{{ shout "a" }}`),
+			"templates",
+			WithNoDefaultFuncs(),
+			WithFuncs(template.FuncMap{"shout": strings.ToUpper}),
+		)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "A")
+	})
+}
+
+func TestWithNameNormalizer(t *testing.T) {
+	files := map[string]string{
+		"dashboard.tmpl":   `dashboard {{ template "admin/users" }}`,
+		"admin/users.tmpl": `users`,
+	}
+	fsys := fstest.MapFS{}
+	dir := t.TempDir()
+	test.That(t, os.Mkdir(filepath.Join(dir, "admin"), 0o700), test.ShouldBeNil)
+	for name, contents := range files {
+		fsys["templates/"+name] = &fstest.MapFile{Data: []byte(contents)}
+		writeTemplateFile(t, filepath.Join(dir, filepath.FromSlash(name)), contents, time.Now())
+	}
+
+	sources := map[string]TemplateSource{
+		"embed": EmbedTemplateSource(fsys, "templates"),
+		"dir":   DirTemplateSource(dir),
+	}
+	for name, src := range sources {
+		src := src
+		t.Run(name+" strips extensions", func(t *testing.T) {
+			tm, err := NewTemplateManager(src, WithGlobs("*.tmpl"), WithNameNormalizer(StripExtension))
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, renderTemplate(t, tm, "dashboard"), test.ShouldEqual, "dashboard users")
+			names, err := listTemplates(tm)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, names, test.ShouldResemble, []string{"admin/users", "dashboard"})
+
+			info, err := lookupTemplateInfo(tm, "admin/users")
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, info.SourcePath, test.ShouldEndWith, "users.tmpl")
+
+			_, err = tm.LookupTemplate("dashboard.tmpl")
+			test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+			test.That(t, tm.(TemplateNameNormalizer).NormalizeTemplateName("404.html"), test.ShouldEqual, "404")
+		})
+	}
+
+	t.Run("default keeps the relative path", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(fstest.MapFS{
+			"templates/admin/users.html": &fstest.MapFile{Data: []byte("users")},
+		}, "templates")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "admin/users.html"), test.ShouldEqual, "users")
+		test.That(t, tm.(TemplateNameNormalizer).NormalizeTemplateName("404.html"), test.ShouldEqual, "404.html")
+	})
+
+	t.Run("custom normalizer", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(
+			map[string]string{"Page.HTML": "page"},
+			WithNameNormalizer(strings.ToLower),
+		)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page")
+	})
+
+	t.Run("colliding names are an error", func(t *testing.T) {
+		collide := fstest.MapFS{
+			"templates/page.html": &fstest.MapFile{Data: []byte("html")},
+			"templates/page.tmpl": &fstest.MapFile{Data: []byte("tmpl")},
+		}
+		_, err := NewTemplateManagerEmbed(collide, "templates", WithGlobs("*.html", "*.tmpl"), WithNameNormalizer(StripExtension))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "both named page")
+
+		_, err = NewTemplateManagerFromMap(map[string]string{"a.html": "a", "a.tmpl": "a"}, WithNameNormalizer(StripExtension))
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestStripExtension(t *testing.T) {
+	test.That(t, StripExtension("page.html"), test.ShouldEqual, "page")
+	test.That(t, StripExtension("admin/users.tmpl"), test.ShouldEqual, "admin/users")
+	test.That(t, StripExtension("archive.tar.gz"), test.ShouldEqual, "archive.tar")
+	test.That(t, StripExtension("dir.d/noext"), test.ShouldEqual, "dir.d/noext")
+}
+
+func TestTemplateFileLimits(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "small.html"), "small", time.Now())
+	writeTemplateFile(t, filepath.Join(dir, "big.html"), strings.Repeat("x", 1024), time.Now())
+	writeTemplateFile(t, filepath.Join(dir, "huge.log"), strings.Repeat("x", 4096), time.Now())
+
+	t.Run("max file size", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(os.DirFS(dir).(fs.ReadDirFS), ".", WithMaxFileSize(512))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "big.html is 1024 bytes, more than the limit of 512 bytes")
+
+		tm, err := NewTemplateManagerFS(dir, WithMaxFileSize(512))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = tm.LookupTemplate("small.html")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "more than the limit of 512 bytes")
+
+		// files not matching the globs are not checked.
+		tm, err = NewTemplateManagerFS(dir, WithMaxFileSize(2048))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "small.html"), test.ShouldEqual, "small")
+	})
+
+	t.Run("max files", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(os.DirFS(dir).(fs.ReadDirFS), ".", WithMaxFiles(1))
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "more than 1 template files found")
+
+		tm, err := NewTemplateManagerFS(dir, WithMaxFiles(1))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = tm.LookupTemplate("small.html")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		tm, err = NewTemplateManagerFS(dir, WithMaxFiles(2))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "small.html"), test.ShouldEqual, "small")
+	})
+
+	t.Run("negative limits", func(t *testing.T) {
+		_, err := NewTemplateManagerFS(dir, WithMaxFiles(-1))
+		test.That(t, err, test.ShouldNotBeNil)
+		_, err = NewTemplateManagerFS(dir, WithMaxFileSize(-1))
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestMiddlewareFuncPlaceholders(t *testing.T) {
+	fsys := fstest.MapFS{"templates/page.html": &fstest.MapFile{Data: []byte(`[{{ cspNonce }}{{ csrfField }}{{ requestID }}]`)}}
+	tm, err := NewTemplateManagerEmbed(fsys, "templates")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "[]")
+
+	// they are only for html templates, and are not listed as the manager's functions.
+	_, err = NewTextTemplateManager(EmbedTemplateSource(fsys, "templates"))
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "cspNonce")
+	names := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil).funcNames()
+	for name := range middlewareFuncPlaceholders {
+		test.That(t, names, test.ShouldNotContain, name)
+	}
+}
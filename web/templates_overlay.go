@@ -0,0 +1,80 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"sort"
+
+	"go.uber.org/multierr"
+)
+
+type overlayTM struct {
+	primary  TemplateManager
+	fallback TemplateManager
+}
+
+// NewOverlayTemplateManager returns a TemplateManager that looks templates up in primary first
+// and only consults fallback when primary does not define the name. This allows shipping a
+// default set of embedded templates that operators can override individually on disk. Errors
+// from primary other than ErrTemplateNotFound are returned as is. A template executes within the
+// set it was found in, so templates from primary cannot invoke templates only fallback defines.
+func NewOverlayTemplateManager(primary, fallback TemplateManager) TemplateManager {
+	return &overlayTM{primary: primary, fallback: fallback}
+}
+
+func (tm *overlayTM) LookupTemplate(name string) (*template.Template, error) {
+	t, err := tm.primary.LookupTemplate(name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return t, err
+	}
+	return tm.fallback.LookupTemplate(name)
+}
+
+func (tm *overlayTM) LookupTemplateCtx(ctx context.Context, name string) (*template.Template, error) {
+	t, err := lookupTemplateCtx(ctx, tm.primary, name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return t, err
+	}
+	return lookupTemplateCtx(ctx, tm.fallback, name)
+}
+
+// NormalizeTemplateName uses the normalizer of primary, assuming both managers name templates alike.
+func (tm *overlayTM) NormalizeTemplateName(filename string) string {
+	return normalizeTemplateName(tm.primary, filename)
+}
+
+func (tm *overlayTM) LookupTemplateInfo(name string) (TemplateInfo, error) {
+	info, err := lookupTemplateInfo(tm.primary, name)
+	if err == nil || !errors.Is(err, ErrTemplateNotFound) {
+		return info, err
+	}
+	return lookupTemplateInfo(tm.fallback, name)
+}
+
+func (tm *overlayTM) Names() ([]string, error) {
+	primaryNames, err := listTemplates(tm.primary)
+	if err != nil {
+		return nil, err
+	}
+	fallbackNames, err := listTemplates(tm.fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(primaryNames)+len(fallbackNames))
+	names := make([]string, 0, len(primaryNames)+len(fallbackNames))
+	for _, name := range append(primaryNames, fallbackNames...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (tm *overlayTM) Validate() error {
+	return multierr.Combine(validateTemplates(tm.primary), validateTemplates(tm.fallback))
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestOverlayTemplateManager(t *testing.T) {
+	fallback, err := NewTemplateManagerEmbed(fstest.MapFS{
+		"templates/index.html": &fstest.MapFile{Data: []byte("default index")},
+		"templates/about.html": &fstest.MapFile{Data: []byte("default about")},
+	}, "templates")
+	test.That(t, err, test.ShouldBeNil)
+
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "index.html"), "custom index", time.Now())
+	primary, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	tm := NewOverlayTemplateManager(primary, fallback)
+
+	t.Run("override wins", func(t *testing.T) {
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "custom index")
+	})
+
+	t.Run("fallback hit", func(t *testing.T) {
+		test.That(t, renderTemplate(t, tm, "about.html"), test.ShouldEqual, "default about")
+	})
+
+	t.Run("missing everywhere", func(t *testing.T) {
+		_, err := tm.LookupTemplate("missing.html")
+		test.That(t, errors.Is(err, ErrTemplateNotFound), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldEqual, "cannot find template missing.html")
+	})
+
+	t.Run("names", func(t *testing.T) {
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"about.html", "index.html"})
+	})
+
+	t.Run("genuine errors propagate", func(t *testing.T) {
+		writeTemplateFile(t, filepath.Join(dir, "broken.html"), "{{ .Oops ", time.Now())
+
+		_, err := tm.LookupTemplate("about.html")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, errors.Is(err, ErrTemplateNotFound), test.ShouldBeFalse)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "broken.html")
+	})
+}
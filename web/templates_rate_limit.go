@@ -0,0 +1,130 @@
+package web
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter decides whether a request may proceed, for TemplateMiddleware's RateLimiter.
+// Implementations must be safe for concurrent use.
+type RateLimiter interface {
+	// Allow reports whether a request from the client identified by key may proceed, and if not,
+	// how long until it may retry.
+	Allow(key string) (ok bool, retryAfter time.Duration)
+}
+
+// ClientIP returns the IP address of r's client: its RemoteAddr or, if trustForwardedFor is set,
+// the first address in its X-Forwarded-For header. Only trust X-Forwarded-For behind a proxy
+// that sets it, since clients can send anything.
+func ClientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitKey returns the key r is rate limited under.
+func (tm *TemplateMiddleware) rateLimitKey(r *http.Request) string {
+	if tm.RateLimitKey != nil {
+		return tm.RateLimitKey(r)
+	}
+	return ClientIP(r, tm.TrustForwardedFor)
+}
+
+// allow reports whether r may proceed, responding with a 429 if not.
+func (tm *TemplateMiddleware) allow(w http.ResponseWriter, r *http.Request) bool {
+	ok, retryAfter := tm.RateLimiter.Allow(tm.rateLimitKey(r))
+	if ok {
+		return true
+	}
+	tm.handleError(w, r, ErrTooManyRequestsAfter(retryAfter))
+	return false
+}
+
+// TokenBucketLimiter is an in memory RateLimiter giving each key a bucket of tokens that refills
+// at a steady rate; each request takes a token and is denied when there are none.
+type TokenBucketLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	lastPruned time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter returns a TokenBucketLimiter allowing each key burst requests at once and
+// perSecond requests a second after that.
+func NewTokenBucketLimiter(perSecond float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token from key's bucket if it has one.
+func (l *TokenBucketLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// fullAfter is how long a bucket takes to refill from empty.
+func (l *TokenBucketLimiter) fullAfter() time.Duration {
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// prune drops buckets that have refilled, since they are no different from new ones, at most
+// once per refill period. l.mu must be held.
+func (l *TokenBucketLimiter) prune(now time.Time) {
+	full := l.fullAfter()
+	if now.Sub(l.lastPruned) < full {
+		return
+	}
+	l.lastPruned = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
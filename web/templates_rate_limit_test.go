@@ -0,0 +1,74 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareRateLimit(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"429.html":  "slow down",
+	})
+	now := time.Unix(1000, 0)
+	limiter := NewTokenBucketLimiter(0.5, 2)
+	limiter.now = func() time.Time { return now }
+
+	mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), golog.NewTestLogger(t))
+	mw.RateLimiter = limiter
+	serve := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			rr := serve("10.0.0.1:1234", "")
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+			test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		rr := serve("10.0.0.1:5678", "")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusTooManyRequests)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "slow down")
+		test.That(t, rr.Header().Get("Retry-After"), test.ShouldEqual, "2")
+
+		now = now.Add(2 * time.Second)
+		test.That(t, serve("10.0.0.1:1234", "").Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, serve("10.0.0.1:1234", "").Code, test.ShouldEqual, http.StatusTooManyRequests)
+	})
+
+	t.Run("per key isolation", func(t *testing.T) {
+		test.That(t, serve("10.0.0.2:1234", "").Code, test.ShouldEqual, http.StatusOK)
+
+		// Without trusting it, X-Forwarded-For is ignored.
+		test.That(t, serve("10.0.0.1:1234", "192.168.0.1").Code, test.ShouldEqual, http.StatusTooManyRequests)
+		mw.TrustForwardedFor = true
+		test.That(t, serve("10.0.0.1:1234", "192.168.0.1, 10.0.0.1").Code, test.ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestTokenBucketLimiterPrunes(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewTokenBucketLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+	ok, _ := limiter.Allow("a")
+	test.That(t, ok, test.ShouldBeTrue)
+	now = now.Add(time.Minute)
+	ok, _ = limiter.Allow("b")
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, limiter.buckets, test.ShouldHaveLength, 1)
+}
@@ -0,0 +1,23 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Redirect returns a Template that, rather than rendering anything, redirects the client to url
+// with the given 3xx status, such as http.StatusSeeOther after handling a form POST. url may be
+// absolute or relative to the request path, as with http.Redirect. An error is returned for any
+// code outside 300-399.
+func Redirect(url string, code int) (*Template, error) {
+	if code < 300 || code > 399 {
+		return nil, fmt.Errorf("invalid redirect status %d: must be 3xx", code)
+	}
+	return &Template{redirect: url, status: code}, nil
+}
+
+// writeRedirect sends the redirect t describes.
+func (tm *TemplateMiddleware) writeRedirect(w http.ResponseWriter, r *http.Request, t *Template) {
+	tm.logger(r).Debug("redirecting", "location", t.redirect, "status", t.status)
+	http.Redirect(w, r, t.redirect, t.status)
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareRedirect(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(method, target, url string, code int) (*httptest.ResponseRecorder, map[string]interface{}) {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			t, err := Redirect(url, code)
+			return t, nil, err
+		})
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, h, logger)
+		mw.LogRequests = true
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		entries := logs.FilterMessage("served template request").All()
+		test.That(t, entries, test.ShouldHaveLength, 1)
+		return rr, entries[0].ContextMap()
+	}
+
+	t.Run("found", func(t *testing.T) {
+		rr, fields := serve(http.MethodGet, "/old", "https://example.com/new", http.StatusFound)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusFound)
+		test.That(t, rr.Header().Get("Location"), test.ShouldEqual, "https://example.com/new")
+		test.That(t, fields["status"], test.ShouldEqual, http.StatusFound)
+	})
+
+	t.Run("see other after POST", func(t *testing.T) {
+		rr, fields := serve(http.MethodPost, "/items/new", "../items", http.StatusSeeOther)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusSeeOther)
+		test.That(t, rr.Header().Get("Location"), test.ShouldEqual, "/items")
+		test.That(t, fields["status"], test.ShouldEqual, http.StatusSeeOther)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		for _, code := range []int{0, http.StatusOK, http.StatusNotFound} {
+			tmpl, err := Redirect("/", code)
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, "3xx")
+			test.That(t, tmpl, test.ShouldBeNil)
+		}
+	})
+}
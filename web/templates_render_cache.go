@@ -0,0 +1,289 @@
+package web
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// Defaults for TemplateMiddleware's render cache.
+const (
+	DefaultRenderCacheTTL          = time.Minute
+	DefaultMaxRenderCacheEntrySize = 1 << 20
+)
+
+// CachedResponse is a whole response stored in a ResponseCache.
+type CachedResponse struct {
+	Status int
+	// Header holds the headers replayed with the response, such as Content-Type and ETag.
+	Header http.Header
+	Body   []byte
+	// Generation identifies the parse of the templates the response was rendered with. Responses
+	// from an older generation are not served.
+	Generation uint64
+}
+
+// ResponseCache stores responses for TemplateMiddleware's RenderCache. Implementations must be
+// safe for concurrent use and must not modify the responses they are given or return.
+type ResponseCache interface {
+	// Get returns the response cached under key, if it has not expired.
+	Get(key string) (*CachedResponse, bool)
+	// Set caches resp under key for ttl.
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+// renderCachedHeaders are the headers stored with a cached response.
+var renderCachedHeaders = []string{"Cache-Control", "Content-Language", "Content-Type", "ETag", "Last-Modified", "Vary"}
+
+// renderCacheKey returns the cache key for r, if its response may be cached.
+func (tm *TemplateMiddleware) renderCacheKey(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+	if tm.RenderCacheKey != nil {
+		return tm.RenderCacheKey(r)
+	}
+	if r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "" {
+		// The response may be for this visitor alone.
+		return "", false
+	}
+	key := r.URL.String()
+	if htmxPartialRequest(r) {
+		// Handlers may render a fragment instead of the page.
+		key += " (htmx)"
+	}
+	if tm.wantsJSON(r) {
+		key += " (json)"
+	}
+	return key, true
+}
+
+func (tm *TemplateMiddleware) renderCacheTTL() time.Duration {
+	if tm.RenderCacheTTL == 0 {
+		return DefaultRenderCacheTTL
+	}
+	return tm.RenderCacheTTL
+}
+
+func (tm *TemplateMiddleware) maxRenderCacheEntrySize() int {
+	if tm.MaxRenderCacheEntrySize == 0 {
+		return DefaultMaxRenderCacheEntrySize
+	}
+	return tm.MaxRenderCacheEntrySize
+}
+
+// writeCachedResponse replays a cached response, or just its status if the client already has
+// it.
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, cached *CachedResponse) {
+	if tag := cached.Header.Get("ETag"); tag != "" && etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	for name, values := range cached.Header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(cached.Body)))
+	w.WriteHeader(cached.Status)
+	_, err := w.Write(cached.Body)
+	utils.UncheckedError(err)
+}
+
+// renderCacheRecorder keeps a copy of a response as it is written.
+type renderCacheRecorder struct {
+	http.ResponseWriter
+	status  int
+	body    bytes.Buffer
+	maxSize int
+	tooBig  bool
+}
+
+func newRenderCacheRecorder(w http.ResponseWriter, maxSize int) *renderCacheRecorder {
+	return &renderCacheRecorder{ResponseWriter: w, maxSize: maxSize}
+}
+
+func (w *renderCacheRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *renderCacheRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.tooBig {
+		if w.body.Len()+len(b) > w.maxSize {
+			w.tooBig = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *renderCacheRecorder) Flush() {
+	utils.UncheckedError(http.NewResponseController(w.ResponseWriter).Flush())
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *renderCacheRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cached returns the recorded response if it may be cached.
+func (w *renderCacheRecorder) cached(generation uint64) *CachedResponse {
+	h := w.Header()
+	if w.status != http.StatusOK || w.tooBig || h.Get("Content-Encoding") != "" || len(h.Values("Set-Cookie")) > 0 {
+		return nil
+	}
+	cached := &CachedResponse{
+		Status:     w.status,
+		Header:     http.Header{},
+		Body:       append([]byte(nil), w.body.Bytes()...),
+		Generation: generation,
+	}
+	for _, name := range renderCachedHeaders {
+		for _, value := range h.Values(name) {
+			cached.Header.Add(name, value)
+		}
+	}
+	return cached
+}
+
+// templateGenerations numbers template sets as they are created so that caches can tell when the
+// templates they rendered with have been replaced.
+var templateGenerations uint64
+
+func nextTemplateGeneration() uint64 {
+	return atomic.AddUint64(&templateGenerations, 1)
+}
+
+// templateGenerationer is implemented by the managers in this package to report which parse of
+// their templates is current.
+type templateGenerationer interface {
+	templateGeneration(ctx context.Context) (uint64, error)
+}
+
+// templateGeneration returns the generation of tm's current templates, or false if tm cannot
+// report one, in which case cached responses are never invalidated by a reparse.
+func templateGeneration(ctx context.Context, tm TemplateManager) (uint64, bool) {
+	g, ok := tm.(templateGenerationer)
+	if !ok {
+		return 0, false
+	}
+	generation, err := g.templateGeneration(ctx)
+	if err != nil {
+		return 0, false
+	}
+	return generation, true
+}
+
+func (tm *embedTM) templateGeneration(ctx context.Context) (uint64, error) {
+	return tm.cachedTemplates.generation, nil
+}
+
+func (tm *fsTM) templateGeneration(ctx context.Context) (uint64, error) {
+	ts, err := tm.templatesCtx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ts.generation, nil
+}
+
+func (tm *watchedTM) templateGeneration(ctx context.Context) (uint64, error) {
+	return tm.templates.loaded().generation, nil
+}
+
+// templateGeneration of an overlay changes whenever either side's does, since every new
+// generation is larger than all before it.
+func (tm *overlayTM) templateGeneration(ctx context.Context) (uint64, error) {
+	var generation uint64
+	for _, side := range []TemplateManager{tm.primary, tm.fallback} {
+		g, ok := templateGeneration(ctx, side)
+		if !ok {
+			return 0, errors.New("template manager does not report generations")
+		}
+		if g > generation {
+			generation = g
+		}
+	}
+	return generation, nil
+}
+
+// MemoryResponseCache is an in memory ResponseCache that evicts the least recently used entry
+// once it holds its maximum number of entries.
+type MemoryResponseCache struct {
+	maxEntries int
+
+	mu sync.Mutex
+	// lru orders entries from most to least recently used.
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type memoryResponseEntry struct {
+	key     string
+	resp    *CachedResponse
+	expires time.Time
+}
+
+// NewMemoryResponseCache returns an empty MemoryResponseCache holding at most maxEntries
+// responses.
+func NewMemoryResponseCache(maxEntries int) *MemoryResponseCache {
+	return &MemoryResponseCache{maxEntries: maxEntries, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get returns the response cached under key, if it has not expired.
+func (c *MemoryResponseCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryResponseEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.resp, true
+}
+
+// Set caches resp under key for ttl.
+func (c *MemoryResponseCache) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&memoryResponseEntry{key: key, resp: resp, expires: time.Now().Add(ttl)})
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Purge drops every cached response.
+func (c *MemoryResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// remove drops elem from the cache. c.mu must be held.
+func (c *MemoryResponseCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*memoryResponseEntry)
+	delete(c.entries, entry.key)
+}
@@ -0,0 +1,185 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareRenderCache(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page {{.}}",
+		"404.html":  "not found",
+	})
+	newMiddleware := func(calls *int, data interface{}, err error) *TemplateMiddleware {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			*calls++
+			return NamedTemplate("page.html"), data, err
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.RenderCache = NewMemoryResponseCache(10)
+		mw.ETags = true
+		return mw
+	}
+	serve := func(mw *TemplateMiddleware, method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	t.Run("hits skip the handler", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, 1, nil)
+		first := serve(mw, http.MethodGet, "/a")
+		second := serve(mw, http.MethodGet, "/a")
+		test.That(t, calls, test.ShouldEqual, 1)
+		test.That(t, second.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, second.Body.String(), test.ShouldEqual, "page 1")
+		test.That(t, second.Header().Get("ETag"), test.ShouldEqual, first.Header().Get("ETag"))
+		test.That(t, second.Header().Get("Content-Length"), test.ShouldEqual, "6")
+
+		serve(mw, http.MethodGet, "/b")
+		test.That(t, calls, test.ShouldEqual, 2)
+
+		req := httptest.NewRequest(http.MethodGet, "/a", nil)
+		req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotModified)
+		test.That(t, calls, test.ShouldEqual, 2)
+	})
+
+	t.Run("only stores successful GET responses", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, 1, ErrorResponseStatus(http.StatusNotFound))
+		test.That(t, serve(mw, http.MethodGet, "/").Code, test.ShouldEqual, http.StatusNotFound)
+		serve(mw, http.MethodGet, "/")
+		test.That(t, calls, test.ShouldEqual, 2)
+
+		calls = 0
+		mw = newMiddleware(&calls, 1, nil)
+		serve(mw, http.MethodHead, "/")
+		serve(mw, http.MethodPost, "/")
+		serve(mw, http.MethodPost, "/")
+		test.That(t, calls, test.ShouldEqual, 3)
+		serve(mw, http.MethodGet, "/")
+		test.That(t, serve(mw, http.MethodHead, "/").Body.Len(), test.ShouldEqual, 0)
+		test.That(t, calls, test.ShouldEqual, 4)
+	})
+
+	t.Run("key func can opt out", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, 1, nil)
+		mw.RenderCacheKey = func(r *http.Request) (string, bool) {
+			return r.URL.Path, r.URL.Query().Get("session") == ""
+		}
+		serve(mw, http.MethodGet, "/?session=1")
+		serve(mw, http.MethodGet, "/?session=1")
+		test.That(t, calls, test.ShouldEqual, 2)
+		serve(mw, http.MethodGet, "/?other=1")
+		serve(mw, http.MethodGet, "/?other=2")
+		test.That(t, calls, test.ShouldEqual, 3)
+	})
+
+	t.Run("requests with credentials are not cached", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, 1, nil)
+		for _, header := range []string{"Cookie", "Authorization"} {
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set(header, "secret")
+				mw.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}
+		test.That(t, calls, test.ShouldEqual, 4)
+	})
+
+	t.Run("negotiated JSON is kept apart", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, map[string]string{"Name": "x"}, nil)
+		mw.NegotiateJSON = true
+		get := func(accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", accept)
+			rr := httptest.NewRecorder()
+			mw.ServeHTTP(rr, req)
+			return rr
+		}
+		test.That(t, get("application/json").Header().Get("Content-Type"), test.ShouldEqual, jsonContentType)
+		html := get("text/html")
+		test.That(t, html.Header().Get("Content-Type"), test.ShouldEqual, DefaultTemplateContentType)
+		test.That(t, html.Body.String(), test.ShouldEqual, "page map[Name:x]")
+		test.That(t, get("application/json").Header().Get("Content-Type"), test.ShouldEqual, jsonContentType)
+		test.That(t, calls, test.ShouldEqual, 2)
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, 1, nil)
+		mw.RenderCacheTTL = time.Millisecond
+		serve(mw, http.MethodGet, "/")
+		time.Sleep(5 * time.Millisecond)
+		serve(mw, http.MethodGet, "/")
+		test.That(t, calls, test.ShouldEqual, 2)
+	})
+
+	t.Run("large responses are not stored", func(t *testing.T) {
+		var calls int
+		mw := newMiddleware(&calls, 1, nil)
+		mw.MaxRenderCacheEntrySize = 3
+		serve(mw, http.MethodGet, "/")
+		test.That(t, serve(mw, http.MethodGet, "/").Body.String(), test.ShouldEqual, "page 1")
+		test.That(t, calls, test.ShouldEqual, 2)
+	})
+}
+
+func TestTemplateMiddlewareRenderCacheReload(t *testing.T) {
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "page.html")
+	test.That(t, os.WriteFile(pagePath, []byte("first"), 0o600), test.ShouldBeNil)
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), golog.NewTestLogger(t))
+	mw.RenderCache = NewMemoryResponseCache(10)
+	serve := func() string {
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr.Body.String()
+	}
+	test.That(t, serve(), test.ShouldEqual, "first")
+	test.That(t, serve(), test.ShouldEqual, "first")
+
+	test.That(t, os.WriteFile(pagePath, []byte("second"), 0o600), test.ShouldBeNil)
+	future := time.Now().Add(time.Minute)
+	test.That(t, os.Chtimes(pagePath, future, future), test.ShouldBeNil)
+	test.That(t, serve(), test.ShouldEqual, "second")
+}
+
+func TestMemoryResponseCache(t *testing.T) {
+	cache := NewMemoryResponseCache(2)
+	resp := func(body string) *CachedResponse {
+		return &CachedResponse{Status: http.StatusOK, Body: []byte(body)}
+	}
+	cache.Set("a", resp("a"), time.Minute)
+	cache.Set("b", resp("b"), time.Minute)
+	_, ok := cache.Get("a")
+	test.That(t, ok, test.ShouldBeTrue)
+	cache.Set("c", resp("c"), time.Minute)
+
+	_, ok = cache.Get("b")
+	test.That(t, ok, test.ShouldBeFalse)
+	got, ok := cache.Get("a")
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, string(got.Body), test.ShouldEqual, "a")
+
+	cache.Purge()
+	_, ok = cache.Get("a")
+	test.That(t, ok, test.ShouldBeFalse)
+}
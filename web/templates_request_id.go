@@ -0,0 +1,75 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header TemplateMiddleware reads and sends request IDs in.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest incoming request ID that is honored.
+const maxRequestIDLength = 128
+
+// RequestID returns the ID a TemplateMiddleware with RequestIDs set gave the request with the
+// given context, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// validRequestID reports whether an incoming request ID is safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// withRequestID returns r carrying its request ID, taken from RequestIDHeader or generated, along
+// with a logger that includes it, and sends the ID back in the response.
+func (tm *TemplateMiddleware) withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		var err error
+		if id, err = newRequestID(); err != nil {
+			tm.baseLogger().Error("failed to generate request ID", "error", err)
+			return r
+		}
+	}
+	w.Header().Set(RequestIDHeader, id)
+	ctx := context.WithValue(r.Context(), ctxKeyRequestID, id)
+	ctx = context.WithValue(ctx, ctxKeyRequestLogger, loggerWith(tm.baseLogger(), "request_id", id))
+	return r.WithContext(ctx)
+}
+
+// logger returns the logger for messages about r.
+func (tm *TemplateMiddleware) logger(r *http.Request) Logger {
+	if logger, ok := r.Context().Value(ctxKeyRequestLogger).(Logger); ok {
+		return logger
+	}
+	return tm.baseLogger()
+}
+
+// baseLogger returns Log, falling back to Logger and then to logging nothing.
+func (tm *TemplateMiddleware) baseLogger() Logger {
+	if tm.Log != nil {
+		return tm.Log
+	}
+	return GologLogger(tm.Logger)
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateMiddlewareRequestIDs(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page {{ requestID }}",
+		"500.html":  "error {{ requestID }}",
+	})
+	var handlerID string
+	serve := func(handlerErr error, incoming string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			handlerID = RequestID(r.Context())
+			return NamedTemplate("page.html"), nil, handlerErr
+		})
+		mw := NewTemplateMiddleware(tm, h, logger)
+		mw.RequestIDs = true
+		mw.LogRequests = true
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if incoming != "" {
+			req.Header.Set(RequestIDHeader, incoming)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		var fields []map[string]interface{}
+		for _, entry := range logs.All() {
+			fields = append(fields, entry.ContextMap())
+		}
+		return rr, fields
+	}
+
+	t.Run("successful render", func(t *testing.T) {
+		rr, logged := serve(nil, "")
+		id := rr.Header().Get(RequestIDHeader)
+		test.That(t, id, test.ShouldHaveLength, 32)
+		test.That(t, handlerID, test.ShouldEqual, id)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page "+id)
+		test.That(t, logged, test.ShouldHaveLength, 1)
+		test.That(t, logged[0]["request_id"], test.ShouldEqual, id)
+
+		rr, _ = serve(nil, "")
+		test.That(t, rr.Header().Get(RequestIDHeader), test.ShouldNotEqual, id)
+	})
+
+	t.Run("incoming ID", func(t *testing.T) {
+		rr, _ := serve(nil, "from-the-proxy")
+		test.That(t, rr.Header().Get(RequestIDHeader), test.ShouldEqual, "from-the-proxy")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page from-the-proxy")
+
+		rr, _ = serve(nil, "no spaces allowed")
+		test.That(t, rr.Header().Get(RequestIDHeader), test.ShouldHaveLength, 32)
+	})
+
+	t.Run("templated 500", func(t *testing.T) {
+		rr, logged := serve(errors.New("whoops"), "")
+		id := rr.Header().Get(RequestIDHeader)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error "+id)
+		test.That(t, len(logged), test.ShouldBeGreaterThan, 1)
+		for _, fields := range logged {
+			test.That(t, fields["request_id"], test.ShouldEqual, id)
+		}
+	})
+}
+
+func TestTemplateMiddlewareRequestIDsRenderCache(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page {{ requestID }}"})
+	mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), golog.NewTestLogger(t))
+	mw.RequestIDs = true
+	mw.RenderCache = NewMemoryResponseCache(10)
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	first, second := serve(), serve()
+	test.That(t, first.Body.String(), test.ShouldEqual, "page "+first.Header().Get(RequestIDHeader))
+	test.That(t, second.Body.String(), test.ShouldEqual, "page "+second.Header().Get(RequestIDHeader))
+	test.That(t, second.Body.String(), test.ShouldNotEqual, first.Body.String())
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/edaniels/golog"
+)
+
+// TemplateRouter routes requests to TemplateHandlers, wrapping each in a TemplateMiddleware that
+// shares the router's templates, logger and configuration. Patterns are those of http.ServeMux,
+// including a method and wildcards such as "GET /items/{id}", with wildcard values available to
+// handlers from r.PathValue.
+type TemplateRouter struct {
+	templates TemplateManager
+	logger    golog.Logger
+	mux       *http.ServeMux
+	notFound  *TemplateMiddleware
+
+	// Configure, if set, is called with every middleware the router creates before any further
+	// options are set on it, to apply configuration common to all routes.
+	Configure func(mw *TemplateMiddleware)
+}
+
+// NewTemplateRouter returns a TemplateRouter rendering with the given templates and logging to
+// logger. Until NotFound is called, unrouted requests get 404.html.
+func NewTemplateRouter(templates TemplateManager, logger golog.Logger) *TemplateRouter {
+	return &TemplateRouter{templates: templates, logger: logger, mux: http.NewServeMux()}
+}
+
+// newMiddleware returns a middleware for h configured as the router's routes are.
+func (tr *TemplateRouter) newMiddleware(h TemplateHandler) *TemplateMiddleware {
+	mw := NewTemplateMiddleware(tr.templates, h, tr.logger)
+	if tr.Configure != nil {
+		tr.Configure(mw)
+	}
+	return mw
+}
+
+// Handle routes requests matching pattern to h and returns the middleware serving them, whose
+// fields may be changed before the router is used to configure this route alone.
+func (tr *TemplateRouter) Handle(pattern string, h TemplateHandler) *TemplateMiddleware {
+	mw := tr.newMiddleware(h)
+	tr.mux.Handle(pattern, mw)
+	return mw
+}
+
+// HandleFunc is Handle for a handler function.
+func (tr *TemplateRouter) HandleFunc(pattern string, f TemplateHandlerFunc) *TemplateMiddleware {
+	return tr.Handle(pattern, f)
+}
+
+// HandleSSE routes requests matching pattern to h, typically an SSEHandler, and returns the
+// middleware serving them. The middleware has no timeout and no render cache, so that event
+// streams last as long as their clients.
+func (tr *TemplateRouter) HandleSSE(pattern string, h http.Handler) *TemplateMiddleware {
+	mw := tr.newMiddleware(AsTemplateHandler(h))
+	mw.Timeout = -1
+	mw.RenderCache = nil
+	tr.mux.Handle(pattern, mw)
+	return mw
+}
+
+// NotFound sets the handler for requests that match no route, including those that only match
+// with another method, and returns the middleware serving them. A nil h renders 404.html.
+func (tr *TemplateRouter) NotFound(h TemplateHandler) *TemplateMiddleware {
+	if h == nil {
+		h = notFoundHandler
+	}
+	tr.notFound = tr.newMiddleware(h)
+	return tr.notFound
+}
+
+var notFoundHandler = TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+	return nil, nil, ErrorResponseStatus(http.StatusNotFound)
+})
+
+// ServeHTTP routes the request.
+func (tr *TemplateRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := tr.mux.Handler(r); pattern == "" {
+		notFound := tr.notFound
+		if notFound == nil {
+			notFound = tr.newMiddleware(notFoundHandler)
+		}
+		notFound.ServeHTTP(w, r)
+		return
+	}
+	tr.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestTemplateRouter(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"home.html":    "home",
+		"item.html":    "item {{ . }}",
+		"created.html": "created",
+		"404.html":     "not found",
+		"lost.html":    "lost: {{ . }}",
+	})
+	newRouter := func() *TemplateRouter {
+		router := NewTemplateRouter(tm, golog.NewTestLogger(t))
+		router.Configure = func(mw *TemplateMiddleware) {
+			mw.ContentType = "text/html; charset=utf-8; routed"
+		}
+		router.Handle("GET /{$}", staticHandler("home.html", nil, nil))
+		router.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate("item.html"), r.PathValue("id"), nil
+		})
+		mw := router.Handle("POST /items", staticHandler("created.html", nil, nil))
+		mw.ContentType = "text/plain; charset=utf-8"
+		return router
+	}
+	serve := func(router *TemplateRouter, method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	router := newRouter()
+	for _, tc := range []struct {
+		method, target string
+		status         int
+		body           string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "home"},
+		{http.MethodGet, "/items/42", http.StatusOK, "item 42"},
+		{http.MethodPost, "/items", http.StatusOK, "created"},
+		{http.MethodGet, "/nowhere", http.StatusNotFound, "not found"},
+		{http.MethodDelete, "/items/42", http.StatusNotFound, "not found"},
+	} {
+		rr := serve(router, tc.method, tc.target)
+		test.That(t, rr.Code, test.ShouldEqual, tc.status)
+		test.That(t, rr.Body.String(), test.ShouldEqual, tc.body)
+	}
+	test.That(t, serve(router, http.MethodGet, "/").Header().Get("Content-Type"), test.ShouldEqual, "text/html; charset=utf-8; routed")
+	test.That(t, serve(router, http.MethodPost, "/items").Header().Get("Content-Type"), test.ShouldEqual, "text/plain; charset=utf-8")
+	test.That(t, serve(router, http.MethodGet, "/nowhere").Header().Get("Content-Type"), test.ShouldEqual, DefaultTemplateContentType)
+
+	t.Run("catch-all", func(t *testing.T) {
+		router := newRouter()
+		router.NotFound(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate("lost.html").WithStatus(http.StatusNotFound), r.URL.Path, nil
+		}))
+		rr := serve(router, http.MethodGet, "/nowhere")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "lost: /nowhere")
+		test.That(t, serve(router, http.MethodGet, "/items/1").Body.String(), test.ShouldEqual, "item 1")
+	})
+}
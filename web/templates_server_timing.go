@@ -0,0 +1,71 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// serverTimingWriter adds a Server-Timing header to the response just before it is sent,
+// reporting how long the handler took and, unless the template streams, how long rendering took.
+type serverTimingWriter struct {
+	http.ResponseWriter
+	req  *templateRequest
+	sent bool
+}
+
+func (w *serverTimingWriter) setHeader() {
+	if w.sent {
+		return
+	}
+	w.sent = true
+	if value := w.req.serverTiming(); value != "" {
+		w.Header().Add("Server-Timing", value)
+	}
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the wrapped writer, or one it wraps, does.
+func (w *serverTimingWriter) Flush() {
+	w.setHeader()
+	utils.UncheckedError(http.NewResponseController(w.ResponseWriter).Flush())
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serverTiming returns the Server-Timing header value for the request so far, or "" if there is
+// nothing to report, as when the handler wrote its own response.
+func (req *templateRequest) serverTiming() string {
+	var metrics []string
+	if req.cache != "" {
+		metrics = append(metrics, "cache;desc="+req.cache)
+	}
+	if !req.handlerDone.IsZero() {
+		handler, render := req.durations()
+		metrics = append(metrics, "handler;dur="+serverTimingDuration(handler))
+		if !req.streaming {
+			metrics = append(metrics, "render;dur="+serverTimingDuration(render))
+		}
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// serverTimingDuration formats d in milliseconds, as Server-Timing durations are.
+func serverTimingDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+// parseServerTiming returns the metrics of a Server-Timing header by name, each with its
+// parameters.
+func parseServerTiming(t *testing.T, header string) map[string]map[string]string {
+	t.Helper()
+	metrics := map[string]map[string]string{}
+	for _, metric := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(metric), ";")
+		params := map[string]string{}
+		for _, param := range parts[1:] {
+			key, value, ok := strings.Cut(param, "=")
+			test.That(t, ok, test.ShouldBeTrue)
+			params[key] = value
+		}
+		metrics[parts[0]] = params
+	}
+	return metrics
+}
+
+func TestTemplateMiddlewareServerTiming(t *testing.T) {
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"page.html": `page{{ slow }}`,
+	}, WithFuncs(template.FuncMap{
+		"slow": func() string {
+			time.Sleep(20 * time.Millisecond)
+			return ""
+		},
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	slowHandler := func(tmpl *Template) TemplateHandler {
+		return TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return tmpl, nil, nil
+		})
+	}
+	serve := func(mw *TemplateMiddleware) *httptest.ResponseRecorder {
+		mw.ServerTiming = true
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+	duration := func(t *testing.T, params map[string]string) float64 {
+		t.Helper()
+		d, err := strconv.ParseFloat(params["dur"], 64)
+		test.That(t, err, test.ShouldBeNil)
+		return d
+	}
+
+	t.Run("buffered", func(t *testing.T) {
+		rr := serve(NewTemplateMiddleware(tm, slowHandler(NamedTemplate("page.html")), golog.NewTestLogger(t)))
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		metrics := parseServerTiming(t, rr.Header().Get("Server-Timing"))
+		test.That(t, metrics, test.ShouldHaveLength, 2)
+		handler, render := duration(t, metrics["handler"]), duration(t, metrics["render"])
+		test.That(t, handler, test.ShouldBeBetween, 9, 1000)
+		test.That(t, render, test.ShouldBeBetween, 19, 1000)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		rr := serve(NewTemplateMiddleware(tm, slowHandler(NamedTemplate("page.html").Streaming()), golog.NewTestLogger(t)))
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		metrics := parseServerTiming(t, rr.Header().Get("Server-Timing"))
+		test.That(t, metrics, test.ShouldHaveLength, 1)
+		test.That(t, duration(t, metrics["handler"]), test.ShouldBeBetween, 9, 1000)
+	})
+
+	t.Run("render cache", func(t *testing.T) {
+		mw := NewTemplateMiddleware(tm, slowHandler(NamedTemplate("page.html")), golog.NewTestLogger(t))
+		mw.RenderCache = NewMemoryResponseCache(10)
+		rr := serve(mw)
+		metrics := parseServerTiming(t, rr.Header().Get("Server-Timing"))
+		test.That(t, metrics["cache"], test.ShouldResemble, map[string]string{"desc": "miss"})
+		test.That(t, metrics, test.ShouldContainKey, "render")
+
+		rr = serve(mw)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		test.That(t, rr.Header().Values("Server-Timing"), test.ShouldResemble, []string{"cache;desc=hit"})
+	})
+
+	t.Run("handler response", func(t *testing.T) {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			w.WriteHeader(http.StatusAccepted)
+			return nil, nil, nil
+		})
+		rr := serve(NewTemplateMiddleware(tm, h, golog.NewTestLogger(t)))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusAccepted)
+		test.That(t, rr.Header().Values("Server-Timing"), test.ShouldBeEmpty)
+	})
+
+	t.Run("off", func(t *testing.T) {
+		mw := NewTemplateMiddleware(tm, slowHandler(NamedTemplate("page.html")), golog.NewTestLogger(t))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Header().Values("Server-Timing"), test.ShouldBeEmpty)
+	})
+}
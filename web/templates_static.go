@@ -0,0 +1,146 @@
+package web
+
+import (
+	"bytes"
+	"container/list"
+	"html/template"
+	"sync"
+	"sync/atomic"
+)
+
+// StaticRenderCache caches the rendered output of templates that do not depend on their data,
+// such as terms of service or about pages. Templates registered as static are executed with nil
+// data and their output is reused until the template changes, Invalidate is called, or the entry
+// is evicted to keep the cache within its size limit. A template is considered changed when the
+// manager returns a different *template.Template for it, which happens whenever the manager
+// reparses its templates.
+type StaticRenderCache struct {
+	templates TemplateManager
+	static    map[string]bool
+	maxBytes  int
+
+	mu sync.Mutex
+	// lru orders entries from most to least recently used.
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int
+
+	hits   uint64
+	misses uint64
+}
+
+type staticRenderEntry struct {
+	name     string
+	template *template.Template
+	output   []byte
+}
+
+// StaticRenderCacheStats counts the lookups made in a StaticRenderCache.
+type StaticRenderCacheStats struct {
+	// Hits is how many renders were served from the cache.
+	Hits uint64
+	// Misses is how many renders executed the template.
+	Misses uint64
+}
+
+// NewStaticRenderCache returns a StaticRenderCache for the named templates of tm that keeps at
+// most maxBytes of rendered output.
+func NewStaticRenderCache(tm TemplateManager, maxBytes int, static ...string) *StaticRenderCache {
+	c := &StaticRenderCache{
+		templates: tm,
+		static:    make(map[string]bool, len(static)),
+		maxBytes:  maxBytes,
+		lru:       list.New(),
+		entries:   map[string]*list.Element{},
+	}
+	for _, name := range static {
+		c.static[name] = true
+	}
+	return c
+}
+
+// IsStatic reports whether the named template was registered as static.
+func (c *StaticRenderCache) IsStatic(name string) bool {
+	return c.static[name]
+}
+
+// Render returns the output of the named static template, executing it only if it is not cached.
+// The returned slice must not be modified.
+func (c *StaticRenderCache) Render(name string) ([]byte, error) {
+	if !c.IsStatic(name) {
+		return nil, templateNotFoundError(name)
+	}
+	t, err := c.templates.LookupTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[name]; ok {
+		entry := elem.Value.(*staticRenderEntry)
+		if entry.template == t {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			atomic.AddUint64(&c.hits, 1)
+			return entry.output, nil
+		}
+		c.remove(elem)
+	}
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		return nil, &TemplateExecError{Name: name, Err: err}
+	}
+	output := buf.Bytes()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(output) > c.maxBytes {
+		return output, nil
+	}
+	if elem, ok := c.entries[name]; ok {
+		// another render of the same template finished first.
+		c.remove(elem)
+	}
+	c.entries[name] = c.lru.PushFront(&staticRenderEntry{name: name, template: t, output: output})
+	c.size += len(output)
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+	return output, nil
+}
+
+// Invalidate drops the cached output of the named templates, or of every template if no names
+// are given. Use it when a template's output changes without the template itself changing.
+func (c *StaticRenderCache) Invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(names) == 0 {
+		c.lru.Init()
+		c.entries = map[string]*list.Element{}
+		c.size = 0
+		return
+	}
+	for _, name := range names {
+		if elem, ok := c.entries[name]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *StaticRenderCache) Stats() StaticRenderCacheStats {
+	return StaticRenderCacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+// remove drops elem from the cache. c.mu must be held.
+func (c *StaticRenderCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*staticRenderEntry)
+	delete(c.entries, entry.name)
+	c.size -= len(entry.output)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+func TestStaticRenderCache(t *testing.T) {
+	var executions int64
+	funcs := template.FuncMap{
+		"count": func() int64 { return atomic.AddInt64(&executions, 1) },
+	}
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, filepath.Join(dir, "about.html"), `about {{ count }}`, modTime)
+	writeTemplateFile(t, filepath.Join(dir, "terms.html"), `terms {{ count }}`, modTime)
+	writeTemplateFile(t, filepath.Join(dir, "dynamic.html"), `dynamic {{ . }} {{ count }}`, modTime)
+	tm, err := NewTemplateManagerFS(dir, WithFuncs(funcs))
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("executes once across many requests", func(t *testing.T) {
+		atomic.StoreInt64(&executions, 0)
+		cache := NewStaticRenderCache(tm, 1<<20, "about.html")
+		mw := NewTemplateMiddleware(tm, staticHandler("about.html", "ignored", nil), golog.NewTestLogger(t))
+		mw.StaticCache = cache
+
+		var wg sync.WaitGroup
+		// the first render populates the cache before the concurrent ones.
+		for i := 0; i < 51; i++ {
+			if i == 1 {
+				wg.Wait()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rr := httptest.NewRecorder()
+				mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rr.Code != http.StatusOK || rr.Body.String() != "about 1" {
+					t.Errorf("unexpected response %d %q", rr.Code, rr.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+		test.That(t, atomic.LoadInt64(&executions), test.ShouldEqual, 1)
+		test.That(t, cache.Stats(), test.ShouldResemble, StaticRenderCacheStats{Hits: 50, Misses: 1})
+
+		cache.Invalidate()
+		out, err := cache.Render("about.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(out), test.ShouldEqual, "about 2")
+		test.That(t, atomic.LoadInt64(&executions), test.ShouldEqual, 2)
+	})
+
+	t.Run("non static templates execute every time", func(t *testing.T) {
+		atomic.StoreInt64(&executions, 0)
+		mw := NewTemplateMiddleware(tm, staticHandler("dynamic.html", "data", nil), golog.NewTestLogger(t))
+		mw.StaticCache = NewStaticRenderCache(tm, 1<<20, "about.html")
+		for i := 1; i <= 3; i++ {
+			rr := httptest.NewRecorder()
+			mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			test.That(t, rr.Body.String(), test.ShouldEqual, fmt.Sprintf("dynamic data %d", i))
+		}
+
+		_, err := mw.StaticCache.Render("dynamic.html")
+		test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+	})
+
+	t.Run("reparsed templates are rendered again", func(t *testing.T) {
+		atomic.StoreInt64(&executions, 0)
+		cache := NewStaticRenderCache(tm, 1<<20, "about.html", "terms.html")
+		for i := 0; i < 3; i++ {
+			_, err := cache.Render("terms.html")
+			test.That(t, err, test.ShouldBeNil)
+		}
+		test.That(t, atomic.LoadInt64(&executions), test.ShouldEqual, 1)
+
+		writeTemplateFile(t, filepath.Join(dir, "terms.html"), `new terms {{ count }}`, modTime.Add(time.Minute))
+		out, err := cache.Render("terms.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(out), test.ShouldEqual, "new terms 2")
+
+		cache.Invalidate("about.html")
+		_, err = cache.Render("terms.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, atomic.LoadInt64(&executions), test.ShouldEqual, 2)
+	})
+
+	t.Run("evicts least recently used output", func(t *testing.T) {
+		atomic.StoreInt64(&executions, 0)
+		// only one of the two renders fits.
+		cache := NewStaticRenderCache(tm, len("new terms 1000"), "about.html", "terms.html")
+		for _, name := range []string{"about.html", "about.html", "terms.html", "about.html"} {
+			_, err := cache.Render(name)
+			test.That(t, err, test.ShouldBeNil)
+		}
+		test.That(t, cache.Stats(), test.ShouldResemble, StaticRenderCacheStats{Hits: 1, Misses: 3})
+
+		// output larger than the cache is never stored.
+		tiny := NewStaticRenderCache(tm, 1, "about.html")
+		for i := 0; i < 2; i++ {
+			_, err := tiny.Render("about.html")
+			test.That(t, err, test.ShouldBeNil)
+		}
+		test.That(t, tiny.Stats().Misses, test.ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// TemplateManagerStats counts what a TemplateManager has done since it was created.
+type TemplateManagerStats struct {
+	// Parses is how many times the full template set was parsed.
+	Parses uint64
+	// ParseDuration is the total time spent parsing.
+	ParseDuration time.Duration
+	// CacheHits is how many times templates were served from an already parsed set.
+	CacheHits uint64
+	// CacheMisses is how many times templates had to be parsed before they could be served.
+	CacheMisses uint64
+	// Lookups is how many templates were looked up.
+	Lookups uint64
+	// LookupFailures is how many lookups returned an error.
+	LookupFailures uint64
+}
+
+// Map returns the stats keyed by snake case names, with durations in nanoseconds, for exporting
+// to a metrics system.
+func (s TemplateManagerStats) Map() map[string]int64 {
+	return map[string]int64{
+		"parses":            int64(s.Parses),
+		"parse_duration_ns": int64(s.ParseDuration),
+		"cache_hits":        int64(s.CacheHits),
+		"cache_misses":      int64(s.CacheMisses),
+		"lookups":           int64(s.Lookups),
+		"lookup_failures":   int64(s.LookupFailures),
+	}
+}
+
+// TemplateStatsProvider is a TemplateManager that reports TemplateManagerStats. The managers
+// created by this package implement it.
+type TemplateStatsProvider interface {
+	Stats() TemplateManagerStats
+}
+
+// TemplateStatsExpvar returns an expvar.Func publishing the stats of p as a map, for use with
+// expvar.Publish.
+func TemplateStatsExpvar(p TemplateStatsProvider) expvar.Func {
+	return func() interface{} {
+		return p.Stats().Map()
+	}
+}
+
+// templateStats are the counters behind TemplateManagerStats. They are updated atomically and
+// must be 64-bit aligned.
+type templateStats struct {
+	parses         uint64
+	parseNanos     uint64
+	cacheHits      uint64
+	cacheMisses    uint64
+	lookups        uint64
+	lookupFailures uint64
+}
+
+func (s *templateStats) parsed(d time.Duration) {
+	atomic.AddUint64(&s.parses, 1)
+	atomic.AddUint64(&s.parseNanos, uint64(d))
+}
+
+func (s *templateStats) cached(hit bool) {
+	if hit {
+		atomic.AddUint64(&s.cacheHits, 1)
+	} else {
+		atomic.AddUint64(&s.cacheMisses, 1)
+	}
+}
+
+func (s *templateStats) lookedUp(err error) {
+	atomic.AddUint64(&s.lookups, 1)
+	if err != nil {
+		atomic.AddUint64(&s.lookupFailures, 1)
+	}
+}
+
+func (s *templateStats) snapshot() TemplateManagerStats {
+	return TemplateManagerStats{
+		Parses:         atomic.LoadUint64(&s.parses),
+		ParseDuration:  time.Duration(atomic.LoadUint64(&s.parseNanos)),
+		CacheHits:      atomic.LoadUint64(&s.cacheHits),
+		CacheMisses:    atomic.LoadUint64(&s.cacheMisses),
+		Lookups:        atomic.LoadUint64(&s.lookups),
+		LookupFailures: atomic.LoadUint64(&s.lookupFailures),
+	}
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestTemplateManagerStats(t *testing.T) {
+	t.Run("filesystem", func(t *testing.T) {
+		dir := t.TempDir()
+		modTime := time.Now().Add(-time.Hour)
+		writeTemplateFile(t, filepath.Join(dir, "page.html"), "page", modTime)
+
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		stats := tm.(TemplateStatsProvider)
+		test.That(t, stats.Stats(), test.ShouldResemble, TemplateManagerStats{})
+
+		// the first lookup parses.
+		_, err = tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		// the second is served from the cache but fails.
+		_, err = tm.LookupTemplate("missing.html")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		s := stats.Stats()
+		test.That(t, s.Parses, test.ShouldEqual, 1)
+		test.That(t, s.ParseDuration, test.ShouldBeGreaterThan, 0)
+		test.That(t, s.CacheHits, test.ShouldEqual, 1)
+		test.That(t, s.CacheMisses, test.ShouldEqual, 1)
+		test.That(t, s.Lookups, test.ShouldEqual, 2)
+		test.That(t, s.LookupFailures, test.ShouldEqual, 1)
+
+		test.That(t, tm.(ReloadableTemplateManager).Reload(), test.ShouldBeNil)
+		test.That(t, stats.Stats().Parses, test.ShouldEqual, 2)
+
+		m := TemplateStatsExpvar(stats)().(map[string]int64)
+		test.That(t, m["parses"], test.ShouldEqual, 2)
+		test.That(t, m["lookup_failures"], test.ShouldEqual, 1)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		tm := mustTemplateManagerFromMap(t, map[string]string{"page": "page"})
+		_, err := tm.LookupTemplate("page")
+		test.That(t, err, test.ShouldBeNil)
+
+		s := tm.(TemplateStatsProvider).Stats()
+		test.That(t, s.Parses, test.ShouldEqual, 1)
+		test.That(t, s.CacheHits, test.ShouldEqual, 1)
+		test.That(t, s.CacheMisses, test.ShouldEqual, 0)
+		test.That(t, s.Lookups, test.ShouldEqual, 1)
+	})
+}
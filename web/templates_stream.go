@@ -0,0 +1,89 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Defaults for how often streamed templates are flushed.
+const (
+	DefaultFlushBytes    = 32 << 10
+	DefaultFlushInterval = 200 * time.Millisecond
+)
+
+// Streaming returns a copy of the Template that is written to the client as it renders and
+// flushed periodically, as configured by TemplateMiddleware's FlushBytes and FlushInterval. This
+// suits pages too large to hold in memory. The response cannot use ETags or compression, and an
+// error after output has been sent can only be logged, leaving the client with a truncated page.
+func (t *Template) Streaming() *Template {
+	streaming := *t
+	streaming.streaming = true
+	return &streaming
+}
+
+// flushWriter flushes its http.ResponseWriter every so many bytes or so much time.
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+
+	maxPending int
+	interval   time.Duration
+
+	pending   int
+	written   int64
+	lastFlush time.Time
+}
+
+func newFlushWriter(w http.ResponseWriter, maxPending int, interval time.Duration) *flushWriter {
+	if maxPending <= 0 {
+		maxPending = DefaultFlushBytes
+	}
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	flusher, _ := w.(http.Flusher)
+	return &flushWriter{w: w, flusher: flusher, maxPending: maxPending, interval: interval, lastFlush: time.Now()}
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	fw.pending += n
+	fw.written += int64(n)
+	if fw.pending >= fw.maxPending || time.Since(fw.lastFlush) >= fw.interval {
+		fw.flush()
+	}
+	return n, err
+}
+
+func (fw *flushWriter) flush() {
+	if fw.flusher != nil && fw.pending > 0 {
+		fw.flusher.Flush()
+	}
+	fw.pending = 0
+	fw.lastFlush = time.Now()
+}
+
+// stream renders straight to the client, flushing as it goes.
+func (tm *TemplateMiddleware) stream(w http.ResponseWriter, r *http.Request, status int, execute func(io.Writer) error) error {
+	fw := newFlushWriter(w, tm.FlushBytes, tm.FlushInterval)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	err := execute(tm.limitOutput(fw))
+	fw.flush()
+	if err == nil {
+		return nil
+	}
+	if fw.written == 0 {
+		tm.handleError(w, r, err)
+		return err
+	}
+	tm.abortIfTooLarge(r, err)
+	if clientGone(r, err) {
+		tm.logger(r).Debug("client went away while streaming template", "path", r.URL.Path, "error", err)
+		return err
+	}
+	tm.logger(r).Error("failed to render streamed template after sending output", "path", r.URL.Path, "error", err)
+	return err
+}
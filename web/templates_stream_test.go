@@ -0,0 +1,78 @@
+package web
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+// flushCountingRecorder is an httptest.ResponseRecorder that counts flushes.
+type flushCountingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushCountingRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestTemplateStreaming(t *testing.T) {
+	rows := make([]string, 100)
+	for i := range rows {
+		rows[i] = strings.Repeat("x", 100)
+	}
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"report.html": `{{ range . }}<tr>{{ . }}</tr>{{ end }}`,
+		"broken.html": `{{ range . }}<tr>{{ . }}</tr>{{ end }}{{ fail }}`,
+		"early.html":  `{{ fail }}`,
+		"500.html":    `error page`,
+	}, WithFuncs(template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("failed mid render") },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(name string) *flushCountingRecorder {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate(name).Streaming(), rows, nil
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.FlushBytes = 1000
+		mw.ETags = true
+		mw.Compress = true
+		rr := &flushCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("flushes periodically", func(t *testing.T) {
+		rr := serve("report.html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.Len(), test.ShouldEqual, 100*len("<tr></tr>")+100*100)
+		// about one flush per thousand bytes, plus the final one.
+		test.That(t, rr.flushes, test.ShouldBeBetweenOrEqual, 10, 12)
+		test.That(t, rr.Header().Get("ETag"), test.ShouldBeEmpty)
+		test.That(t, rr.Header().Get("Content-Encoding"), test.ShouldBeEmpty)
+		test.That(t, rr.Header().Get("Content-Length"), test.ShouldBeEmpty)
+	})
+
+	t.Run("error after output is only logged", func(t *testing.T) {
+		rr := serve("broken.html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "<tr>")
+		test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "error page")
+	})
+
+	t.Run("error before output renders the error page", func(t *testing.T) {
+		rr := serve("early.html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+	})
+}
@@ -1,14 +1,34 @@
 package web
 
 import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/edaniels/golog"
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"go.viam.com/test"
+	"go.viam.com/utils"
 
 	rpcpb "go.viam.com/utils/proto/rpc/v1"
+	"go.viam.com/utils/testutils"
 	"go.viam.com/utils/web/protojson"
 )
 
@@ -94,3 +114,2043 @@ func staticHandler(template string, data interface{}, err error) TemplateHandler
 		return NamedTemplate(template), data, err
 	}
 }
+
+func TestTemplateManagerFSCaching(t *testing.T) {
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "page.html")
+	test.That(t, os.WriteFile(pagePath, []byte("first"), 0o600), test.ShouldBeNil)
+
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	render := func() string {
+		t.Helper()
+		tmpl, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		var buf bytes.Buffer
+		test.That(t, tmpl.Execute(&buf, nil), test.ShouldBeNil)
+		return buf.String()
+	}
+
+	t.Run("repeated lookups reuse the parsed set", func(t *testing.T) {
+		first, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		second, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, second, test.ShouldEqual, first)
+		test.That(t, render(), test.ShouldEqual, "first")
+	})
+
+	t.Run("editing a file invalidates the cache", func(t *testing.T) {
+		before, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+
+		test.That(t, os.WriteFile(pagePath, []byte("second!"), 0o600), test.ShouldBeNil)
+		future := time.Now().Add(time.Minute)
+		test.That(t, os.Chtimes(pagePath, future, future), test.ShouldBeNil)
+
+		after, err := tm.LookupTemplate("page.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, after, test.ShouldNotEqual, before)
+		test.That(t, render(), test.ShouldEqual, "second!")
+	})
+
+	t.Run("adding a file invalidates the cache", func(t *testing.T) {
+		_, err := tm.LookupTemplate("other.html")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		test.That(t, os.WriteFile(filepath.Join(dir, "other.html"), []byte("other"), 0o600), test.ShouldBeNil)
+
+		_, err = tm.LookupTemplate("other.html")
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("removing a file invalidates the cache", func(t *testing.T) {
+		test.That(t, os.Remove(filepath.Join(dir, "other.html")), test.ShouldBeNil)
+
+		_, err := tm.LookupTemplate("other.html")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestTemplateManagerFSConcurrentLookups(t *testing.T) {
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "page.html")
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, pagePath, "version 0", modTime)
+	writeTemplateFile(t, filepath.Join(dir, "other.html"), "other", modTime)
+
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	done := make(chan struct{})
+	var rewriter sync.WaitGroup
+	rewriter.Add(1)
+	go func() {
+		defer rewriter.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			writeTemplateFile(t, pagePath, fmt.Sprintf("version %d", i), modTime.Add(time.Duration(i)*time.Second))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var lookups sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		lookups.Add(1)
+		go func() {
+			defer lookups.Done()
+			for j := 0; j < 50; j++ {
+				for _, name := range []string{"page.html", "other.html"} {
+					tmpl, err := tm.LookupTemplate(name)
+					if err != nil {
+						errs <- err
+						return
+					}
+					var buf bytes.Buffer
+					if err := tmpl.Execute(&buf, nil); err != nil {
+						errs <- err
+						return
+					}
+					if out := buf.String(); !strings.HasPrefix(out, "version ") && out != "other" {
+						errs <- fmt.Errorf("unexpected render %q", out)
+						return
+					}
+				}
+			}
+		}()
+	}
+	lookups.Wait()
+	close(done)
+	rewriter.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestWithCheckInterval(t *testing.T) {
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "page.html")
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, pagePath, "first", modTime)
+
+	_, err := NewTemplateManagerFS(dir, WithCheckInterval(-time.Second))
+	test.That(t, err, test.ShouldNotBeNil)
+
+	tm, err := NewTemplateManagerFS(dir, WithCheckInterval(time.Hour))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "first")
+
+	// changes go unnoticed until the interval passes.
+	writeTemplateFile(t, pagePath, "second", modTime.Add(time.Minute))
+	test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "first")
+
+	// an explicit reload still picks them up.
+	test.That(t, tm.(ReloadableTemplateManager).Reload(), test.ShouldBeNil)
+	test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "second")
+
+	tm, err = NewTemplateManagerFS(dir, WithCheckInterval(20*time.Millisecond))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "second")
+	writeTemplateFile(t, pagePath, "third", modTime.Add(2*time.Minute))
+	testutils.WaitForAssertion(t, func(tb testing.TB) {
+		tb.Helper()
+		test.That(tb, renderTemplate(tb, tm, "page.html"), test.ShouldEqual, "third")
+	})
+}
+
+func BenchmarkTemplateManagerFSLookup(b *testing.B) {
+	tm, err := NewTemplateManagerFS("testdata/templates")
+	test.That(b, err, test.ShouldBeNil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tm.LookupTemplate("protoJson.html"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTemplateManagerFSLookupUncached measures the previous behavior of
+// reading and parsing the whole directory on every lookup.
+func BenchmarkTemplateManagerFSLookupUncached(b *testing.B) {
+	opts := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil)
+	fsys := os.DirFS("testdata/templates")
+	for i := 0; i < b.N; i++ {
+		files, err := findTemplateFiles(fsys, ".", opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		main, err := parseTemplateFiles(fsys, files, opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := lookupTemplate(main, "protoJson.html"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+//go:embed testdata/nested
+var nestedTemplates embed.FS
+
+func TestTemplateManagerNested(t *testing.T) {
+	embedded, err := NewTemplateManagerEmbed(nestedTemplates, "testdata/nested")
+	test.That(t, err, test.ShouldBeNil)
+	onDisk, err := NewTemplateManagerFS("testdata/nested")
+	test.That(t, err, test.ShouldBeNil)
+
+	for name, tm := range map[string]TemplateManager{"embed": embedded, "fs": onDisk} {
+		tm := tm
+		t.Run(name, func(t *testing.T) {
+			test.That(t, renderTemplate(t, tm, "admin/users.html"), test.ShouldEqual, "users")
+			test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "top users")
+			test.That(t, renderTemplate(t, tm, "admin/index.html"), test.ShouldEqual, "admin index")
+
+			_, err := tm.LookupTemplate("users.html")
+			test.That(t, err, test.ShouldNotBeNil)
+		})
+	}
+}
+
+func TestTemplateManagerNames(t *testing.T) {
+	t.Run("embed", func(t *testing.T) {
+		tm, err := NewTemplateManagerEmbed(nestedTemplates, "testdata/nested")
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"admin/index.html", "admin/users.html", "index.html"})
+	})
+
+	t.Run("fs reflects directory contents", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplateFile(t, filepath.Join(dir, "page.html"), `{{define "header"}}h{{end}}page`, time.Now())
+
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"header", "page.html"})
+
+		writeTemplateFile(t, filepath.Join(dir, "about.html"), `about`, time.Now())
+		names, err = listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"about.html", "header", "page.html"})
+	})
+}
+
+func TestTemplateManagerValidate(t *testing.T) {
+	files := map[string]string{
+		"good.html":      "fine",
+		"broken1.html":   "{{ .Unclosed ",
+		"sub/other.html": "{{ end }}",
+	}
+	dir := t.TempDir()
+	test.That(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700), test.ShouldBeNil)
+	fsys := fstest.MapFS{}
+	for name, contents := range files {
+		writeTemplateFile(t, filepath.Join(dir, name), contents, time.Now())
+		fsys["templates/"+name] = &fstest.MapFile{Data: []byte(contents)}
+	}
+
+	assertBothBroken := func(t *testing.T, err error) {
+		t.Helper()
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, multierr.Errors(err), test.ShouldHaveLength, 2)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "broken1.html")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "sub/other.html")
+		test.That(t, err.Error(), test.ShouldNotContainSubstring, "good.html")
+	}
+
+	t.Run("fs", func(t *testing.T) {
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		assertBothBroken(t, validateTemplates(tm))
+
+		test.That(t, os.Remove(filepath.Join(dir, "broken1.html")), test.ShouldBeNil)
+		test.That(t, os.Remove(filepath.Join(dir, "sub", "other.html")), test.ShouldBeNil)
+		test.That(t, validateTemplates(tm), test.ShouldBeNil)
+	})
+
+	t.Run("embed reports every file at construction", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(fsys, "templates")
+		assertBothBroken(t, errors.Unwrap(err))
+	})
+}
+
+func TestTemplateParseError(t *testing.T) {
+	const page = "first line\nsecond line\n{{ if .Open }}\nnever closed\n"
+	const other = "fine\n{{ .Broken "
+	fsys := fstest.MapFS{
+		"templates/good.html":       &fstest.MapFile{Data: []byte("good")},
+		"templates/page.html":       &fstest.MapFile{Data: []byte(page)},
+		"templates/sub/other.html":  &fstest.MapFile{Data: []byte(other)},
+		"templates/sub/func.html":   &fstest.MapFile{Data: []byte("\n\n\n{{ nope }}")},
+		"templates/sub/absent.html": &fstest.MapFile{Data: []byte("fine")},
+	}
+	dir := t.TempDir()
+	test.That(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700), test.ShouldBeNil)
+	writeTemplateFile(t, filepath.Join(dir, "sub", "other.html"), other, time.Now())
+
+	parseErrors := func(err error) map[string]*TemplateParseError {
+		byFile := map[string]*TemplateParseError{}
+		for _, err := range multierr.Errors(err) {
+			var parseErr *TemplateParseError
+			test.That(t, errors.As(err, &parseErr), test.ShouldBeTrue)
+			byFile[parseErr.File] = parseErr
+		}
+		return byFile
+	}
+
+	t.Run("embed", func(t *testing.T) {
+		_, err := NewTemplateManagerEmbed(fsys, "templates")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		var parseErr *TemplateParseError
+		test.That(t, errors.As(err, &parseErr), test.ShouldBeTrue)
+
+		byFile := parseErrors(errors.Unwrap(err))
+		test.That(t, byFile, test.ShouldHaveLength, 3)
+		test.That(t, byFile["templates/page.html"].Line, test.ShouldEqual, 5) // the end of the file
+		test.That(t, byFile["templates/page.html"].Message, test.ShouldContainSubstring, "unexpected EOF")
+		test.That(t, byFile["templates/sub/other.html"].Line, test.ShouldEqual, 2)
+		test.That(t, byFile["templates/sub/func.html"].Line, test.ShouldEqual, 4)
+		test.That(t, byFile["templates/sub/func.html"].Message, test.ShouldEqual, `function "nope" not defined`)
+		test.That(t, byFile["templates/sub/func.html"].Error(), test.ShouldEqual,
+			`error parsing template templates/sub/func.html:4: function "nope" not defined`)
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = tm.LookupTemplate("sub/other.html")
+		var parseErr *TemplateParseError
+		test.That(t, errors.As(err, &parseErr), test.ShouldBeTrue)
+		test.That(t, parseErr.File, test.ShouldEqual, "sub/other.html")
+		test.That(t, parseErr.Line, test.ShouldEqual, 2)
+
+		byFile := parseErrors(validateTemplates(tm))
+		test.That(t, byFile, test.ShouldHaveLength, 1)
+		test.That(t, byFile["sub/other.html"].Line, test.ShouldEqual, 2)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		parseErr := newTemplateParseError("page.html", errors.New("something odd"))
+		test.That(t, parseErr.Line, test.ShouldEqual, 0)
+		test.That(t, parseErr.Message, test.ShouldEqual, "something odd")
+		test.That(t, parseErr.Error(), test.ShouldEqual, "error parsing template page.html: something odd")
+	})
+}
+
+func TestLookupTemplateInfo(t *testing.T) {
+	const page = `{{define "header"}}header{{end}}page`
+
+	t.Run("embed", func(t *testing.T) {
+		modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		fsys := fstest.MapFS{
+			"templates/page.html":      &fstest.MapFile{Data: []byte(page), ModTime: modTime},
+			"templates/sub/other.html": &fstest.MapFile{Data: []byte("other")},
+		}
+		tm, err := NewTemplateManagerEmbed(fsys, "templates")
+		test.That(t, err, test.ShouldBeNil)
+
+		info, err := lookupTemplateInfo(tm, "page.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info, test.ShouldResemble, TemplateInfo{
+			Name:       "page.html",
+			SourcePath: "templates/page.html",
+			ModTime:    modTime,
+			Size:       int64(len(page)),
+			Hash:       "d22eefbe8adb96581177d0c006194e1ebd77fbb0868d4fe6bcb925a81cb5e638",
+		})
+
+		info, err = lookupTemplateInfo(tm, "header")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.Name, test.ShouldEqual, "header")
+		test.That(t, info.SourcePath, test.ShouldEqual, "templates/page.html")
+
+		info, err = lookupTemplateInfo(tm, "sub/other.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, "templates/sub/other.html")
+
+		_, err = lookupTemplateInfo(tm, "missing.html")
+		test.That(t, errors.Is(err, ErrTemplateNotFound), test.ShouldBeTrue)
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		dir := t.TempDir()
+		pagePath := filepath.Join(dir, "page.html")
+		modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		writeTemplateFile(t, pagePath, page, modTime)
+
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+
+		info, err := lookupTemplateInfo(tm, "header")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, pagePath)
+		test.That(t, info.ModTime.Equal(modTime), test.ShouldBeTrue)
+		test.That(t, info.Size, test.ShouldEqual, len(page))
+
+		newModTime := modTime.Add(time.Minute)
+		writeTemplateFile(t, pagePath, page+"!", newModTime)
+		info, err = lookupTemplateInfo(tm, "page.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.ModTime.Equal(newModTime), test.ShouldBeTrue)
+		test.That(t, info.Size, test.ShouldEqual, len(page)+1)
+	})
+}
+
+func TestTemplateManagerFSReload(t *testing.T) {
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "page.html")
+	modTime := time.Now().Truncate(time.Second)
+	writeTemplateFile(t, pagePath, "version a", modTime)
+
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+	reloadable, ok := tm.(ReloadableTemplateManager)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "version a")
+
+	t.Run("picks up changes change detection cannot see", func(t *testing.T) {
+		// same size and modification time
+		writeTemplateFile(t, pagePath, "version b", modTime)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "version a")
+
+		test.That(t, reloadable.Reload(), test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "version b")
+	})
+
+	t.Run("keeps the previous set on failure", func(t *testing.T) {
+		// same size so lookups keep using the cached set
+		writeTemplateFile(t, pagePath, "{{ .Oops ", modTime)
+
+		err := reloadable.Reload()
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "page.html")
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "version b")
+
+		writeTemplateFile(t, pagePath, "version c", modTime)
+		test.That(t, reloadable.Reload(), test.ShouldBeNil)
+	})
+
+	t.Run("concurrent lookups during reloads", func(t *testing.T) {
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					tmpl, err := tm.LookupTemplate("page.html")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					var buf bytes.Buffer
+					if err := tmpl.Execute(&buf, nil); err != nil {
+						t.Error(err)
+						return
+					}
+					if !strings.HasPrefix(buf.String(), "version ") {
+						t.Errorf("unexpected render %q", buf.String())
+						return
+					}
+				}
+			}()
+		}
+
+		for i := 0; i < 50; i++ {
+			writeTemplateFile(t, pagePath, fmt.Sprintf("version %d", i%10), modTime)
+			test.That(t, reloadable.Reload(), test.ShouldBeNil)
+		}
+		close(done)
+		wg.Wait()
+	})
+}
+
+func TestExecuteToString(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/page.html": &fstest.MapFile{Data: []byte(`hello {{ .Name }}`)},
+		"templates/fail.html": &fstest.MapFile{Data: []byte(`before {{ fail }} after`)},
+	}
+	failErr := errors.New("boom")
+	tm, err := NewTemplateManagerEmbed(fsys, "templates", WithFuncs(template.FuncMap{
+		"fail": func() (string, error) { return "", failErr },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("success", func(t *testing.T) {
+		out, err := ExecuteToString(tm, "page.html", map[string]string{"Name": "world"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, out, test.ShouldEqual, "hello world")
+
+		var buf bytes.Buffer
+		test.That(t, ExecuteTo(tm, &buf, "page.html", map[string]string{"Name": "there"}), test.ShouldBeNil)
+		test.That(t, buf.String(), test.ShouldEqual, "hello there")
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		out, err := ExecuteToString(tm, "missing.html", nil)
+		test.That(t, out, test.ShouldBeEmpty)
+		test.That(t, errors.Is(err, ErrTemplateNotFound), test.ShouldBeTrue)
+		var execErr *TemplateExecError
+		test.That(t, errors.As(err, &execErr), test.ShouldBeFalse)
+	})
+
+	t.Run("execution fails mid-write", func(t *testing.T) {
+		out, err := ExecuteToString(tm, "fail.html", nil)
+		test.That(t, out, test.ShouldBeEmpty)
+		var execErr *TemplateExecError
+		test.That(t, errors.As(err, &execErr), test.ShouldBeTrue)
+		test.That(t, execErr.Name, test.ShouldEqual, "fail.html")
+		test.That(t, errors.Is(err, failErr), test.ShouldBeTrue)
+		test.That(t, errors.Is(err, ErrTemplateNotFound), test.ShouldBeFalse)
+
+		var buf bytes.Buffer
+		err = ExecuteTo(tm, &buf, "fail.html", nil)
+		test.That(t, errors.As(err, &execErr), test.ShouldBeTrue)
+		test.That(t, buf.String(), test.ShouldEqual, "before ")
+	})
+}
+
+// openOnlyFS hides every method of the wrapped file system except Open.
+type openOnlyFS struct {
+	fsys fs.FS
+}
+
+func (f openOnlyFS) Open(name string) (fs.File, error) {
+	return f.fsys.Open(name)
+}
+
+func TestNewTemplateManagerFSys(t *testing.T) {
+	t.Run("plain fs.FS", func(t *testing.T) {
+		fsys := openOnlyFS{fstest.MapFS{
+			"templates/page.html":       &fstest.MapFile{Data: []byte(`page {{ template "sub/part.html" }}`)},
+			"templates/sub/part.html":   &fstest.MapFile{Data: []byte(`part`)},
+			"templates/sub/ignored.txt": &fstest.MapFile{Data: []byte(`{{ .Broken`)},
+		}}
+		_, isReadDir := interface{}(fsys).(fs.ReadDirFS)
+		test.That(t, isReadDir, test.ShouldBeFalse)
+
+		tm, err := NewTemplateManagerFSys(fsys, "templates")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page part")
+		names, err := listTemplates(tm)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, names, test.ShouldResemble, []string{"page.html", "sub/part.html"})
+	})
+
+	t.Run("fs.Sub of an embed.FS", func(t *testing.T) {
+		sub, err := fs.Sub(nestedTemplates, "testdata/nested")
+		test.That(t, err, test.ShouldBeNil)
+
+		tm, err := NewTemplateManagerFSys(sub, ".")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, renderTemplate(t, tm, "index.html"), test.ShouldEqual, "top users")
+		test.That(t, renderTemplate(t, tm, "admin/index.html"), test.ShouldEqual, "admin index")
+
+		info, err := lookupTemplateInfo(tm, "admin/users.html")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, info.SourcePath, test.ShouldEqual, "admin/users.html")
+	})
+}
+
+func TestTemplateHash(t *testing.T) {
+	// sha256 of "hello"
+	const helloHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "page.html")
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, pagePath, "hello", modTime)
+
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+	hash, err := TemplateHash(tm, "page.html")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, hash, test.ShouldEqual, helloHash)
+
+	// identical content hashes the same regardless of source, manager or process.
+	embedded, err := NewTemplateManagerEmbed(fstest.MapFS{
+		"templates/other.html": &fstest.MapFile{Data: []byte("hello")},
+	}, "templates")
+	test.That(t, err, test.ShouldBeNil)
+	hash, err = TemplateHash(embedded, "other.html")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, hash, test.ShouldEqual, helloHash)
+
+	mapped, err := NewTemplateManagerFromMap(map[string]string{"page": "hello"})
+	test.That(t, err, test.ShouldBeNil)
+	hash, err = TemplateHash(mapped, "page")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, hash, test.ShouldEqual, helloHash)
+
+	// a reparse after the content changes recomputes the hash.
+	writeTemplateFile(t, pagePath, "hello!", modTime.Add(time.Minute))
+	hash, err = TemplateHash(tm, "page.html")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, hash, test.ShouldNotEqual, helloHash)
+	test.That(t, hash, test.ShouldHaveLength, 64)
+
+	_, err = TemplateHash(tm, "missing.html")
+	test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+}
+
+// blockingTemplateSource is a changing TemplateSource whose directory listings block until
+// its context is done, like a stuck network file system.
+type blockingTemplateSource struct {
+	fstest.MapFS
+	ctx context.Context
+}
+
+func (s blockingTemplateSource) ReadDir(name string) ([]fs.DirEntry, error) {
+	<-s.ctx.Done()
+	return s.MapFS.ReadDir(name)
+}
+
+func (s blockingTemplateSource) templateFS() (fs.FS, string) {
+	return s, "templates"
+}
+
+func (s blockingTemplateSource) static() bool {
+	return false
+}
+
+func (s blockingTemplateSource) sourcePath(p string) string {
+	return p
+}
+
+func TestLookupTemplateCtx(t *testing.T) {
+	newSource := func(ctx context.Context) blockingTemplateSource {
+		return blockingTemplateSource{
+			MapFS: fstest.MapFS{
+				"templates/page.html":     &fstest.MapFile{Data: []byte(`page`)},
+				"templates/sub/more.html": &fstest.MapFile{Data: []byte(`more`)},
+			},
+			ctx: ctx,
+		}
+	}
+
+	t.Run("lookup gives up when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		tm, err := NewTemplateManager(newSource(ctx))
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = tm.(TemplateManagerCtx).LookupTemplateCtx(ctx, "page.html")
+		test.That(t, err, test.ShouldWrap, context.DeadlineExceeded)
+	})
+
+	t.Run("lookup succeeds once the file system responds", func(t *testing.T) {
+		unblocked, cancel := context.WithCancel(context.Background())
+		cancel()
+		tm, err := NewTemplateManager(newSource(unblocked))
+		test.That(t, err, test.ShouldBeNil)
+
+		_, err = tm.(TemplateManagerCtx).LookupTemplateCtx(context.Background(), "page.html")
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("middleware passes the request context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		tm, err := NewTemplateManager(newSource(ctx))
+		test.That(t, err, test.ShouldBeNil)
+
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), golog.NewTestLogger(t))
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusGatewayTimeout)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, context.DeadlineExceeded.Error())
+	})
+
+	t.Run("other managers implement it", func(t *testing.T) {
+		for _, tm := range []TemplateManager{
+			mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"}),
+			NewOverlayTemplateManager(
+				mustTemplateManagerFromMap(t, map[string]string{"a.html": "a"}),
+				mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"}),
+			),
+		} {
+			ctm, ok := tm.(TemplateManagerCtx)
+			test.That(t, ok, test.ShouldBeTrue)
+			pt, err := ctm.LookupTemplateCtx(context.Background(), "page.html")
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, pt.Name(), test.ShouldEqual, "page.html")
+		}
+	})
+}
+
+// lookupOnlyTM hides every optional interface of the wrapped manager, like a TemplateManager
+// implemented outside this package would.
+type lookupOnlyTM struct {
+	TemplateManager
+}
+
+func TestOptionalTemplateManagerInterfaces(t *testing.T) {
+	t.Run("managers created by this package implement them", func(t *testing.T) {
+		for _, tm := range []TemplateManager{
+			mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"}),
+			NewOverlayTemplateManager(
+				mustTemplateManagerFromMap(t, map[string]string{"a.html": "a"}),
+				mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"}),
+			),
+		} {
+			_, ok := tm.(TemplateInfoProvider)
+			test.That(t, ok, test.ShouldBeTrue)
+			_, ok = tm.(TemplateLister)
+			test.That(t, ok, test.ShouldBeTrue)
+			_, ok = tm.(TemplateValidator)
+			test.That(t, ok, test.ShouldBeTrue)
+		}
+	})
+
+	t.Run("a manager with only LookupTemplate", func(t *testing.T) {
+		tm := lookupOnlyTM{mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})}
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page")
+
+		_, err := TemplateHash(tm, "page.html")
+		test.That(t, err, test.ShouldBeError, errors.New("template manager does not support describing template page.html"))
+		_, err = listTemplates(tm)
+		test.That(t, err, test.ShouldBeError, errors.New("template manager does not support listing templates"))
+		test.That(t, validateTemplates(tm), test.ShouldBeError, errors.New("template manager does not support validating templates"))
+	})
+
+	t.Run("overlay with a manager with only LookupTemplate", func(t *testing.T) {
+		tm := NewOverlayTemplateManager(
+			lookupOnlyTM{mustTemplateManagerFromMap(t, map[string]string{"a.html": "a"})},
+			mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"}),
+		)
+		test.That(t, renderTemplate(t, tm, "a.html"), test.ShouldEqual, "a")
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page")
+		_, err := listTemplates(tm)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func mustTemplateManagerFromMap(t *testing.T, templates map[string]string) TemplateManager {
+	t.Helper()
+	tm, err := NewTemplateManagerFromMap(templates)
+	test.That(t, err, test.ShouldBeNil)
+	return tm
+}
+
+func TestTemplateMiddlewareErrorTemplates(t *testing.T) {
+	errorTemplates := map[string]string{
+		"404.html": `missing: {{ .Error }} ({{ .Status }})`,
+		"403.html": `{{ .Nope }}`,
+	}
+	serve := func(tm TemplateManager, err error) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, err), golog.NewTestLogger(t))
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	t.Run("renders the template named after the status", func(t *testing.T) {
+		tm := mustTemplateManagerFromMap(t, errorTemplates)
+		rr := serve(tm, ErrorResponseStatus(http.StatusNotFound))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "missing: Not Found (404)")
+	})
+
+	t.Run("resolves error templates through the name normalizer", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(errorTemplates, WithNameNormalizer(StripExtension))
+		test.That(t, err, test.ShouldBeNil)
+		_, err = tm.LookupTemplate("404")
+		test.That(t, err, test.ShouldBeNil)
+
+		rr := serve(tm, ErrorResponseStatus(http.StatusNotFound))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "missing: Not Found (404)")
+	})
+
+	t.Run("falls back to plain text", func(t *testing.T) {
+		tm := mustTemplateManagerFromMap(t, errorTemplates)
+		rr := serve(tm, errors.New("boom"))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "boom\nerror ID: ")
+
+		// and when the error template fails to render.
+		rr = serve(tm, ErrorResponseStatus(http.StatusForbidden))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusForbidden)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "Forbidden\n")
+	})
+}
+
+func TestTemplateMiddlewareErrorTemplateData(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"404.html": `{{ .Status }} {{ .Method }} {{ .Path }}: {{ .Message }} [{{ .RequestID }}] {{ .Err.Status }}`,
+		"500.html": `{{ .Status }} {{ .Path }}: {{ .Error }}`,
+	})
+	serve := func(err error, requestIDs bool) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, err), golog.NewTestLogger(t))
+		mw.RequestIDs = requestIDs
+		req := httptest.NewRequest(http.MethodPost, "/users/7", nil)
+		req.Header.Set(RequestIDHeader, "req-1")
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(NewErrorResponse(http.StatusNotFound, "no user %d", 7), true)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "404 POST /users/7: no user 7 [req-1] 404")
+
+	rr = serve(NewErrorResponse(http.StatusNotFound, "no user %d", 7), false)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "404 POST /users/7: no user 7 [] 404")
+
+	// errors that are not ErrorResponses get the same data.
+	rr = serve(errors.New("database down"), false)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "500 /users/7: database down")
+}
+
+func TestTemplateMiddlewareErrorTemplateFallbacks(t *testing.T) {
+	templates := map[string]string{
+		"page.html":  "page",
+		"404.html":   "404: {{ .Message }}",
+		"4xx.html":   "4xx {{ .Status }}: {{ .Message }}",
+		"error.html": "error {{ .Status }}: {{ .Message }}",
+		"oops.html":  "oops {{ .Status }}",
+	}
+	tm := mustTemplateManagerFromMap(t, templates)
+	serve := func(tm TemplateManager, err error, configure func(*TemplateMiddleware)) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, err), golog.NewTestLogger(t))
+		if configure != nil {
+			configure(mw)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	test.That(t, DefaultErrorTemplateNames(http.StatusNotFound), test.ShouldResemble,
+		[]string{"404.html", "4xx.html", "error.html"})
+
+	rr := serve(tm, ErrNotFound, nil)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "404: Not Found")
+
+	rr = serve(tm, ErrConflict, nil)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusConflict)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "4xx 409: Conflict")
+
+	rr = serve(tm, errors.New("boom"), nil)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+	test.That(t, rr.Body.String(), test.ShouldEqual, "error 500: boom")
+
+	rr = serve(mustTemplateManagerFromMap(t, map[string]string{"page.html": "page", "4xx.html": "4xx"}), errors.New("boom"), nil)
+	test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+	test.That(t, rr.Body.String(), test.ShouldStartWith, "boom\nerror ID: ")
+
+	t.Run("normalized", func(t *testing.T) {
+		tm, err := NewTemplateManagerFromMap(templates, WithNameNormalizer(StripExtension))
+		test.That(t, err, test.ShouldBeNil)
+		rr := serve(tm, ErrConflict, nil)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "4xx 409: Conflict")
+	})
+
+	t.Run("ErrorTemplateNames", func(t *testing.T) {
+		configure := func(mw *TemplateMiddleware) {
+			mw.ErrorTemplateNames = func(status int) []string {
+				return []string{"missing.html", "oops.html"}
+			}
+		}
+		rr := serve(tm, ErrNotFound, configure)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "oops 404")
+
+		rr = serve(tm, ErrNotFound, func(mw *TemplateMiddleware) {
+			mw.ErrorTemplateNames = func(status int) []string { return nil }
+		})
+		test.That(t, rr.Body.String(), test.ShouldEqual, "Not Found\n")
+	})
+}
+
+func TestRequireTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "login.html"), "login", time.Now())
+	tm, err := NewTemplateManagerFS(dir)
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("present", func(t *testing.T) {
+		test.That(t, RequireTemplates(tm, "login.html"), test.ShouldBeNil)
+		test.That(t, RequireTemplates(tm), test.ShouldBeNil)
+		test.That(t, MustLookupTemplate(tm, "login.html").Name(), test.ShouldEqual, "login.html")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		err := RequireTemplates(tm, "500.html")
+		test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "required template 500.html")
+
+		var recovered interface{}
+		func() {
+			defer func() {
+				recovered = recover()
+			}()
+			MustLookupTemplate(tm, "500.html")
+		}()
+		panicErr, ok := recovered.(error)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, panicErr, test.ShouldWrap, ErrTemplateNotFound)
+		test.That(t, panicErr.Error(), test.ShouldEqual, "required template 500.html: cannot find template 500.html")
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		err := RequireTemplates(tm, "404.html", "login.html", "500.html")
+		test.That(t, multierr.Errors(err), test.ShouldHaveLength, 2)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "404.html")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "500.html")
+		test.That(t, err.Error(), test.ShouldNotContainSubstring, "login.html")
+	})
+
+	t.Run("checks the current directory contents", func(t *testing.T) {
+		writeTemplateFile(t, filepath.Join(dir, "500.html"), "error", time.Now())
+		test.That(t, RequireTemplates(tm, "login.html", "500.html"), test.ShouldBeNil)
+	})
+}
+
+func TestWarmUp(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, filepath.Join(dir, "page.html"), "page", modTime)
+	writeTemplateFile(t, filepath.Join(dir, "other.html"), "other", modTime)
+
+	t.Run("succeeds", func(t *testing.T) {
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, tm.(*fsTM).loaded(), test.ShouldBeNil)
+
+		test.That(t, WarmUp(context.Background(), tm), test.ShouldBeNil)
+		test.That(t, tm.(*fsTM).loaded(), test.ShouldNotBeNil)
+		test.That(t, WarmUp(context.Background(), tm, "page.html"), test.ShouldBeNil)
+
+		embedded := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+		test.That(t, WarmUp(context.Background(), embedded), test.ShouldBeNil)
+	})
+
+	t.Run("surfaces broken and missing templates", func(t *testing.T) {
+		brokenDir := t.TempDir()
+		writeTemplateFile(t, filepath.Join(brokenDir, "page.html"), "page", modTime)
+		writeTemplateFile(t, filepath.Join(brokenDir, "broken.html"), "{{ .Broken ", modTime)
+		tm, err := NewTemplateManagerFS(brokenDir)
+		test.That(t, err, test.ShouldBeNil)
+
+		err = WarmUp(context.Background(), tm)
+		var parseErr *TemplateParseError
+		test.That(t, errors.As(err, &parseErr), test.ShouldBeTrue)
+		test.That(t, parseErr.File, test.ShouldEqual, "broken.html")
+
+		tm, err = NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		err = WarmUp(context.Background(), tm, "page.html", "missing.html", "gone.html")
+		test.That(t, multierr.Errors(err), test.ShouldHaveLength, 2)
+		test.That(t, err, test.ShouldWrap, ErrTemplateNotFound)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "missing.html")
+		test.That(t, err.Error(), test.ShouldContainSubstring, "gone.html")
+	})
+
+	t.Run("aborts on a canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		tm, err := NewTemplateManagerFS(dir)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, WarmUp(ctx, tm), test.ShouldWrap, context.Canceled)
+
+		blocked, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		tm, err = NewTemplateManager(blockingTemplateSource{
+			MapFS: fstest.MapFS{"templates/page.html": &fstest.MapFile{Data: []byte("page")}},
+			ctx:   blocked,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, WarmUp(blocked, tm, "page.html"), test.ShouldWrap, context.DeadlineExceeded)
+	})
+}
+
+func TestTemplateMiddlewareTimeout(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+
+	// deadlineHandler reports how long the request context has left, waiting for it to expire
+	// if it is shorter than wait.
+	deadlineHandler := func(wait time.Duration, remaining *time.Duration) TemplateHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			deadline, ok := r.Context().Deadline()
+			if !ok {
+				*remaining = -1
+				return NamedTemplate("page.html"), nil, nil
+			}
+			*remaining = time.Until(deadline)
+			select {
+			case <-r.Context().Done():
+				return nil, nil, r.Context().Err()
+			case <-time.After(wait):
+			}
+			return NamedTemplate("page.html"), nil, nil
+		}
+	}
+	serve := func(mw *TemplateMiddleware, ctx context.Context) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return rr
+	}
+
+	t.Run("default", func(t *testing.T) {
+		var remaining time.Duration
+		mw := NewTemplateMiddleware(tm, deadlineHandler(0, &remaining), golog.NewTestLogger(t))
+		rr := serve(mw, context.Background())
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, remaining, test.ShouldBeGreaterThan, DefaultTemplateTimeout-time.Second)
+		test.That(t, remaining, test.ShouldBeLessThanOrEqualTo, DefaultTemplateTimeout)
+
+		mw.Timeout = -1
+		serve(mw, context.Background())
+		test.That(t, remaining, test.ShouldEqual, -1)
+	})
+
+	t.Run("shortened timeout", func(t *testing.T) {
+		var remaining time.Duration
+		mw := NewTemplateMiddleware(tm, deadlineHandler(time.Second, &remaining), golog.NewTestLogger(t))
+		mw.Timeout = 20 * time.Millisecond
+		rr := serve(mw, context.Background())
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusGatewayTimeout)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, context.DeadlineExceeded.Error())
+	})
+
+	t.Run("timeout template", func(t *testing.T) {
+		tm := mustTemplateManagerFromMap(t, map[string]string{
+			"page.html": "page",
+			"503.html":  "unavailable",
+			"504.html":  "this is taking too long",
+		})
+		var remaining time.Duration
+		mw := NewTemplateMiddleware(tm, deadlineHandler(time.Second, &remaining), golog.NewTestLogger(t))
+		mw.Timeout = 20 * time.Millisecond
+		rr := serve(mw, context.Background())
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusGatewayTimeout)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "this is taking too long")
+
+		overridden := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return nil, nil, statusErrorResponse{context.DeadlineExceeded, http.StatusServiceUnavailable}
+		})
+		rr = serve(NewTemplateMiddleware(tm, overridden, golog.NewTestLogger(t)), context.Background())
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusServiceUnavailable)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "unavailable")
+	})
+
+	t.Run("client went away", func(t *testing.T) {
+		var remaining time.Duration
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, deadlineHandler(time.Second, &remaining), logger)
+		var onError int
+		mw.OnError = func(r *http.Request, err error, status int) { onError++ }
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		rr := serve(mw, ctx)
+		test.That(t, rr.Body.Len(), test.ShouldEqual, 0)
+		test.That(t, rr.Result().Header.Get("Content-Length"), test.ShouldBeEmpty)
+		test.That(t, onError, test.ShouldEqual, 0)
+		test.That(t, logs.FilterMessage("request canceled").Len(), test.ShouldEqual, 1)
+	})
+
+	t.Run("per route override", func(t *testing.T) {
+		var remaining time.Duration
+		mw := NewTemplateMiddleware(tm, deadlineHandler(50*time.Millisecond, &remaining), golog.NewTestLogger(t))
+		mw.Timeout = 20 * time.Millisecond
+		rr := serve(mw, ContextWithTemplateTimeout(context.Background(), time.Minute))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		test.That(t, remaining, test.ShouldBeGreaterThan, time.Minute-time.Second)
+	})
+}
+
+func TestTemplateMiddlewareBuffering(t *testing.T) {
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"page.html":   `page`,
+		"broken.html": `before {{ fail }} after`,
+		"500.html":    `error page`,
+	}, WithFuncs(template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("failed mid render") },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(mw *TemplateMiddleware) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	t.Run("successful render sets content length", func(t *testing.T) {
+		rr := serve(NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), golog.NewTestLogger(t)))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		test.That(t, rr.Header().Get("Content-Length"), test.ShouldEqual, "4")
+	})
+
+	t.Run("failed render yields the error page", func(t *testing.T) {
+		rr := serve(NewTemplateMiddleware(tm, staticHandler("broken.html", nil, nil), golog.NewTestLogger(t)))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+	})
+
+	t.Run("unbuffered streams partial output", func(t *testing.T) {
+		mw := NewTemplateMiddleware(tm, staticHandler("broken.html", nil, nil), golog.NewTestLogger(t))
+		mw.Unbuffered = true
+		rr := serve(mw)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "before ")
+	})
+}
+
+func TestTemplateMiddlewarePanics(t *testing.T) {
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"page.html": `before {{ explode }}`,
+		"500.html":  `error page: {{ .Error }}`,
+	}, WithFuncs(template.FuncMap{
+		"explode": func() string { panic("template func exploded") },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(h TemplateHandler) (*httptest.ResponseRecorder, *observer.ObservedLogs) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		rr := httptest.NewRecorder()
+		NewTemplateMiddleware(tm, h, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, logs
+	}
+
+	t.Run("panicking handler", func(t *testing.T) {
+		rr, logs := serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			panic("handler exploded")
+		}))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page: Internal Server Error")
+		panics := logs.FilterMessage("panic while serving template").All()
+		test.That(t, panics, test.ShouldHaveLength, 1)
+		test.That(t, panics[0].ContextMap()["panic"], test.ShouldEqual, "handler exploded")
+		test.That(t, panics[0].ContextMap()["stack"], test.ShouldContainSubstring, "recoverPanic")
+	})
+
+	t.Run("panicking template func", func(t *testing.T) {
+		// the template package turns the panic into an execution error.
+		rr, _ := serve(staticHandler("page.html", nil, nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "error page: ")
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "template func exploded")
+		test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "before")
+	})
+
+	t.Run("ErrAbortHandler passes through", func(t *testing.T) {
+		defer func() {
+			test.That(t, recover(), test.ShouldEqual, http.ErrAbortHandler)
+		}()
+		serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			panic(http.ErrAbortHandler)
+		}))
+		t.Fatal("expected ErrAbortHandler to be panicked again")
+	})
+}
+
+func TestTemplateMiddlewareHandlerWrites(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(h TemplateHandlerFunc) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		NewTemplateMiddleware(tm, h, golog.NewTestLogger(t)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	t.Run("body without status", func(t *testing.T) {
+		rr := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			_, err := w.Write([]byte("handler body"))
+			return NamedTemplate("page.html"), nil, err
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "handler body")
+	})
+
+	t.Run("status without body", func(t *testing.T) {
+		rr := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			return NamedTemplate("page.html"), nil, nil
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusFound)
+		test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "page")
+	})
+
+	t.Run("capturer counts", func(t *testing.T) {
+		capW := responseWriterCapturer{ResponseWriter: httptest.NewRecorder()}
+		test.That(t, capW.Status(), test.ShouldEqual, 0)
+		_, err := capW.Write([]byte("abc"))
+		test.That(t, err, test.ShouldBeNil)
+		capW.WriteHeader(http.StatusTeapot)
+		test.That(t, capW.Status(), test.ShouldEqual, http.StatusOK)
+		test.That(t, capW.BytesWritten(), test.ShouldEqual, 3)
+	})
+}
+
+func TestTemplateWithStatus(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"created.html": "created",
+		"missing.html": "no such page",
+		"404.html":     "error template",
+	})
+	serve := func(tmpl *Template, unbuffered bool) *httptest.ResponseRecorder {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return tmpl, nil, nil
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.Unbuffered = unbuffered
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	for _, unbuffered := range []bool{false, true} {
+		unbuffered := unbuffered
+		t.Run(fmt.Sprintf("unbuffered=%t", unbuffered), func(t *testing.T) {
+			rr := serve(NamedTemplate("created.html").WithStatus(http.StatusCreated), unbuffered)
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusCreated)
+			test.That(t, rr.Body.String(), test.ShouldEqual, "created")
+
+			// the page is rendered rather than the error template.
+			rr = serve(NamedTemplate("missing.html").WithStatus(http.StatusNotFound), unbuffered)
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+			test.That(t, rr.Body.String(), test.ShouldEqual, "no such page")
+
+			rr = serve(NamedTemplate("created.html"), unbuffered)
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		})
+	}
+
+	base := NamedTemplate("created.html")
+	test.That(t, base.WithStatus(http.StatusAccepted).statusCode(), test.ShouldEqual, http.StatusAccepted)
+	test.That(t, base.statusCode(), test.ShouldEqual, http.StatusOK)
+}
+
+// countingResponseWriter counts the calls to WriteHeader.
+type countingResponseWriter struct {
+	*httptest.ResponseRecorder
+	writeHeaders int
+}
+
+func (w *countingResponseWriter) WriteHeader(code int) {
+	w.writeHeaders++
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func TestTemplateWithStatusErrorPages(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"404.html": "not found: {{ . }}",
+		"410.html": "gone: {{ . }}",
+		"500.html": "error template",
+	})
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusNotFound, "not found: /page"},
+		{http.StatusGone, "gone: /page"},
+	} {
+		status := tc.status
+		name := fmt.Sprintf("%d.html", status)
+		t.Run(name, func(t *testing.T) {
+			logger, logs := golog.NewObservedTestLogger(t)
+			h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+				return NamedTemplate(name).WithStatus(status).WithLastModified(modTime), "/page", nil
+			})
+			mw := NewTemplateMiddleware(tm, h, logger)
+			mw.ETags = true
+			mw.LogRequests = true
+			var errorsHandled int
+			mw.OnError = func(r *http.Request, err error, status int) {
+				errorsHandled++
+			}
+			req := httptest.NewRequest(http.MethodGet, "/page", nil)
+			req.Header.Set("If-None-Match", "*")
+			req.Header.Set("If-Modified-Since", modTime.Format(http.TimeFormat))
+			rr := &countingResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+			mw.ServeHTTP(rr, req)
+
+			test.That(t, rr.Code, test.ShouldEqual, status)
+			test.That(t, rr.writeHeaders, test.ShouldEqual, 1)
+			test.That(t, rr.Body.String(), test.ShouldEqual, tc.body)
+			test.That(t, rr.Header().Get("ETag"), test.ShouldBeEmpty)
+			test.That(t, rr.Header().Get("Last-Modified"), test.ShouldBeEmpty)
+			test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, DefaultTemplateContentType)
+			test.That(t, errorsHandled, test.ShouldEqual, 0)
+
+			entries := logs.FilterMessage("served template request").All()
+			test.That(t, entries, test.ShouldHaveLength, 1)
+			test.That(t, entries[0].ContextMap()["status"], test.ShouldEqual, int64(status))
+			test.That(t, entries[0].ContextMap()["template"], test.ShouldEqual, name)
+		})
+	}
+}
+
+func TestTemplateMiddlewareRequestFuncs(t *testing.T) {
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"page.html":   `path={{ requestPath }}`,
+		"layout.html": `[{{ requestPath }}: {{ block "content" . }}{{ end }}]`,
+	}, WithFuncs(template.FuncMap{"requestPath": func() string { return "" }}))
+	test.That(t, err, test.ShouldBeNil)
+	direct := template.Must(template.New("direct").Funcs(template.FuncMap{
+		"requestPath": func() string { return "" },
+	}).Parse(`direct={{ requestPath }}`))
+
+	serve := func(tmpl *Template, path string) string {
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return tmpl, nil, nil
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.RequestFuncs = func(r *http.Request) template.FuncMap {
+			return template.FuncMap{"requestPath": func() string { return r.URL.Path }}
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		return rr.Body.String()
+	}
+
+	t.Run("concurrent requests see their own values", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				path := fmt.Sprintf("/page/%d", i)
+				for j := 0; j < 10; j++ {
+					test.That(t, serve(NamedTemplate("page.html"), path), test.ShouldEqual, "path="+path)
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("layouts and direct templates", func(t *testing.T) {
+		test.That(t, serve(NamedTemplate("page.html").WithLayout("layout.html"), "/a"), test.ShouldEqual, "[/a: path=/a]")
+		test.That(t, serve(DirectTemplate(direct), "/b"), test.ShouldEqual, "direct=/b")
+		test.That(t, serve(DirectTemplate(direct), "/c"), test.ShouldEqual, "direct=/c")
+	})
+
+	t.Run("shared template is unaffected", func(t *testing.T) {
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "path=")
+	})
+
+	t.Run("templates are looked up once", func(t *testing.T) {
+		dir := t.TempDir()
+		test.That(t, os.WriteFile(filepath.Join(dir, "page.html"), []byte(`path={{ requestPath }}`), 0o600), test.ShouldBeNil)
+		test.That(t, os.WriteFile(filepath.Join(dir, "404.html"), []byte(`missing {{ requestPath }}`), 0o600), test.ShouldBeNil)
+		fsTM, err := NewTemplateManagerFS(dir, WithFuncs(template.FuncMap{"requestPath": func() string { return "" }}))
+		test.That(t, err, test.ShouldBeNil)
+		serve := func(handlerErr error, path string) (*httptest.ResponseRecorder, TemplateManagerStats) {
+			mw := NewTemplateMiddleware(fsTM, staticHandler("page.html", nil, handlerErr), golog.NewTestLogger(t))
+			mw.RequestFuncs = func(r *http.Request) template.FuncMap {
+				return template.FuncMap{"requestPath": func() string { return r.URL.Path }}
+			}
+			before := fsTM.(TemplateStatsProvider).Stats()
+			rr := httptest.NewRecorder()
+			mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			after := fsTM.(TemplateStatsProvider).Stats()
+			return rr, TemplateManagerStats{
+				Lookups:   after.Lookups - before.Lookups,
+				CacheHits: after.CacheHits + after.CacheMisses - before.CacheHits - before.CacheMisses,
+			}
+		}
+
+		rr, stats := serve(nil, "/a")
+		test.That(t, rr.Body.String(), test.ShouldEqual, "path=/a")
+		test.That(t, stats, test.ShouldResemble, TemplateManagerStats{Lookups: 1, CacheHits: 1})
+
+		rr, stats = serve(ErrNotFound, "/b")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "missing /b")
+		test.That(t, stats, test.ShouldResemble, TemplateManagerStats{Lookups: 1, CacheHits: 1})
+	})
+}
+
+func TestTemplateMiddlewareHead(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "some page",
+		"404.html":  "not found",
+	})
+	serve := func(method string, h TemplateHandler, skipRender bool) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.SkipHeadRender = skipRender
+		mw.ETags = true
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(method, "/", nil))
+		return rr
+	}
+
+	t.Run("headers match GET", func(t *testing.T) {
+		get := serve(http.MethodGet, staticHandler("page.html", nil, nil), false)
+		head := serve(http.MethodHead, staticHandler("page.html", nil, nil), false)
+		test.That(t, head.Code, test.ShouldEqual, get.Code)
+		test.That(t, head.Header(), test.ShouldResemble, get.Header())
+		test.That(t, head.Header().Get("Content-Length"), test.ShouldEqual, "9")
+		test.That(t, get.Body.String(), test.ShouldEqual, "some page")
+		test.That(t, head.Body.Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("error pages", func(t *testing.T) {
+		h := staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound))
+		get := serve(http.MethodGet, h, false)
+		head := serve(http.MethodHead, h, false)
+		test.That(t, head.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, head.Header(), test.ShouldResemble, get.Header())
+		test.That(t, get.Body.String(), test.ShouldEqual, "not found")
+		test.That(t, head.Body.Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("skip render", func(t *testing.T) {
+		// the template does not even need to exist.
+		head := serve(http.MethodHead, staticHandler("missing.html", nil, nil), true)
+		test.That(t, head.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, head.Body.Len(), test.ShouldEqual, 0)
+	})
+}
+
+func TestTemplateMiddlewareNilTemplate(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(h TemplateHandlerFunc) (*httptest.ResponseRecorder, int) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		rr := httptest.NewRecorder()
+		NewTemplateMiddleware(tm, h, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, logs.FilterMessage("handler returned no template and wrote no response").Len()
+	}
+
+	t.Run("wrote a body", func(t *testing.T) {
+		rr, warnings := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			_, err := w.Write([]byte("download"))
+			return nil, nil, err
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "download")
+		test.That(t, warnings, test.ShouldEqual, 0)
+	})
+
+	t.Run("wrote nothing", func(t *testing.T) {
+		rr, warnings := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return nil, nil, nil
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNoContent)
+		test.That(t, rr.Body.Len(), test.ShouldEqual, 0)
+		test.That(t, warnings, test.ShouldEqual, 1)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		rr, warnings := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate("page.html"), nil, nil
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+		test.That(t, warnings, test.ShouldEqual, 0)
+	})
+}
+
+func TestTemplateMiddlewareContentType(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": `<?xml version="1.0"?><page/>`,
+		"bad.html":  `{{ template "missing" }}`,
+		"404.html":  "not found",
+	})
+	serve := func(h TemplateHandler, configure func(*TemplateMiddleware)) *httptest.ResponseRecorder {
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		if configure != nil {
+			configure(mw)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		rr := serve(staticHandler("page.html", nil, nil), nil)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/html; charset=utf-8")
+
+		rr = serve(staticHandler("page.html", nil, nil), func(mw *TemplateMiddleware) {
+			mw.ContentType = "text/html; charset=iso-8859-1"
+		})
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/html; charset=iso-8859-1")
+
+		rr = serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return NamedTemplate("page.html").WithContentType("application/xml"), nil, nil
+		}), func(mw *TemplateMiddleware) {
+			mw.ContentType = "text/html; charset=iso-8859-1"
+		})
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "application/xml")
+	})
+
+	t.Run("templated error", func(t *testing.T) {
+		rr := serve(staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound)), nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/html; charset=utf-8")
+	})
+
+	t.Run("plain text fallback error", func(t *testing.T) {
+		rr := serve(staticHandler("bad.html", nil, nil), func(mw *TemplateMiddleware) {
+			mw.ContentType = "application/xml"
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, "text/plain; charset=utf-8")
+	})
+}
+
+func TestTemplateMiddlewareTransform(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "some page"})
+	serve := func(transform func([]byte) ([]byte, error), ifNoneMatch string) (*httptest.ResponseRecorder, int) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), logger)
+		mw.ETags = true
+		mw.Transform = transform
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr, logs.FilterMessage("failed to transform template output; writing it untransformed").Len()
+	}
+
+	t.Run("uppercase", func(t *testing.T) {
+		var calls int
+		upper := func(output []byte) ([]byte, error) {
+			calls++
+			return bytes.ToUpper(output), nil
+		}
+		rr, warnings := serve(upper, "")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "SOME PAGE")
+		test.That(t, rr.Header().Get("Content-Length"), test.ShouldEqual, "9")
+		test.That(t, warnings, test.ShouldEqual, 0)
+
+		plain, _ := serve(nil, "")
+		test.That(t, rr.Header().Get("ETag"), test.ShouldEqual, plain.Header().Get("ETag"))
+
+		rr, _ = serve(upper, plain.Header().Get("ETag"))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotModified)
+		test.That(t, calls, test.ShouldEqual, 1)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rr, warnings := serve(func(output []byte) ([]byte, error) {
+			return nil, errors.New("whoops")
+		}, "")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "some page")
+		test.That(t, warnings, test.ShouldEqual, 1)
+	})
+}
+
+func TestTemplateMiddlewareOnError(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"bad.html": `{{ template "missing" }}`,
+		"404.html": "not found",
+	})
+	type call struct {
+		path   string
+		err    error
+		status int
+	}
+	serve := func(h TemplateHandler, hookPanics bool) (*httptest.ResponseRecorder, []call) {
+		var calls []call
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.OnError = func(r *http.Request, err error, status int) {
+			calls = append(calls, call{r.URL.Path, err, status})
+			if hookPanics {
+				panic("hook broke")
+			}
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/path", nil))
+		return rr, calls
+	}
+
+	t.Run("handler error", func(t *testing.T) {
+		handlerErr := ErrorResponseStatus(http.StatusNotFound)
+		rr, calls := serve(staticHandler("page.html", nil, handlerErr), false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "not found")
+		test.That(t, calls, test.ShouldResemble, []call{{"/path", handlerErr, http.StatusNotFound}})
+	})
+
+	t.Run("template missing", func(t *testing.T) {
+		rr, calls := serve(staticHandler("nope.html", nil, nil), false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, calls, test.ShouldHaveLength, 1)
+		test.That(t, errors.Is(calls[0].err, ErrTemplateNotFound), test.ShouldBeTrue)
+		test.That(t, calls[0].status, test.ShouldEqual, http.StatusInternalServerError)
+	})
+
+	t.Run("render failure", func(t *testing.T) {
+		rr, calls := serve(staticHandler("bad.html", nil, nil), false)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, calls, test.ShouldHaveLength, 1)
+		test.That(t, calls[0].err.Error(), test.ShouldContainSubstring, "missing")
+	})
+
+	t.Run("panicking hook", func(t *testing.T) {
+		rr, calls := serve(staticHandler("page.html", nil, ErrorResponseStatus(http.StatusNotFound)), true)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusNotFound)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "not found")
+		test.That(t, calls, test.ShouldHaveLength, 1)
+	})
+}
+
+func TestTemplateMiddlewareClientGone(t *testing.T) {
+	var rendered int
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"page.html": "{{ count }}page",
+		"500.html":  "error page",
+	}, WithFuncs(template.FuncMap{
+		"count": func() string { rendered++; return "" },
+	}))
+	test.That(t, err, test.ShouldBeNil)
+
+	t.Run("canceled before render", func(t *testing.T) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			cancel()
+			return NamedTemplate("page.html"), nil, nil
+		})
+		rr := httptest.NewRecorder()
+		NewTemplateMiddleware(tm, h, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		test.That(t, rendered, test.ShouldEqual, 0)
+		test.That(t, rr.Body.Len(), test.ShouldEqual, 0)
+		test.That(t, logs.FilterMessage("client went away; not rendering").Len(), test.ShouldEqual, 1)
+		test.That(t, logs.FilterLevelExact(zapcore.WarnLevel).Len(), test.ShouldEqual, 0)
+		test.That(t, logs.FilterLevelExact(zapcore.ErrorLevel).Len(), test.ShouldEqual, 0)
+	})
+
+	t.Run("write to closed connection", func(t *testing.T) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, nil), logger)
+		mw.Unbuffered = true
+		w := &failingResponseWriter{ResponseRecorder: httptest.NewRecorder(), err: syscall.EPIPE}
+		mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, w.Body.String(), test.ShouldNotContainSubstring, "error page")
+		test.That(t, logs.FilterMessage("request canceled").Len(), test.ShouldEqual, 1)
+		test.That(t, logs.FilterLevelExact(zapcore.ErrorLevel).Len(), test.ShouldEqual, 0)
+	})
+}
+
+// failingResponseWriter fails every write with err.
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (w *failingResponseWriter) Write(b []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestTemplateMiddlewareResponseController(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	for name, configure := range map[string]func(*TemplateMiddleware){
+		"plain":        func(mw *TemplateMiddleware) {},
+		"render cache": func(mw *TemplateMiddleware) { mw.RenderCache = NewMemoryResponseCache(1) },
+	} {
+		configure := configure
+		t.Run(name, func(t *testing.T) {
+			var deadlineErr, flushErr error
+			h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+				rc := http.NewResponseController(w)
+				deadlineErr = rc.SetWriteDeadline(time.Now().Add(time.Minute))
+				if _, err := w.Write([]byte("streamed")); err != nil {
+					return nil, nil, err
+				}
+				flushErr = rc.Flush()
+				return nil, nil, nil
+			})
+			mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+			configure(mw)
+			server := httptest.NewServer(mw)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL)
+			test.That(t, err, test.ShouldBeNil)
+			defer resp.Body.Close()
+			test.That(t, resp.StatusCode, test.ShouldEqual, http.StatusOK)
+			test.That(t, deadlineErr, test.ShouldBeNil)
+			test.That(t, flushErr, test.ShouldBeNil)
+		})
+	}
+}
+
+func TestTemplateMiddlewareErrorAfterHandlerWrote(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"500.html": "error page"})
+	serve := func(h TemplateHandlerFunc) (*httptest.ResponseRecorder, *observer.ObservedLogs) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		rr := httptest.NewRecorder()
+		NewTemplateMiddleware(tm, h, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, logs
+	}
+
+	t.Run("wrote 200 then errored", func(t *testing.T) {
+		rr, logs := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			w.WriteHeader(http.StatusOK)
+			_, err := w.Write([]byte("partial"))
+			test.That(t, err, test.ShouldBeNil)
+			return nil, nil, errors.New("lost the database")
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "partial")
+		entries := logs.FilterMessage("error after the response was started; not rendering it").All()
+		test.That(t, entries, test.ShouldHaveLength, 1)
+		test.That(t, entries[0].ContextMap()["status"], test.ShouldEqual, http.StatusOK)
+		test.That(t, entries[0].ContextMap()["error_status"], test.ShouldEqual, http.StatusInternalServerError)
+	})
+
+	t.Run("wrote nothing then errored", func(t *testing.T) {
+		rr, logs := serve(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return nil, nil, errors.New("lost the database")
+		})
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+		test.That(t, logs.FilterMessage("error after the response was started; not rendering it").Len(), test.ShouldEqual, 0)
+	})
+}
+
+type panickingWriter struct{}
+
+func (panickingWriter) Write([]byte) (int, error) {
+	panic("writer broke")
+}
+
+func TestTemplateMiddlewareExecutePanics(t *testing.T) {
+	tm, err := NewTemplateManagerFromMap(map[string]string{
+		"boom.html":  `before {{ boom }} after`,
+		"index.html": `{{ index .List 5 }}`,
+		"500.html":   `error page`,
+	}, WithFuncs(template.FuncMap{
+		"boom": func() string {
+			var m map[string]int
+			m["nil"] = 1
+			return ""
+		},
+	}))
+	test.That(t, err, test.ShouldBeNil)
+	serve := func(name string) (*httptest.ResponseRecorder, error) {
+		var handled error
+		mw := NewTemplateMiddleware(tm, staticHandler(name, map[string]interface{}{"List": []int{1}}, nil), golog.NewTestLogger(t))
+		mw.OnError = func(r *http.Request, err error, status int) {
+			handled = err
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, handled
+	}
+
+	t.Run("panicking function", func(t *testing.T) {
+		rr, handled := serve("boom.html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+		test.That(t, handled, test.ShouldNotBeNil)
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "boom.html")
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "error calling boom")
+	})
+
+	t.Run("builtin failing", func(t *testing.T) {
+		rr, handled := serve("index.html")
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "index.html")
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "error calling index")
+	})
+
+	t.Run("panic escaping Execute", func(t *testing.T) {
+		gt, err := tm.LookupTemplate("boom.html")
+		test.That(t, err, test.ShouldBeNil)
+		execute := recoverExecute("boom.html", func(w io.Writer) error { return gt.Execute(w, nil) })
+		err = execute(panickingWriter{})
+		var tpe templatePanicError
+		test.That(t, errors.As(err, &tpe), test.ShouldBeTrue)
+		test.That(t, err.Error(), test.ShouldEqual, `panic while executing template "boom.html": writer broke`)
+		var pe panicError
+		test.That(t, errors.As(err, &pe), test.ShouldBeTrue)
+		test.That(t, string(pe.stack), test.ShouldContainSubstring, "panickingWriter")
+
+		execute = recoverExecute("boom.html", func(w io.Writer) error { panic(http.ErrAbortHandler) })
+		test.That(t, func() { utils.UncheckedError(execute(io.Discard)) }, test.ShouldPanicWith, http.ErrAbortHandler)
+	})
+}
+
+func TestTemplateMiddlewareSequence(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{
+		"header.html": "<header>{{ .Title }}</header>",
+		"body.html":   "<main>{{ .Body }}</main>",
+		"broken.html": "<main>{{ .Body.Nope }}</main>",
+		"footer.html": "<footer>{{ .Title }}</footer>",
+		"500.html":    "error page",
+	})
+	data := map[string]interface{}{"Title": "title", "Body": "body"}
+	serve := func(tmpl *Template) (*httptest.ResponseRecorder, error) {
+		var handled error
+		h := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			return tmpl, data, nil
+		})
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.OnError = func(r *http.Request, err error, status int) {
+			handled = err
+		}
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, handled
+	}
+
+	t.Run("three pieces", func(t *testing.T) {
+		rr, handled := serve(Sequence("header.html", "body.html", "footer.html"))
+		test.That(t, handled, test.ShouldBeNil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusOK)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<header>title</header><main>body</main><footer>title</footer>")
+
+		rr, _ = serve(NamedTemplate("header.html").Then("body.html").Then("footer.html").WithStatus(http.StatusAccepted))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusAccepted)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<header>title</header><main>body</main><footer>title</footer>")
+	})
+
+	t.Run("failing piece", func(t *testing.T) {
+		rr, handled := serve(Sequence("header.html", "broken.html", "footer.html"))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "broken.html")
+	})
+
+	t.Run("missing piece", func(t *testing.T) {
+		rr, handled := serve(Sequence("header.html", "nope.html", "footer.html"))
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "error page")
+		test.That(t, errors.Is(handled, ErrTemplateNotFound), test.ShouldBeTrue)
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "template 2 of sequence")
+		test.That(t, handled.Error(), test.ShouldContainSubstring, "nope.html")
+	})
+
+	t.Run("copies", func(t *testing.T) {
+		base := Sequence("header.html", "body.html")
+		_ = base.Then("footer.html")
+		rr, _ := serve(base)
+		test.That(t, rr.Body.String(), test.ShouldEqual, "<header>title</header><main>body</main>")
+	})
+}
+
+func TestTemplateMiddlewareNilFields(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	h := staticHandler("page.html", nil, nil)
+	for _, tc := range []struct {
+		name    string
+		mw      *TemplateMiddleware
+		message string
+	}{
+		{"no templates", &TemplateMiddleware{Handler: h}, "template middleware has no TemplateManager"},
+		{"no handler", &TemplateMiddleware{Templates: tm}, "template middleware has no TemplateHandler"},
+		{"nothing", &TemplateMiddleware{}, "template middleware has no TemplateHandler"},
+		{"no templates with logger", &TemplateMiddleware{Handler: h, Logger: golog.NewTestLogger(t)},
+			"template middleware has no TemplateManager"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			test.That(t, func() { tc.mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil)) }, test.ShouldNotPanic)
+			test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+			test.That(t, rr.Body.String(), test.ShouldEqual, tc.message+"\n")
+		})
+	}
+
+	t.Run("no logger", func(t *testing.T) {
+		mw := &TemplateMiddleware{Templates: tm, Handler: staticHandler("missing.html", nil, nil), LogRequests: true}
+		rr := httptest.NewRecorder()
+		test.That(t, func() { mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil)) }, test.ShouldNotPanic)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+
+		mw = &TemplateMiddleware{Templates: tm, Handler: h}
+		rr = httptest.NewRecorder()
+		mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		test.That(t, rr.Body.String(), test.ShouldEqual, "page")
+	})
+}
+
+func TestTemplateMiddlewareLogLevelFor(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(handlerErr error, configure func(*TemplateMiddleware)) []observer.LoggedEntry {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), logger)
+		if configure != nil {
+			configure(mw)
+		}
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		return logs.All()
+	}
+	canceled := NewErrorResponse(http.StatusBadGateway, "upstream: %w", context.Canceled)
+
+	for _, tc := range []struct {
+		err   error
+		level zapcore.Level
+	}{
+		{ErrNotFound, zapcore.InfoLevel},
+		{ErrUnauthorized, zapcore.InfoLevel},
+		{ErrConflict, zapcore.WarnLevel},
+		{errors.New("boom"), zapcore.ErrorLevel},
+		{canceled, zapcore.DebugLevel},
+	} {
+		logged := serve(tc.err, nil)
+		test.That(t, logged, test.ShouldHaveLength, 1)
+		test.That(t, logged[0].Level, test.ShouldEqual, tc.level)
+	}
+
+	test.That(t, DefaultLogLevelFor(http.StatusNotFound, ErrNotFound), test.ShouldEqual, LevelInfo)
+	test.That(t, DefaultLogLevelFor(http.StatusForbidden, ErrForbidden), test.ShouldEqual, LevelWarn)
+	test.That(t, DefaultLogLevelFor(http.StatusInternalServerError, errors.New("boom")), test.ShouldEqual, LevelError)
+	test.That(t, DefaultLogLevelFor(http.StatusInternalServerError, context.Canceled), test.ShouldEqual, LevelDebug)
+
+	t.Run("override", func(t *testing.T) {
+		var statuses []int
+		configure := func(mw *TemplateMiddleware) {
+			mw.LogLevelFor = func(status int, err error) Level {
+				statuses = append(statuses, status)
+				if errors.Is(err, ErrNotFound) {
+					return LevelDebug
+				}
+				return LevelWarn
+			}
+		}
+		logged := serve(ErrNotFound, configure)
+		test.That(t, logged[0].Level, test.ShouldEqual, zapcore.DebugLevel)
+		test.That(t, logged[0].Message, test.ShouldEqual, "Error with non-5xx status during http response: Not Found")
+		logged = serve(errors.New("boom"), configure)
+		test.That(t, logged[0].Level, test.ShouldEqual, zapcore.WarnLevel)
+		test.That(t, logged[0].Message, test.ShouldEqual, "Error during http response: boom")
+		test.That(t, statuses, test.ShouldResemble, []int{http.StatusNotFound, http.StatusInternalServerError})
+	})
+}
+
+func TestTemplateMiddlewareSanitizeErrors(t *testing.T) {
+	internal := errors.New("pq: password authentication failed for user app")
+	withTemplate := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page",
+		"500.html":  "error: {{ .Message }} / {{ .Error }} / {{ .Err.Error }}",
+	})
+	plain := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(tm TemplateManager, handlerErr error, accept string, configure func(*TemplateMiddleware)) (
+		*httptest.ResponseRecorder, []observer.LoggedEntry, error,
+	) {
+		logger, logs := golog.NewObservedTestLogger(t)
+		mw := NewTemplateMiddleware(tm, staticHandler("page.html", nil, handlerErr), logger)
+		mw.SanitizeErrors = true
+		var hooked error
+		mw.OnError = func(r *http.Request, err error, status int) {
+			hooked = err
+		}
+		if configure != nil {
+			configure(mw)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr, logs.All(), hooked
+	}
+	checkSanitized := func(t *testing.T, rr *httptest.ResponseRecorder, logged []observer.LoggedEntry, hooked error) {
+		t.Helper()
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "Internal Server Error")
+		test.That(t, rr.Body.String(), test.ShouldNotContainSubstring, "pq:")
+		test.That(t, logged[0].Message, test.ShouldContainSubstring, internal.Error())
+		test.That(t, errors.Is(hooked, internal), test.ShouldBeTrue)
+	}
+	wrapped := fmt.Errorf("loading user: %w", internal)
+
+	t.Run("error template", func(t *testing.T) {
+		rr, logged, hooked := serve(withTemplate, wrapped, "", nil)
+		checkSanitized(t, rr, logged, hooked)
+		test.That(t, rr.Body.String(), test.ShouldEqual,
+			"error: Internal Server Error / Internal Server Error / Internal Server Error")
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		rr, logged, hooked := serve(plain, wrapped, "", nil)
+		checkSanitized(t, rr, logged, hooked)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "Internal Server Error\nerror ID: ")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rr, logged, hooked := serve(plain, wrapped, "application/json", nil)
+		checkSanitized(t, rr, logged, hooked)
+	})
+
+	t.Run("overrides DevMode", func(t *testing.T) {
+		rr, logged, hooked := serve(plain, wrapped, "", func(mw *TemplateMiddleware) {
+			mw.DevMode = true
+		})
+		checkSanitized(t, rr, logged, hooked)
+	})
+
+	t.Run("ErrorResponses are shown", func(t *testing.T) {
+		rr, _, _ := serve(plain, NewErrorResponse(http.StatusServiceUnavailable, "down for maintenance"), "", nil)
+		test.That(t, rr.Code, test.ShouldEqual, http.StatusServiceUnavailable)
+		test.That(t, rr.Body.String(), test.ShouldStartWith, "down for maintenance\n")
+	})
+
+	t.Run("off", func(t *testing.T) {
+		rr, _, _ := serve(plain, wrapped, "", func(mw *TemplateMiddleware) {
+			mw.SanitizeErrors = false
+		})
+		test.That(t, rr.Body.String(), test.ShouldContainSubstring, "pq:")
+	})
+}
+
+func TestTemplateMiddlewareErrorContentType(t *testing.T) {
+	withTemplate := mustTemplateManagerFromMap(t, map[string]string{
+		"page.html": "page {{ .Nope }}",
+		"500.html":  "error page",
+	})
+	plain := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page {{ .Nope }}"})
+	handlerFailing := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+		w.Header().Set("Content-Length", "12345")
+		return nil, nil, errors.New("report failed")
+	})
+	renderFailing := TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+		return NamedTemplate("page.html").WithLastModified(time.Now()), 42, nil
+	})
+	for _, tc := range []struct {
+		name        string
+		tm          TemplateManager
+		accept      string
+		contentType string
+	}{
+		{"error template", withTemplate, "text/html", DefaultTemplateContentType},
+		{"plain text", plain, "text/html", "text/plain; charset=utf-8"},
+		{"JSON", withTemplate, "application/json", "application/json"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, h := range []TemplateHandler{handlerFailing, renderFailing} {
+				mw := NewTemplateMiddleware(tc.tm, h, golog.NewTestLogger(t))
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("Accept", tc.accept)
+				rr := httptest.NewRecorder()
+				mw.ServeHTTP(rr, req)
+				test.That(t, rr.Code, test.ShouldEqual, http.StatusInternalServerError)
+				test.That(t, rr.Header().Get("Content-Type"), test.ShouldEqual, tc.contentType)
+				for _, name := range []string{"Content-Disposition", "Content-Length", "ETag", "Last-Modified"} {
+					test.That(t, rr.Header().Values(name), test.ShouldBeEmpty)
+				}
+			}
+		})
+	}
+}
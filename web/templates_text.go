@@ -0,0 +1,155 @@
+package web
+
+import (
+	"io/fs"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+
+	"go.viam.com/utils/web/protojson"
+)
+
+// TextTemplateManager is the text/template counterpart of TemplateManager for rendering output
+// that must not be HTML escaped, such as plain-text emails or scripts.
+type TextTemplateManager interface {
+	LookupTemplate(name string) (*template.Template, error)
+
+	// Names returns the sorted names of every defined template.
+	Names() ([]string, error)
+
+	// Validate parses every template file on its own and returns an error listing
+	// each file that fails to parse, rather than stopping at the first failure.
+	Validate() error
+}
+
+// NewTextTemplateManager creates a TextTemplateManager that loads its templates from the given
+// source. It accepts the same options, loads the same files, and provides the same functions as
+// NewTemplateManager does.
+func NewTextTemplateManager(src TemplateSource, opts ...TemplateManagerOption) (TextTemplateManager, error) {
+	o := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	tm := &textTM{opts: o, src: src}
+	if src.static() {
+		if _, err := tm.templates(); err != nil {
+			return nil, err
+		}
+	}
+	return tm, nil
+}
+
+type textTM struct {
+	opts templateManagerOptions
+
+	src TemplateSource
+
+	mu          sync.Mutex
+	cached      *template.Template
+	cachedFiles []templateFile
+}
+
+func (tm *textTM) LookupTemplate(name string) (*template.Template, error) {
+	main, err := tm.templates()
+	if err != nil {
+		return nil, err
+	}
+	return lookupTextTemplate(main, name)
+}
+
+func (tm *textTM) Names() ([]string, error) {
+	main, err := tm.templates()
+	if err != nil {
+		return nil, err
+	}
+	return textTemplateNames(main), nil
+}
+
+func (tm *textTM) Validate() error {
+	fsys, srcDir := tm.src.templateFS()
+	files, err := findTemplateFiles(fsys, srcDir, tm.opts)
+	if err != nil {
+		return err
+	}
+	return validateTemplateFiles(fsys, files, tm.opts, func(fsys fs.FS, files []templateFile, opts templateManagerOptions) error {
+		_, err := parseTextTemplateFiles(fsys, files, opts)
+		return err
+	})
+}
+
+// templates returns the cached template set. Static sources are parsed once; others are
+// reparsed whenever their files change.
+func (tm *textTM) templates() (*template.Template, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.cached != nil && tm.src.static() {
+		return tm.cached, nil
+	}
+
+	fsys, srcDir := tm.src.templateFS()
+	files, err := findTemplateFiles(fsys, srcDir, tm.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if tm.cached != nil && templateFilesEqual(tm.cachedFiles, files) {
+		return tm.cached, nil
+	}
+
+	main, err := parseTextTemplateFiles(fsys, files, tm.opts)
+	if err != nil {
+		return nil, err
+	}
+	tm.cached = main
+	tm.cachedFiles = files
+	return main, nil
+}
+
+func lookupTextTemplate(main *template.Template, name string) (*template.Template, error) {
+	t := main.Lookup(name)
+	if t == nil {
+		return nil, templateNotFoundError(name)
+	}
+	return t, nil
+}
+
+func textTemplateNames(main *template.Template) []string {
+	var names []string
+	for _, t := range main.Templates() {
+		if t.Tree == nil || isInternalTemplateName(t.Name()) {
+			continue
+		}
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseTextTemplateFiles(fsys fs.FS, files []templateFile, opts templateManagerOptions) (*template.Template, error) {
+	main := baseTextTemplate(opts)
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f.path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := main.New(f.name).Parse(string(b)); err != nil {
+			parseErr := newTemplateParseError(f.path, err)
+			parseErr.Source = b
+			return nil, parseErr
+		}
+	}
+	return main, nil
+}
+
+func baseTextTemplate(opts templateManagerOptions) *template.Template {
+	funcs := template.FuncMap(opts.templateFuncs(sprig.TxtFuncMap()))
+	main := template.New(opts.baseName).Delims(opts.leftDelim, opts.rightDelim).Funcs(funcs)
+	if opts.strictKeys {
+		main = main.Option("missingkey=error")
+	}
+	return main
+}
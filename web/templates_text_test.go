@@ -0,0 +1,77 @@
+package web
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestTextTemplateManager(t *testing.T) {
+	const source = `Hi {{ .Name }} & welcome <{{ upper .Email }}>{{ if .Script }}
+if [ "$x" -lt 1 ]; then echo '{{ .Script }}'; fi{{ end }}`
+	data := struct{ Name, Email, Script string }{"Tom & Jerry", "tom@example.com", "a && b"}
+	const expected = `Hi Tom & Jerry & welcome <TOM@EXAMPLE.COM>
+if [ "$x" -lt 1 ]; then echo 'a && b'; fi`
+
+	dir := t.TempDir()
+	writeTemplateFile(t, filepath.Join(dir, "welcome.txt"), source, time.Now())
+	fsys := fstest.MapFS{"templates/welcome.txt": &fstest.MapFile{Data: []byte(source)}}
+
+	for name, src := range map[string]TemplateSource{
+		"dir":   DirTemplateSource(dir),
+		"embed": EmbedTemplateSource(fsys, "templates"),
+	} {
+		src := src
+		t.Run(name, func(t *testing.T) {
+			tm, err := NewTextTemplateManager(src, WithGlobs("*.txt"))
+			test.That(t, err, test.ShouldBeNil)
+
+			tmpl, err := tm.LookupTemplate("welcome.txt")
+			test.That(t, err, test.ShouldBeNil)
+			var buf bytes.Buffer
+			test.That(t, tmpl.Execute(&buf, data), test.ShouldBeNil)
+			test.That(t, buf.String(), test.ShouldEqual, expected)
+
+			names, err := tm.Names()
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, names, test.ShouldResemble, []string{"welcome.txt"})
+
+			_, err = tm.LookupTemplate("missing.txt")
+			test.That(t, err, test.ShouldNotBeNil)
+			test.That(t, err.Error(), test.ShouldContainSubstring, "cannot find template missing.txt")
+		})
+	}
+
+	t.Run("the html manager escapes the same template", func(t *testing.T) {
+		tm, err := NewTemplateManager(EmbedTemplateSource(fsys, "templates"), WithGlobs("*.txt"))
+		test.That(t, err, test.ShouldBeNil)
+		tmpl, err := tm.LookupTemplate("welcome.txt")
+		test.That(t, err, test.ShouldBeNil)
+		var buf bytes.Buffer
+		test.That(t, tmpl.Execute(&buf, data), test.ShouldBeNil)
+		test.That(t, buf.String(), test.ShouldNotEqual, expected)
+		test.That(t, buf.String(), test.ShouldContainSubstring, "&amp;")
+	})
+
+	t.Run("the html manager lists the same names", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"templates/base.txt": &fstest.MapFile{Data: []byte(`base {{ block "content" . }}{{ end }}`)},
+			"templates/page.txt": &fstest.MapFile{Data: []byte(`{{ define "extends" }}base.txt{{ end }}page`)},
+			"templates/nav.txt":  &fstest.MapFile{Data: []byte(`{{ define "nav" }}nav{{ end }}`)},
+		}
+		htm, err := NewTemplateManager(EmbedTemplateSource(fsys, "templates"), WithGlobs("*.txt"))
+		test.That(t, err, test.ShouldBeNil)
+		ttm, err := NewTextTemplateManager(EmbedTemplateSource(fsys, "templates"), WithGlobs("*.txt"))
+		test.That(t, err, test.ShouldBeNil)
+
+		htmlNames, err := listTemplates(htm)
+		test.That(t, err, test.ShouldBeNil)
+		textNames, err := ttm.Names()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, textNames, test.ShouldResemble, htmlNames)
+	})
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+
+	"go.opencensus.io/trace"
+)
+
+// Span names used by TemplateMiddleware.
+const (
+	// TemplateHandlerSpan covers the TemplateHandler's Serve.
+	TemplateHandlerSpan = "template.handler"
+	// TemplateRenderSpan covers looking up and rendering the template, or the error.
+	TemplateRenderSpan = "template.render"
+)
+
+// TemplateTracer starts the spans TemplateMiddleware records. It is deliberately small so that
+// any tracing library can be adapted to it; OpenCensusTracer adapts the one used elsewhere in
+// this module, and the go.viam.com/utils/web/oteltrace module adapts OpenTelemetry.
+type TemplateTracer interface {
+	// Start starts a span named name as a child of any span in ctx and returns a context
+	// holding the new span.
+	Start(ctx context.Context, name string) (context.Context, TemplateSpan)
+}
+
+// TemplateSpan is a span started by a TemplateTracer.
+type TemplateSpan interface {
+	// SetAttribute annotates the span. value is a string, int or bool.
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	// End finishes the span.
+	End()
+}
+
+// Attribute keys set on TemplateMiddleware spans.
+const (
+	templateSpanAttribute = "template"
+	statusSpanAttribute   = "http.status_code"
+)
+
+// startSpan starts a span if tm has a tracer. The returned span is nil otherwise.
+func (tm *TemplateMiddleware) startSpan(ctx context.Context, name string) (context.Context, TemplateSpan) {
+	if tm.Tracer == nil {
+		return ctx, nil
+	}
+	return tm.Tracer.Start(ctx, name)
+}
+
+// endSpan annotates and ends span if it is not nil.
+func endSpan(span TemplateSpan, template string, status int, err error) {
+	if span == nil {
+		return
+	}
+	if template != "" {
+		span.SetAttribute(templateSpanAttribute, template)
+	}
+	if status != 0 {
+		span.SetAttribute(statusSpanAttribute, status)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// OpenCensusTracer returns a TemplateTracer recording spans with go.opencensus.io/trace.
+func OpenCensusTracer() TemplateTracer {
+	return openCensusTracer{}
+}
+
+type openCensusTracer struct{}
+
+func (openCensusTracer) Start(ctx context.Context, name string) (context.Context, TemplateSpan) {
+	ctx, span := trace.StartSpan(ctx, name)
+	return ctx, openCensusSpan{span}
+}
+
+type openCensusSpan struct {
+	span *trace.Span
+}
+
+func (s openCensusSpan) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.AddAttributes(trace.StringAttribute(key, v))
+	case int:
+		s.span.AddAttributes(trace.Int64Attribute(key, int64(v)))
+	case bool:
+		s.span.AddAttributes(trace.BoolAttribute(key, v))
+	}
+}
+
+func (s openCensusSpan) RecordError(err error) {
+	s.span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+}
+
+func (s openCensusSpan) End() {
+	s.span.End()
+}
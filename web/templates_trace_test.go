@@ -0,0 +1,111 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+)
+
+type fakeSpan struct {
+	name        string
+	parent      *fakeSpan
+	attributes  map[string]interface{}
+	err         error
+	ended       bool
+	hasDeadline bool
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *fakeSpan) RecordError(err error)                      { s.err = err }
+func (s *fakeSpan) End()                                       { s.ended = true }
+
+type fakeSpanKey struct{}
+
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (tr *fakeTracer) Start(ctx context.Context, name string) (context.Context, TemplateSpan) {
+	parent, _ := ctx.Value(fakeSpanKey{}).(*fakeSpan)
+	_, hasDeadline := ctx.Deadline()
+	span := &fakeSpan{name: name, parent: parent, attributes: map[string]interface{}{}, hasDeadline: hasDeadline}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, fakeSpanKey{}, span), span
+}
+
+func TestTemplateMiddlewareTracing(t *testing.T) {
+	tm := mustTemplateManagerFromMap(t, map[string]string{"page.html": "page"})
+	serve := func(h TemplateHandler) []*fakeSpan {
+		tracer := &fakeTracer{}
+		mw := NewTemplateMiddleware(tm, h, golog.NewTestLogger(t))
+		mw.Tracer = tracer
+		root := &fakeSpan{name: "request"}
+		ctx := context.WithValue(context.Background(), fakeSpanKey{}, root)
+		mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		for _, span := range tracer.spans {
+			test.That(t, span.parent, test.ShouldEqual, root)
+			test.That(t, span.ended, test.ShouldBeTrue)
+			test.That(t, span.hasDeadline, test.ShouldBeTrue)
+		}
+		return tracer.spans
+	}
+
+	t.Run("success", func(t *testing.T) {
+		var handlerSpan interface{}
+		spans := serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			handlerSpan = r.Context().Value(fakeSpanKey{})
+			return NamedTemplate("page.html"), nil, nil
+		}))
+		test.That(t, spans, test.ShouldHaveLength, 2)
+		test.That(t, spans[0].name, test.ShouldEqual, TemplateHandlerSpan)
+		test.That(t, handlerSpan, test.ShouldEqual, spans[0])
+		test.That(t, spans[0].attributes["template"], test.ShouldEqual, "page.html")
+		test.That(t, spans[1].name, test.ShouldEqual, TemplateRenderSpan)
+		test.That(t, spans[1].attributes, test.ShouldResemble, map[string]interface{}{
+			"template":         "page.html",
+			"http.status_code": http.StatusOK,
+		})
+		test.That(t, spans[1].err, test.ShouldBeNil)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		handlerErr := errors.New("handler failed")
+		spans := serve(staticHandler("page.html", nil, handlerErr))
+		test.That(t, spans, test.ShouldHaveLength, 1)
+		test.That(t, spans[0].err, test.ShouldEqual, handlerErr)
+	})
+
+	t.Run("render error", func(t *testing.T) {
+		spans := serve(staticHandler("missing.html", nil, nil))
+		test.That(t, spans, test.ShouldHaveLength, 2)
+		test.That(t, spans[0].err, test.ShouldBeNil)
+		test.That(t, errors.Is(spans[1].err, ErrTemplateNotFound), test.ShouldBeTrue)
+		test.That(t, spans[1].attributes["http.status_code"], test.ShouldEqual, http.StatusInternalServerError)
+	})
+
+	t.Run("panicking handler", func(t *testing.T) {
+		spans := serve(TemplateHandlerFunc(func(w http.ResponseWriter, r *http.Request) (*Template, interface{}, error) {
+			panic("boom")
+		}))
+		test.That(t, spans, test.ShouldHaveLength, 1)
+		test.That(t, spans[0].err, test.ShouldNotBeNil)
+	})
+}
+
+func TestOpenCensusTracer(t *testing.T) {
+	ctx, span := OpenCensusTracer().Start(context.Background(), "test")
+	test.That(t, ctx, test.ShouldNotBeNil)
+	span.SetAttribute("template", "page.html")
+	span.SetAttribute("http.status_code", 200)
+	span.RecordError(errors.New("failed"))
+	span.End()
+}
@@ -0,0 +1,356 @@
+package web
+
+import (
+	"context"
+	"html/template"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/edaniels/golog"
+	"github.com/fsnotify/fsnotify"
+
+	"go.viam.com/utils"
+	"go.viam.com/utils/web/protojson"
+)
+
+const (
+	// watchDebounce is how long to wait after a file event before reparsing so that
+	// a burst of events from a single save only causes one reparse.
+	watchDebounce = 50 * time.Millisecond
+
+	// watchPollInterval is how often the directory is checked when fsnotify is unavailable.
+	watchPollInterval = time.Second
+)
+
+// WatchedTemplateManager is a TemplateManager that reparses its templates in the background
+// whenever its source directory changes. It must be closed when no longer needed.
+type WatchedTemplateManager interface {
+	ReloadableTemplateManager
+
+	// Subscribe returns a channel that receives a TemplateChange whenever a reload, in the
+	// background or from Reload, changes any template. Reloads never wait for subscribers: a
+	// change that is not received before the next one is merged into it. The channel is closed by
+	// Unsubscribe or Close.
+	Subscribe() <-chan TemplateChange
+
+	// Unsubscribe stops delivery to and closes a channel returned by Subscribe.
+	Unsubscribe(ch <-chan TemplateChange)
+
+	Close() error
+}
+
+// TemplateChange describes templates that changed during a reload.
+type TemplateChange struct {
+	// Names are the sorted names of the templates that were added, removed or whose source
+	// file changed.
+	Names []string
+	// Time is when the change was loaded.
+	Time time.Time
+}
+
+type watchedTM struct {
+	// templates does the parsing and caching. Lookups only ever use its loaded set while the
+	// background watcher is responsible for asking it to reparse.
+	templates *fsTM
+
+	srcDir string
+	logger golog.Logger
+
+	watcher *fsnotify.Watcher
+
+	subscribersMu sync.Mutex
+	subscribers   map[<-chan TemplateChange]chan TemplateChange
+	closed        bool
+
+	cancel                  func()
+	activeBackgroundWorkers sync.WaitGroup
+}
+
+// NewTemplateManagerWatched creates a TemplateManager from the file system that watches srcDir
+// for changes and reparses the templates in the background. Lookups always see a complete,
+// successfully parsed set; if a reparse fails, the error is logged and the previous set is kept.
+func NewTemplateManagerWatched(srcDir string, tmOpts ...TemplateManagerOption) (WatchedTemplateManager, error) {
+	o := newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), tmOpts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return newWatchedTM(srcDir, o, golog.Global())
+}
+
+func newWatchedTM(srcDir string, opts templateManagerOptions, logger golog.Logger) (*watchedTM, error) {
+	tm := &watchedTM{
+		templates: &fsTM{opts: opts, src: DirTemplateSource(srcDir)},
+		srcDir:    srcDir,
+		logger:    logger,
+	}
+	if err := tm.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = addDirWatches(watcher, srcDir); err != nil {
+			utils.UncheckedError(watcher.Close())
+		}
+	}
+	if err != nil {
+		logger.Warnw("cannot watch template directory; falling back to polling", "dir", srcDir, "error", err)
+		watcher = nil
+	}
+	tm.watcher = watcher
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tm.cancel = cancel
+	tm.activeBackgroundWorkers.Add(1)
+	utils.PanicCapturingGo(func() {
+		defer tm.activeBackgroundWorkers.Done()
+		tm.watch(ctx)
+	})
+	return tm, nil
+}
+
+func (tm *watchedTM) LookupTemplate(name string) (*template.Template, error) {
+	t, err := tm.templates.loaded().lookup(name)
+	tm.templates.stats.cached(true)
+	tm.templates.stats.lookedUp(err)
+	return t, err
+}
+
+func (tm *watchedTM) Stats() TemplateManagerStats {
+	return tm.templates.Stats()
+}
+
+// LookupTemplateCtx never blocks since templates are reparsed in the background.
+func (tm *watchedTM) LookupTemplateCtx(ctx context.Context, name string) (*template.Template, error) {
+	return tm.LookupTemplate(name)
+}
+
+func (tm *watchedTM) LookupTemplateInfo(name string) (TemplateInfo, error) {
+	return tm.templates.loaded().info(name)
+}
+
+func (tm *watchedTM) LookupLayout(layout, page string) (*template.Template, error) {
+	return tm.templates.loaded().layout(layout, page)
+}
+
+func (tm *watchedTM) NormalizeTemplateName(filename string) string {
+	return tm.templates.NormalizeTemplateName(filename)
+}
+
+func (tm *watchedTM) Names() ([]string, error) {
+	return tm.templates.loaded().names(), nil
+}
+
+func (tm *watchedTM) Validate() error {
+	return tm.templates.Validate()
+}
+
+func (tm *watchedTM) Reload() error {
+	before := tm.templates.loaded()
+	err := tm.templates.Reload()
+	tm.notify(before)
+	return err
+}
+
+func (tm *watchedTM) Subscribe() <-chan TemplateChange {
+	ch := make(chan TemplateChange, 1)
+	tm.subscribersMu.Lock()
+	defer tm.subscribersMu.Unlock()
+	if tm.closed {
+		close(ch)
+		return ch
+	}
+	if tm.subscribers == nil {
+		tm.subscribers = map[<-chan TemplateChange]chan TemplateChange{}
+	}
+	tm.subscribers[ch] = ch
+	return ch
+}
+
+func (tm *watchedTM) Unsubscribe(ch <-chan TemplateChange) {
+	tm.subscribersMu.Lock()
+	defer tm.subscribersMu.Unlock()
+	if sub, ok := tm.subscribers[ch]; ok {
+		delete(tm.subscribers, ch)
+		close(sub)
+	}
+}
+
+func (tm *watchedTM) Close() error {
+	tm.cancel()
+	var err error
+	if tm.watcher != nil {
+		err = tm.watcher.Close()
+	}
+	tm.activeBackgroundWorkers.Wait()
+
+	tm.subscribersMu.Lock()
+	defer tm.subscribersMu.Unlock()
+	tm.closed = true
+	for ch, sub := range tm.subscribers {
+		delete(tm.subscribers, ch)
+		close(sub)
+	}
+	return err
+}
+
+// notify tells subscribers which templates changed since before was the loaded set.
+func (tm *watchedTM) notify(before *templateSet) {
+	after := tm.templates.loaded()
+	if before == nil || after == before {
+		return
+	}
+	names := changedTemplates(before, after)
+	if len(names) == 0 {
+		return
+	}
+	change := TemplateChange{Names: names, Time: time.Now()}
+
+	tm.subscribersMu.Lock()
+	defer tm.subscribersMu.Unlock()
+	for _, sub := range tm.subscribers {
+		select {
+		case sub <- change:
+			continue
+		default:
+		}
+		// the subscriber has not received the previous change yet so merge it into this one. Only
+		// notify sends, so after taking the pending change the send cannot block.
+		merged := change
+		select {
+		case pending := <-sub:
+			merged.Names = mergeTemplateNames(pending.Names, change.Names)
+		default:
+		}
+		sub <- merged
+	}
+}
+
+// changedTemplates returns the sorted names of the templates that are defined in only one of the
+// sets or whose source file differs between them.
+func changedTemplates(before, after *templateSet) []string {
+	hashes := func(ts *templateSet) map[string]string {
+		byName := make(map[string]string, len(ts.files))
+		for _, f := range ts.files {
+			byName[f.name] = f.hash
+		}
+		return byName
+	}
+	beforeHashes, afterHashes := hashes(before), hashes(after)
+	changedFiles := map[string]bool{}
+	for name, hash := range beforeHashes {
+		if afterHash, ok := afterHashes[name]; !ok || afterHash != hash {
+			changedFiles[name] = true
+		}
+	}
+	for name := range afterHashes {
+		if _, ok := beforeHashes[name]; !ok {
+			changedFiles[name] = true
+		}
+	}
+
+	var names []string
+	for _, ts := range []*templateSet{before, after} {
+		for _, t := range ts.pristine.Templates() {
+			if t.Tree == nil || isInternalTemplateName(t.Name()) {
+				continue
+			}
+			file := t.Name()
+			if t.Tree.ParseName != "" {
+				file = t.Tree.ParseName
+			}
+			if changedFiles[file] {
+				names = append(names, t.Name())
+			}
+		}
+	}
+	return mergeTemplateNames(nil, names)
+}
+
+// mergeTemplateNames returns the sorted union of a and b.
+func mergeTemplateNames(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var names []string
+	for _, name := range append(append([]string(nil), a...), b...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (tm *watchedTM) watch(ctx context.Context) {
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	var poll <-chan time.Time
+	if tm.watcher != nil {
+		events = tm.watcher.Events
+		watchErrs = tm.watcher.Errors
+	} else {
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				// fsnotify does not watch recursively so pick up any new subdirectories.
+				if err := addDirWatches(tm.watcher, event.Name); err != nil {
+					tm.logger.Warnw("cannot watch new template directory", "dir", event.Name, "error", err)
+				}
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watchErrs:
+			if !ok {
+				return
+			}
+			tm.logger.Warnw("error watching template directory", "dir", tm.srcDir, "error", err)
+		case <-debounce:
+			debounce = nil
+			tm.reloadAndLog()
+		case <-poll:
+			tm.reloadAndLog()
+		}
+	}
+}
+
+// addDirWatches adds root and every directory beneath it to the watcher.
+func addDirWatches(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return watcher.Add(p)
+	})
+}
+
+func (tm *watchedTM) reloadAndLog() {
+	if err := tm.reload(); err != nil {
+		tm.logger.Errorw("failed to reload templates; keeping previous templates", "dir", tm.srcDir, "error", err)
+	}
+}
+
+// reload reparses the directory if it changed and swaps in the new set only on success. It always
+// checks the files, regardless of any check interval, since it only runs when they may have changed.
+func (tm *watchedTM) reload() error {
+	before := tm.templates.loaded()
+	_, err := tm.templates.check()
+	tm.notify(before)
+	return err
+}
@@ -0,0 +1,207 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	"go.viam.com/test"
+
+	"go.viam.com/utils/testutils"
+	"go.viam.com/utils/web/protojson"
+)
+
+// writeTemplateFile atomically replaces the file at path so that concurrent readers never
+// observe a partially written template.
+func writeTemplateFile(t *testing.T, path, contents string, modTime time.Time) {
+	t.Helper()
+	tmpPath := path + ".tmp"
+	test.That(t, os.WriteFile(tmpPath, []byte(contents), 0o600), test.ShouldBeNil)
+	test.That(t, os.Chtimes(tmpPath, modTime, modTime), test.ShouldBeNil)
+	test.That(t, os.Rename(tmpPath, path), test.ShouldBeNil)
+}
+
+func renderTemplate(tb testing.TB, tm TemplateManager, name string) string {
+	tb.Helper()
+	tmpl, err := tm.LookupTemplate(name)
+	test.That(tb, err, test.ShouldBeNil)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	test.That(tb, tmpl.Execute(&buf, nil), test.ShouldBeNil)
+	return buf.String()
+}
+
+func TestTemplateManagerWatched(t *testing.T) {
+	t.Run("swaps templates under concurrent lookups", func(t *testing.T) {
+		dir := t.TempDir()
+		pagePath := filepath.Join(dir, "page.html")
+		start := time.Now()
+		writeTemplateFile(t, pagePath, "version 0", start)
+
+		tm, err := newWatchedTM(dir, newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil), golog.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+		defer func() {
+			test.That(t, tm.Close(), test.ShouldBeNil)
+		}()
+
+		const versions = 5
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					tmpl, err := tm.LookupTemplate("page.html")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					var buf bytes.Buffer
+					if err := tmpl.Execute(&buf, nil); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+
+		for i := 1; i <= versions; i++ {
+			writeTemplateFile(t, pagePath, fmt.Sprintf("version %d", i), start.Add(time.Duration(i)*time.Second))
+			expected := fmt.Sprintf("version %d", i)
+			testutils.WaitForAssertion(t, func(tb testing.TB) {
+				tb.Helper()
+				test.That(tb, renderTemplate(tb, tm, "page.html"), test.ShouldEqual, expected)
+			})
+		}
+		close(done)
+		wg.Wait()
+	})
+
+	t.Run("keeps last good templates on parse error", func(t *testing.T) {
+		dir := t.TempDir()
+		pagePath := filepath.Join(dir, "page.html")
+		start := time.Now()
+		writeTemplateFile(t, pagePath, "good", start)
+
+		logger, observedLogs := golog.NewObservedTestLogger(t)
+		tm, err := newWatchedTM(dir, newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil), logger)
+		test.That(t, err, test.ShouldBeNil)
+		defer func() {
+			test.That(t, tm.Close(), test.ShouldBeNil)
+		}()
+
+		writeTemplateFile(t, pagePath, "{{ .Broken ", start.Add(time.Second))
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, observedLogs.FilterMessageSnippet("failed to reload templates").Len(), test.ShouldBeGreaterThan, 0)
+		})
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "good")
+
+		writeTemplateFile(t, pagePath, "fixed", start.Add(2*time.Second))
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			test.That(tb, renderTemplate(tb, tm, "page.html"), test.ShouldEqual, "fixed")
+		})
+	})
+
+	t.Run("initial parse error is returned", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplateFile(t, filepath.Join(dir, "page.html"), "{{ .Broken ", time.Now())
+
+		_, err := NewTemplateManagerWatched(dir)
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
+
+func TestTemplateManagerWatchedSubscribe(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeTemplateFile(t, filepath.Join(dir, "page.html"), `page {{ template "part" }}`, start)
+	writeTemplateFile(t, filepath.Join(dir, "parts.html"), `{{ define "part" }}part{{ end }}`, start)
+	writeTemplateFile(t, filepath.Join(dir, "other.html"), `other`, start)
+
+	tm, err := newWatchedTM(dir, newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil), golog.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer func() {
+		test.That(t, tm.Close(), test.ShouldBeNil)
+	}()
+
+	receive := func(ch <-chan TemplateChange) TemplateChange {
+		t.Helper()
+		select {
+		case change, ok := <-ch:
+			test.That(t, ok, test.ShouldBeTrue)
+			return change
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for a template change")
+			return TemplateChange{}
+		}
+	}
+
+	t.Run("editing a file names its templates", func(t *testing.T) {
+		changes := tm.Subscribe()
+		defer tm.Unsubscribe(changes)
+
+		before := time.Now()
+		writeTemplateFile(t, filepath.Join(dir, "parts.html"), `{{ define "part" }}new part{{ end }}`, start.Add(time.Minute))
+		change := receive(changes)
+		test.That(t, change.Names, test.ShouldResemble, []string{"part", "parts.html"})
+		test.That(t, change.Time.Before(before), test.ShouldBeFalse)
+		test.That(t, renderTemplate(t, tm, "page.html"), test.ShouldEqual, "page new part")
+	})
+
+	t.Run("slow subscribers get merged changes", func(t *testing.T) {
+		changes := tm.Subscribe()
+		defer tm.Unsubscribe(changes)
+
+		// Reload directly so that the background watcher's timing does not matter.
+		writeTemplateFile(t, filepath.Join(dir, "other.html"), `other 2`, start.Add(2*time.Minute))
+		test.That(t, tm.Reload(), test.ShouldBeNil)
+		writeTemplateFile(t, filepath.Join(dir, "added.html"), `added`, start.Add(2*time.Minute))
+		test.That(t, tm.Reload(), test.ShouldBeNil)
+
+		names := map[string]bool{}
+		testutils.WaitForAssertion(t, func(tb testing.TB) {
+			tb.Helper()
+			select {
+			case change := <-changes:
+				for _, name := range change.Names {
+					names[name] = true
+				}
+			default:
+			}
+			test.That(tb, names, test.ShouldResemble, map[string]bool{"added.html": true, "other.html": true})
+		})
+	})
+
+	t.Run("unsubscribe and close end delivery", func(t *testing.T) {
+		changes := tm.Subscribe()
+		tm.Unsubscribe(changes)
+		_, ok := <-changes
+		test.That(t, ok, test.ShouldBeFalse)
+		// unsubscribing twice is harmless.
+		tm.Unsubscribe(changes)
+
+		other, err := newWatchedTM(dir, newTemplateManagerOptions(protojson.DefaultMarshalingOptions(), nil), golog.NewTestLogger(t))
+		test.That(t, err, test.ShouldBeNil)
+		changes = other.Subscribe()
+		test.That(t, other.Close(), test.ShouldBeNil)
+		_, ok = <-changes
+		test.That(t, ok, test.ShouldBeFalse)
+		_, ok = <-other.Subscribe()
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+}